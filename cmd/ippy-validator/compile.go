@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func runCompile(args []string) int {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ippy-validator compile [flags] FILE")
+		fs.PrintDefaults()
+	}
+	out := fs.String("o", "", "output file (required)")
+	def := fs.String("default", "deny", "default action: allow or deny")
+	mode := fs.String("mode", "first-match", "rule selection: first-match or most-specific")
+	table := fs.Bool("table", false, "write a lookup table mapping addresses to 0-based rule indexes instead of a rule bundle")
+	loadDB := dbFlag(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 || *out == "" {
+		fmt.Fprintln(os.Stderr, "error: a rule file and an output file are required")
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := loadDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	rules, err := readRuleFile(fs.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	var m encoding.BinaryMarshaler
+	if *table {
+		exprs := make([]*ipexpr.IPExpr, len(rules))
+		for i, r := range rules {
+			exprs[i] = r.Expr
+		}
+		if m, err = ipexpr.NewTable(exprs, ipexpr.TableOptions{}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 1
+		}
+	} else {
+		acl, err := newACL(rules, *def, *mode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 2
+		}
+		m = acl
+	}
+
+	data, err := m.MarshalBinary()
+	if err == nil {
+		err = os.WriteFile(*out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func newACL(rules []ipfilter.Rule, def, mode string) (*ipfilter.ACL, error) {
+	a, err := parseAction(def)
+	if err != nil {
+		return nil, err
+	}
+
+	var m ipfilter.Mode
+	switch mode {
+	case "first-match":
+		m = ipfilter.FirstMatch
+	case "most-specific":
+		m = ipfilter.MostSpecific
+	default:
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+	return ipfilter.NewACL(rules, a, m)
+}
+
+func parseAction(s string) (ipfilter.Action, error) {
+	switch s {
+	case "allow":
+		return ipfilter.Allow, nil
+	case "deny":
+		return ipfilter.Deny, nil
+	default:
+		return 0, fmt.Errorf("unknown default action %q", s)
+	}
+}
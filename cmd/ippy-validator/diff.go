@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ippy-validator diff [flags] OLD NEW")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "patterns", "address set format: patterns, ranges or cidrs")
+	loadDB := dbFlag(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "error: two rule files are required")
+		fs.Usage()
+		return 2
+	}
+	if *format != "patterns" && *format != "ranges" && *format != "cidrs" {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", *format)
+		return 2
+	}
+
+	opts, err := loadDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	olds, err := readRuleFile(fs.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fs.Arg(0), err)
+		return 2
+	}
+	news, err := readRuleFile(fs.Arg(1), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fs.Arg(1), err)
+		return 2
+	}
+
+	changed := false
+	for i := range max(len(olds), len(news)) {
+		switch {
+		case i >= len(news):
+			fmt.Printf("@@ rule %d: %s %s removed (-%d)\n", i+1, olds[i].Action, olds[i].Pattern, olds[i].Expr.Count())
+			printSet("-", *format, []*ipexpr.IPExpr{olds[i].Expr})
+			changed = true
+		case i >= len(olds):
+			fmt.Printf("@@ rule %d: %s %s added (+%d)\n", i+1, news[i].Action, news[i].Pattern, news[i].Expr.Count())
+			printSet("+", *format, []*ipexpr.IPExpr{news[i].Expr})
+			changed = true
+		default:
+			o, n := olds[i], news[i]
+			d := ipexpr.Diff(o.Expr, n.Expr)
+			if d.Equal() && o.Action == n.Action {
+				continue
+			}
+
+			fmt.Printf("@@ rule %d: %s %s -> %s %s (+%d -%d)", i+1, o.Action, o.Pattern, n.Action, n.Pattern, d.AddedCount, d.RemovedCount)
+			if o.Action != n.Action {
+				fmt.Print(" action changed")
+			}
+			fmt.Println()
+			printSet("+", *format, d.Added)
+			printSet("-", *format, d.Removed)
+			changed = true
+		}
+	}
+
+	if changed {
+		return 1
+	}
+	return 0
+}
+
+func printSet(sign, format string, exprs []*ipexpr.IPExpr) {
+	switch format {
+	case "ranges":
+		for r := range ipexpr.Ranges(exprs...) {
+			fmt.Println(sign, r)
+		}
+	case "cidrs":
+		for p := range ipexpr.Prefixes(exprs...) {
+			fmt.Println(sign, p)
+		}
+	default:
+		for _, e := range exprs {
+			fmt.Println(sign, e)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipexpr/export"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ippy-validator export [flags] FILE")
+		fmt.Fprintln(fs.Output(), "       ippy-validator export [flags] -pattern PATTERN")
+		fs.PrintDefaults()
+	}
+	formats := make([]string, len(export.Formats))
+	for i, f := range export.Formats {
+		formats[i] = string(f)
+	}
+	format := fs.String("format", "nft", "output format: "+strings.Join(formats, ", "))
+	pattern := fs.String("pattern", "", "export the addresses matched by a single pattern instead of a rule file")
+	name := fs.String("name", "", `name of the generated table, chain or sets (default "ippy")`)
+	def := fs.String("default", "deny", "action for addresses no rule matches: allow or deny")
+	dst := fs.Bool("dst", false, "match destination addresses instead of source ones")
+	intervals := fs.Bool("intervals", false, "write nft set elements as address ranges instead of CIDRs")
+	maxElems := fs.Int("max-elements", 0, "fail past this many CIDRs or ranges (default 1048576)")
+	loadDB := dbFlag(fs)
+	_ = fs.Parse(args)
+
+	if (fs.NArg() == 1) == (*pattern != "") || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "error: either a rule file or -pattern is required")
+		fs.Usage()
+		return 2
+	}
+
+	opts := export.Options{Name: *name, Destination: *dst, Intervals: *intervals, MaxElements: *maxElems}
+	action, err := parseAction(*def)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	if action == ipfilter.Allow {
+		opts.Default = export.DefaultAllow
+	}
+
+	parseOpts, err := loadDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+
+	var rules []ipfilter.Rule
+	if *pattern != "" {
+		e, err := ipexpr.ParseWithOptions(*pattern, parseOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot compile: %s\n", err)
+			return 2
+		}
+		rules = export.Allow(e)
+	} else if rules, err = readRuleFile(fs.Arg(0), parseOpts); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	if err := export.Write(os.Stdout, export.Format(*format), rules, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/azraelsec/ippy/pkg/ipdata"
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+// dbFlag registers the -db flag, naming the GeoIP and ASN databases that
+// resolve the country: and asn: atoms of patterns, and returns the function
+// loading them once the flags are parsed.
+func dbFlag(fs *flag.FlagSet) func() (ipexpr.ParseOptions, error) {
+	var paths []string
+	fs.Func("db", "MMDB or CSV database resolving country: and asn: atoms (repeatable)", func(s string) error {
+		paths = append(paths, s)
+		return nil
+	})
+
+	return func() (ipexpr.ParseOptions, error) {
+		if len(paths) == 0 {
+			return ipexpr.ParseOptions{}, nil
+		}
+		db, err := ipdata.Open(paths...)
+		if err != nil {
+			return ipexpr.ParseOptions{}, err
+		}
+		return ipexpr.ParseOptions{Resolver: db}, nil
+	}
+}
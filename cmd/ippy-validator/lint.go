@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ippy-validator lint [flags] FILE...")
+		fs.PrintDefaults()
+	}
+	strict := fs.Bool("strict", false, "exit with an error on warnings too")
+	loadDB := dbFlag(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "error: at least one rule file is required")
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := loadDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		rules, err := readRuleFile(path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			failed = true
+			continue
+		}
+
+		for _, f := range ipfilter.Lint(rules) {
+			fmt.Printf("%s:%d: %s: %s\n", path, f.Line, f.Severity, f.Message)
+			if f.Severity == ipfilter.Error || (*strict && f.Severity == ipfilter.Warning) {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func readRuleFile(path string, opts ipexpr.ParseOptions) ([]ipfilter.Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return ipfilter.ReadRulesWithOptions(f, opts)
+}
@@ -1,44 +1,45 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-
-	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"strings"
 )
 
-func main() {
-	matching := flag.String("pattern", "", "IPv4 pattern to validate the ip against")
-	ip := flag.String("ip", "", "IPv4 value to validate")
-	flag.Parse()
+const usage = `usage: ippy-validator <command> [arguments]
 
-	if *matching == "" {
-		fmt.Fprintln(os.Stderr, "error: -pattern flag is required")
-		flag.Usage()
-		os.Exit(2)
-	}
-	if *ip == "" {
-		fmt.Fprintln(os.Stderr, "error: -ip flag is required")
-		flag.Usage()
-		os.Exit(2)
-	}
+commands:
+  match   check whether an ip matches a pattern (default)
+  lint    report problems in rule files
+  diff    show the addresses two rule files disagree on, rule by rule
+  compile write a rule file as a binary rule bundle
+  export  translate a rule file or a pattern into firewall rules
 
-	ipexpr, err := ipexpr.Parse(*matching)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "cannot compile: %s\n", err.Error())
-		os.Exit(1)
-	}
+Run "ippy-validator <command> -h" for the command flags.
+`
 
-	matches, err := ipexpr.Matches(*ip)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "cannot match: %s\n", err.Error())
-		os.Exit(1)
+func main() {
+	cmd, args := "match", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	if matches {
-		fmt.Println("ip matches the given pattern")
-	} else {
-		fmt.Println("ip does not match the given pattern")
+	switch cmd {
+	case "match":
+		os.Exit(runMatch(args))
+	case "lint":
+		os.Exit(runLint(args))
+	case "diff":
+		os.Exit(runDiff(args))
+	case "compile":
+		os.Exit(runCompile(args))
+	case "export":
+		os.Exit(runExport(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown command %q\n", cmd)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func runMatch(args []string) int {
+	fs := flag.NewFlagSet("match", flag.ExitOnError)
+	matching := fs.String("pattern", "", "IPv4 pattern to validate the ip against")
+	ip := fs.String("ip", "", "IPv4 value to validate")
+	loadDB := dbFlag(fs)
+	_ = fs.Parse(args)
+
+	if *matching == "" {
+		fmt.Fprintln(os.Stderr, "error: -pattern flag is required")
+		fs.Usage()
+		return 2
+	}
+	if *ip == "" {
+		fmt.Fprintln(os.Stderr, "error: -ip flag is required")
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := loadDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+
+	ipexpr, err := ipexpr.ParseWithOptions(*matching, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot compile: %s\n", err.Error())
+		return 1
+	}
+
+	matches, err := ipexpr.Matches(*ip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot match: %s\n", err.Error())
+		return 1
+	}
+
+	if matches {
+		fmt.Println("ip matches the given pattern")
+	} else {
+		fmt.Println("ip does not match the given pattern")
+	}
+	return 0
+}
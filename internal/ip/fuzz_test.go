@@ -0,0 +1,35 @@
+package ip_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/azraelsec/ippy/internal/ip"
+)
+
+func FuzzParse(f *testing.F) {
+	f.Add("192.168.1.1")
+	f.Add("0.0.0.0")
+	f.Add("255.255.255.255")
+	f.Add("192.168.001.001")
+	f.Add("1.2.3.256")
+	f.Add("1.2.3.+1")
+	f.Add("::ffff:1.2.3.4")
+	f.Add("1.2.3.4%eth0")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		got, err := ip.Parse(s)
+		want, werr := netip.ParseAddr(s)
+		// netip also parses IPv6 addresses, IPv4-mapped ones included
+		wantOK := werr == nil && want.Is4()
+		if (err == nil) != wantOK {
+			t.Fatalf("Parse(%q) error = %v, netip.ParseAddr() = %v, %v", s, err, want, werr)
+		}
+		if err != nil {
+			return
+		}
+		if len(got) != 4 || netip.AddrFrom4([4]byte(got)) != want {
+			t.Fatalf("Parse(%q) = %v, netip.ParseAddr() = %v", s, got, want)
+		}
+	})
+}
@@ -10,6 +10,8 @@ import (
 
 type IPv4 = net.IP
 
+// Parse parses a dotted-quad IPv4 address. As net/netip, it rejects octets
+// with leading zeros, which inet_aton would read as octal.
 func Parse(ip string) (IPv4, error) {
 	parts := strings.Split(ip, ".")
 	if len(parts) != 4 {
@@ -18,6 +20,9 @@ func Parse(ip string) (IPv4, error) {
 
 	octets := [4]byte{}
 	for i, os := range parts {
+		if len(os) > 1 && os[0] == '0' {
+			return net.IPv4zero, fmt.Errorf("invalid ip: %s: octet with leading zero", ip)
+		}
 		octet, err := strconv.ParseUint(os, 10, 8)
 		if err != nil {
 			return net.IPv4zero, err
@@ -200,12 +200,18 @@ func TestParseIP(t *testing.T) {
 			wantErr: true,
 		},
 
-		// Edge cases with leading zeros
+		// Edge cases with leading zeros, rejected as by net/netip
 		{
-			name:    "valid IP - leading zeros",
+			name:    "invalid IP - leading zeros",
 			input:   "192.168.001.001",
-			want:    net.IPv4(192, 168, 1, 1),
-			wantErr: false,
+			want:    net.IPv4zero,
+			wantErr: true,
+		},
+		{
+			name:    "invalid IP - leading zero",
+			input:   "010.0.0.1",
+			want:    net.IPv4zero,
+			wantErr: true,
 		},
 		{
 			name:    "valid IP - single zero",
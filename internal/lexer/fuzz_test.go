@@ -0,0 +1,54 @@
+package lexer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/internal/lexer"
+	"github.com/azraelsec/ippy/internal/token"
+)
+
+func FuzzNextToken(f *testing.F) {
+	f.Add("1-10,20,*")
+	f.Add("  1 - 2 , 3  ")
+	f.Add("000123456")
+	f.Add("1\x002")
+	f.Add("\xc3\xa9")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := lexer.New(input)
+
+		// every token but EOF consumes a byte at least, and the literals
+		// are the input without its spaces
+		var sb strings.Builder
+		for range len(input) + 1 {
+			tkn := l.NextToken()
+			if tkn.Type == token.EOF {
+				if got, want := sb.String(), strings.ReplaceAll(input, " ", ""); got != want {
+					t.Fatalf("literals of %q = %q, want %q", input, got, want)
+				}
+				if next := l.NextToken(); next.Type != token.EOF {
+					t.Fatalf("NextToken() after EOF = %v", next)
+				}
+				return
+			}
+			if tkn.Literal == "" {
+				t.Fatalf("token %v of %q has no literal", tkn, input)
+			}
+			switch tkn.Type {
+			case token.NUMBER:
+				if strings.Trim(tkn.Literal, "0123456789") != "" {
+					t.Fatalf("NUMBER token %q of %q", tkn.Literal, input)
+				}
+			case token.DASH, token.ASTERISK, token.COMMA, token.ILLEGAL:
+				if len(tkn.Literal) != 1 {
+					t.Fatalf("%s token %q of %q", tkn.Type, tkn.Literal, input)
+				}
+			default:
+				t.Fatalf("unknown token %v of %q", tkn, input)
+			}
+			sb.WriteString(tkn.Literal)
+		}
+		t.Fatalf("no EOF after %d tokens of %q", len(input)+1, input)
+	})
+}
@@ -36,21 +36,27 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhiteSpaces()
 
+	// the input ends past its last byte, not at a NUL byte it may hold
+	if l.position >= len(l.input) {
+		return token.New(token.EOF, "")
+	}
+
+	// literals are slices of the input: string(l.ch) would encode bytes
+	// past 0x7f as runes
+	lit := l.input[l.position:l.readPosition]
 	switch l.ch {
 	case '-':
-		tkn = token.New(token.DASH, string(l.ch))
+		tkn = token.New(token.DASH, lit)
 	case '*':
-		tkn = token.New(token.ASTERISK, string(l.ch))
+		tkn = token.New(token.ASTERISK, lit)
 	case ',':
-		tkn = token.New(token.COMMA, string(l.ch))
-	case nul:
-		tkn = token.New(token.EOF, "")
+		tkn = token.New(token.COMMA, lit)
 	default:
 		if isDigit(l.ch) {
 			tkn = token.New(token.NUMBER, l.readNumber())
 			return tkn
 		}
-		tkn = token.New(token.ILLEGAL, string(l.ch))
+		tkn = token.New(token.ILLEGAL, lit)
 	}
 
 	l.readChar()
@@ -0,0 +1,72 @@
+package parser_test
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/internal/parser"
+)
+
+// termRE is the grammar of an octet term: *, a number or a range of numbers,
+// with spaces around tokens. Numbers have no leading zeros.
+var termRE = regexp.MustCompile(`^ *(?:(\*)|(0|[1-9][0-9]{0,2}) *(?:- *(0|[1-9][0-9]{0,2}))?) *$`)
+
+// referenceParse is the reference parser the parser is checked against.
+func referenceParse(s string) ([]parser.Interval, bool) {
+	terms := strings.Split(s, ",")
+	if len(terms) > parser.MaxTerms || strings.Trim(s, " ") == "" {
+		return nil, false
+	}
+	var its []parser.Interval
+	for _, term := range terms {
+		m := termRE.FindStringSubmatch(term)
+		if m == nil {
+			return nil, false
+		}
+		if m[1] != "" {
+			its = append(its, parser.Interval{0, 255})
+			continue
+		}
+		lo, _ := strconv.Atoi(m[2])
+		hi := lo
+		if m[3] != "" {
+			hi, _ = strconv.Atoi(m[3])
+		}
+		if lo > 255 || hi > 255 {
+			return nil, false
+		}
+		its = append(its, parser.Interval{uint8(lo), uint8(hi)})
+	}
+	return its, true
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("1-10,20,*")
+	f.Add(" 0 - 255 , 7 ")
+	f.Add("1 2")
+	f.Add("1,")
+	f.Add("255-0")
+	f.Add("0001")
+	f.Add("1\x00")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(input)
+		got, ok := p.Parse()
+		want, wantOK := referenceParse(input)
+		if ok != wantOK {
+			t.Fatalf("Parse(%q) ok = %v (%v), reference %v", input, ok, p.Errors(), wantOK)
+		}
+		if !ok {
+			if len(p.Errors()) == 0 {
+				t.Fatalf("Parse(%q) failed without errors", input)
+			}
+			return
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Parse(%q) = %v, reference %v", input, got, want)
+		}
+	})
+}
@@ -9,9 +9,18 @@ import (
 
 	"github.com/azraelsec/ippy/internal/lexer"
 	"github.com/azraelsec/ippy/internal/token"
+	"github.com/azraelsec/ippy/pkg/bitsvector"
 )
 
-type Interval [2]byte
+type Interval = bitsvector.Interval
+
+// MaxTerms bounds the comma separated terms of an octet expression: past 256
+// terms, a list only repeats values.
+const MaxTerms = 256
+
+// maxNumberLen bounds the digits of a number, so that giant digit strings
+// are rejected before being converted.
+const maxNumberLen = 3
 
 type Parser struct {
 	l *lexer.Lexer
@@ -49,21 +58,30 @@ func (p *Parser) currError(t token.Type) {
 	p.errors = append(p.errors, msg)
 }
 
-func (p *Parser) peekTokenIs(t token.Type) bool {
-	return p.peekToken.Type == t
-}
-
 func (p *Parser) parseExpr() ([]Interval, bool) {
 	var intervals []Interval
 	for !p.currTokenIs(token.EOF) {
+		if len(intervals) == MaxTerms {
+			msg := fmt.Sprintf("a valid octet should have at most %d ranges", MaxTerms)
+			p.errors = append(p.errors, msg)
+			return []Interval{}, false
+		}
 		interval, ok := p.parseTerm()
 		if !ok {
 			return []Interval{}, false
 		}
 		intervals = append(intervals, interval)
 
-		if !p.peekTokenIs(token.EOF) {
-			p.expectCurrIs(token.COMMA)
+		if p.currTokenIs(token.EOF) {
+			break
+		}
+		// terms are separated by commas, which are followed by a term
+		if !p.expectCurrIs(token.COMMA) {
+			return []Interval{}, false
+		}
+		if p.currTokenIs(token.EOF) {
+			p.currError(token.NUMBER)
+			return []Interval{}, false
 		}
 	}
 	return intervals, true
@@ -115,8 +133,14 @@ func (p *Parser) parseNumber() (uint8, bool) {
 		return 0, false
 	}
 
-	num, err := strconv.Atoi(p.currToken.Literal)
-	if err != nil || num < 0 || num > 255 {
+	// numbers have no leading zeros, as the octets of ip.Parse
+	lit := p.currToken.Literal
+	if len(lit) > maxNumberLen || len(lit) > 1 && lit[0] == '0' {
+		p.numberParsingError()
+		return 0, false
+	}
+	num, err := strconv.ParseUint(lit, 10, 8)
+	if err != nil {
 		p.numberParsingError()
 		return 0, false
 	}
@@ -78,6 +78,22 @@ func TestParse_Invalid(t *testing.T) {
 			input:        "abc",
 			expectedErrs: []string{"expected current token type is NUMBER"},
 		},
+		{
+			input:        "0001",
+			expectedErrs: []string{"numeric value 0001 is not valid"},
+		},
+		{
+			input:        "010",
+			expectedErrs: []string{"numeric value 010 is not valid"},
+		},
+		{
+			input:        "1-00",
+			expectedErrs: []string{"numeric value 00 is not valid"},
+		},
+		{
+			input:        "1-99999999999999999999",
+			expectedErrs: []string{"numeric value 99999999999999999999 is not valid"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -115,6 +131,26 @@ func TestParse_Invalid(t *testing.T) {
 	}
 }
 
+func TestParse_MaxTerms(t *testing.T) {
+	terms := strings.Repeat("1,", parser.MaxTerms-1) + "1"
+	if its, ok := parser.New(terms).Parse(); !ok || len(its) != parser.MaxTerms {
+		t.Errorf("Parse() of %d terms = %d intervals, %v", parser.MaxTerms, len(its), ok)
+	}
+
+	p := parser.New(terms + ",1")
+	if _, ok := p.Parse(); ok {
+		t.Fatalf("Parse() of %d terms expected to fail but succeeded", parser.MaxTerms+1)
+	}
+	if errs := p.Errors(); len(errs) != 1 || !strings.Contains(errs[0], "at most 256 ranges") {
+		t.Errorf("Parse() errors = %v", errs)
+	}
+
+	// long digit strings are rejected however long
+	if _, ok := parser.New(strings.Repeat("0", 1<<20)).Parse(); ok {
+		t.Errorf("Parse() of a long digit string expected to fail but succeeded")
+	}
+}
+
 func TestParser_New(t *testing.T) {
 	// Test that New creates a parser with proper initial state
 	p := parser.New("123")
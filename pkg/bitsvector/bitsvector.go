@@ -0,0 +1,210 @@
+// Package bitsvector provides a compact bit vector implementation for representing
+// sets of byte values (0-255) using four 64-bit words, where each bit corresponds
+// to whether a specific byte value is present in the set.
+package bitsvector
+
+import (
+	"iter"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Interval is an inclusive range of byte values.
+type Interval [2]byte
+
+var AllSet = OctetBits{
+	^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0),
+}
+
+// OctetBits is a set of byte values. Value n is stored in bit n%64 of word
+// n/64. The zero value is the empty set.
+type OctetBits [4]uint64
+
+// New builds the set holding every value covered by the intervals. Reversed
+// intervals (start greater than end) are empty.
+func New(its []Interval) OctetBits {
+	var ob OctetBits
+	for _, it := range its {
+		ob.SetRange(it[0], it[1])
+	}
+	return ob
+}
+
+// SetRange adds every value between lo and hi, inclusive, to the set. It fills
+// whole words at once, touching at most four of them.
+func (o *OctetBits) SetRange(lo, hi byte) {
+	if lo > hi {
+		return
+	}
+
+	first, last := lo/64, hi/64
+	for w := first; w <= last; w++ {
+		mask := ^uint64(0)
+		if w == first {
+			mask &= ^uint64(0) << (lo % 64)
+		}
+		if w == last {
+			mask &= ^uint64(0) >> (63 - hi%64)
+		}
+		o[w] |= mask
+	}
+}
+
+// Set adds n to the set.
+func (o *OctetBits) Set(n byte) {
+	o[n/64] |= 1 << (n % 64)
+}
+
+// Clear removes n from the set.
+func (o *OctetBits) Clear(n byte) {
+	o[n/64] &^= 1 << (n % 64)
+}
+
+// Test reports whether n is in the set.
+func (o OctetBits) Test(n byte) bool {
+	return o[n/64]&(1<<(n%64)) != 0
+}
+
+// Empty reports whether the set holds no value.
+func (o OctetBits) Empty() bool {
+	return o[0]|o[1]|o[2]|o[3] == 0
+}
+
+// Count returns the number of values in the set.
+func (o OctetBits) Count() int {
+	return bits.OnesCount64(o[0]) + bits.OnesCount64(o[1]) +
+		bits.OnesCount64(o[2]) + bits.OnesCount64(o[3])
+}
+
+// Union returns the values present in either set.
+func (o OctetBits) Union(p OctetBits) OctetBits {
+	for i := range o {
+		o[i] |= p[i]
+	}
+	return o
+}
+
+// Intersect returns the values present in both sets.
+func (o OctetBits) Intersect(p OctetBits) OctetBits {
+	for i := range o {
+		o[i] &= p[i]
+	}
+	return o
+}
+
+// Xor returns the values present in exactly one of the sets.
+func (o OctetBits) Xor(p OctetBits) OctetBits {
+	for i := range o {
+		o[i] ^= p[i]
+	}
+	return o
+}
+
+// Not returns the complement of the set.
+func (o OctetBits) Not() OctetBits {
+	for i := range o {
+		o[i] = ^o[i]
+	}
+	return o
+}
+
+// Min returns the smallest value in the set, false if it is empty.
+func (o OctetBits) Min() (byte, bool) {
+	return o.NextSet(0)
+}
+
+// Max returns the largest value in the set, false if it is empty.
+func (o OctetBits) Max() (byte, bool) {
+	return o.PrevSet(255)
+}
+
+// NextSet returns the smallest value in the set that is not lower than from,
+// false if there is none.
+func (o OctetBits) NextSet(from byte) (byte, bool) {
+	w := from / 64
+	word := o[w] &^ (1<<(from%64) - 1)
+	for {
+		if word != 0 {
+			return w*64 + byte(bits.TrailingZeros64(word)), true
+		}
+		if w == 3 {
+			return 0, false
+		}
+		w++
+		word = o[w]
+	}
+}
+
+// PrevSet returns the largest value in the set that is not greater than from,
+// false if there is none.
+func (o OctetBits) PrevSet(from byte) (byte, bool) {
+	w := from / 64
+	word := o[w] & (^uint64(0) >> (63 - from%64))
+	for {
+		if word != 0 {
+			return w*64 + byte(63-bits.LeadingZeros64(word)), true
+		}
+		if w == 0 {
+			return 0, false
+		}
+		w--
+		word = o[w]
+	}
+}
+
+// Intervals returns the set as a sorted list of maximal disjoint intervals.
+func (o OctetBits) Intervals() []Interval {
+	var its []Interval
+	start, ok := o.Min()
+	for ok {
+		// the interval ends right before the first value missing from the set
+		end := byte(255)
+		if gap, found := o.Not().NextSet(start); found {
+			end = gap - 1
+		}
+		its = append(its, Interval{start, end})
+		if end == 255 {
+			break
+		}
+		start, ok = o.NextSet(end + 1)
+	}
+	return its
+}
+
+// All returns an iterator over the values in the set, in ascending order.
+func (o OctetBits) All() iter.Seq[byte] {
+	return func(yield func(byte) bool) {
+		for w, word := range o {
+			for word != 0 {
+				n := bits.TrailingZeros64(word)
+				if !yield(byte(w*64 + n)) {
+					return
+				}
+				word &= word - 1
+			}
+		}
+	}
+}
+
+// String renders the set in the pattern syntax: "*" when every value is
+// present, its intervals separated by commas otherwise. The empty set is
+// rendered as the empty string.
+func (o OctetBits) String() string {
+	if o == AllSet {
+		return "*"
+	}
+
+	var sb strings.Builder
+	for i, it := range o.Intervals() {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Itoa(int(it[0])))
+		if it[0] != it[1] {
+			sb.WriteByte('-')
+			sb.WriteString(strconv.Itoa(int(it[1])))
+		}
+	}
+	return sb.String()
+}
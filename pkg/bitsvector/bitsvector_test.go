@@ -0,0 +1,634 @@
+package bitsvector
+
+import (
+	"testing"
+)
+
+func TestNew_SingleInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		testByte  byte
+		expected  bool
+	}{
+		{
+			name:      "single byte interval",
+			intervals: []Interval{{10, 10}},
+			testByte:  10,
+			expected:  true,
+		},
+		{
+			name:      "single byte interval - test outside",
+			intervals: []Interval{{10, 10}},
+			testByte:  11,
+			expected:  false,
+		},
+		{
+			name:      "range interval",
+			intervals: []Interval{{10, 15}},
+			testByte:  12,
+			expected:  true,
+		},
+		{
+			name:      "range interval - start boundary",
+			intervals: []Interval{{10, 15}},
+			testByte:  10,
+			expected:  true,
+		},
+		{
+			name:      "range interval - end boundary",
+			intervals: []Interval{{10, 15}},
+			testByte:  15,
+			expected:  true,
+		},
+		{
+			name:      "range interval - outside range",
+			intervals: []Interval{{10, 15}},
+			testByte:  16,
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := New(tt.intervals)
+			result := ob.Test(tt.testByte)
+			if result != tt.expected {
+				t.Errorf("Test(%d) = %v, expected %v", tt.testByte, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNew_MultipleIntervals(t *testing.T) {
+	intervals := []Interval{{1, 5}, {10, 15}, {20, 25}}
+	ob := New(intervals)
+
+	// Test bytes within intervals
+	testCases := []struct {
+		testByte byte
+		expected bool
+	}{
+		{1, true},   // first interval start
+		{3, true},   // first interval middle
+		{5, true},   // first interval end
+		{7, false},  // between intervals
+		{10, true},  // second interval start
+		{12, true},  // second interval middle
+		{15, true},  // second interval end
+		{18, false}, // between intervals
+		{20, true},  // third interval start
+		{22, true},  // third interval middle
+		{25, true},  // third interval end
+		{30, false}, // after all intervals
+		{0, false},  // before all intervals
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(rune(tc.testByte)), func(t *testing.T) {
+			result := ob.Test(tc.testByte)
+			if result != tc.expected {
+				t.Errorf("Test(%d) = %v, expected %v", tc.testByte, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNew_LastValue(t *testing.T) {
+	// [255, 255] used to be special-cased into AllSet
+	intervals := []Interval{{255, 255}}
+	ob := New(intervals)
+
+	if ob == AllSet {
+		t.Error("New with interval [255, 255] should not return AllSet")
+	}
+
+	// Test that only the last bit is set
+	for i := 0; i <= 255; i++ {
+		if ob.Test(byte(i)) != (i == 255) {
+			t.Errorf("Test(%d) = %v, expected %v", i, ob.Test(byte(i)), i == 255)
+		}
+	}
+}
+
+func TestNew_ReversedInterval(t *testing.T) {
+	ob := New([]Interval{{10, 5}})
+	if !ob.Empty() {
+		t.Errorf("New with a reversed interval should be empty, got %s", ob)
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		lo, hi   byte
+		expected OctetBits
+	}{
+		{"single value", 5, 5, OctetBits{1 << 5, 0, 0, 0}},
+		{"within a word", 64, 127, OctetBits{0, ^uint64(0), 0, 0}},
+		{"across words", 62, 129, OctetBits{3 << 62, ^uint64(0), 3, 0}},
+		{"full range", 0, 255, AllSet},
+		{"last value", 255, 255, OctetBits{0, 0, 0, 1 << 63}},
+		{"reversed", 200, 100, OctetBits{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := OctetBits{}
+			ob.SetRange(tt.lo, tt.hi)
+			if ob != tt.expected {
+				t.Errorf("SetRange(%d, %d) = %x, expected %x", tt.lo, tt.hi, ob, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNew_EmptyIntervals(t *testing.T) {
+	intervals := []Interval{}
+	ob := New(intervals)
+
+	// All bits should be unset
+	for i := 0; i <= 255; i++ {
+		if ob.Test(byte(i)) {
+			t.Errorf("Empty intervals should not have bit %d set", i)
+		}
+	}
+}
+
+func TestNew_FullRange(t *testing.T) {
+	intervals := []Interval{{0, 255}}
+	ob := New(intervals)
+
+	// All bits should be set
+	for i := 0; i <= 255; i++ {
+		if !ob.Test(byte(i)) {
+			t.Errorf("Full range should have bit %d set", i)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	ob := &OctetBits{}
+
+	// Test setting various bits
+	testBits := []byte{0, 1, 7, 8, 15, 16, 31, 63, 127, 255}
+
+	for _, bit := range testBits {
+		ob.Set(bit)
+		if !ob.Test(bit) {
+			t.Errorf("After setting bit %d, Test(%d) should return true", bit, bit)
+		}
+	}
+}
+
+func TestSet_BitManipulation(t *testing.T) {
+	ob := &OctetBits{}
+
+	// Test setting bits in the same word
+	ob.Set(0)  // First bit of first word
+	ob.Set(1)  // Second bit of first word
+	ob.Set(7)  // Last bit of first byte
+	ob.Set(63) // Last bit of first word
+
+	// Check that the correct bits are set
+	if ob[0] != 0x8000000000000083 {
+		t.Errorf("Expected first word to be 0x8000000000000083, got 0x%016x", ob[0])
+	}
+
+	// Test setting bits in different words
+	ob.Set(64)  // First bit of second word
+	ob.Set(255) // Last bit of last word
+
+	if ob[1] != 0x01 {
+		t.Errorf("Expected second word to be 0x01, got 0x%016x", ob[1])
+	}
+
+	if ob[2] != 0 {
+		t.Errorf("Expected third word to be empty, got 0x%016x", ob[2])
+	}
+
+	if ob[3] != 1<<63 {
+		t.Errorf("Expected fourth word to be 0x8000000000000000, got 0x%016x", ob[3])
+	}
+}
+
+func TestClear(t *testing.T) {
+	ob := New([]Interval{{0, 255}})
+
+	for _, bit := range []byte{0, 63, 64, 200, 255} {
+		ob.Clear(bit)
+		if ob.Test(bit) {
+			t.Errorf("After clearing bit %d, Test(%d) should return false", bit, bit)
+		}
+	}
+	if ob.Count() != 251 {
+		t.Errorf("Count() = %d, expected 251", ob.Count())
+	}
+
+	// clearing a missing value is a no-op
+	ob.Clear(0)
+	if ob.Count() != 251 {
+		t.Errorf("Count() after clearing a missing value = %d, expected 251", ob.Count())
+	}
+}
+
+func TestTest_AllBits(t *testing.T) {
+	// Test with AllSet
+	for i := 0; i <= 255; i++ {
+		if !AllSet.Test(byte(i)) {
+			t.Errorf("AllSet should have bit %d set", i)
+		}
+	}
+
+	// Test with empty OctetBits
+	empty := &OctetBits{}
+	for i := 0; i <= 255; i++ {
+		if empty.Test(byte(i)) {
+			t.Errorf("Empty OctetBits should not have bit %d set", i)
+		}
+	}
+}
+
+func TestTest_EdgeCases(t *testing.T) {
+	ob := &OctetBits{}
+
+	// Test edge cases: first and last bits
+	ob.Set(0)
+	ob.Set(255)
+
+	if !ob.Test(0) {
+		t.Error("Test(0) should return true after setting bit 0")
+	}
+
+	if !ob.Test(255) {
+		t.Error("Test(255) should return true after setting bit 255")
+	}
+
+	// Test that other bits are not set
+	if ob.Test(1) {
+		t.Error("Test(1) should return false when only bits 0 and 255 are set")
+	}
+
+	if ob.Test(254) {
+		t.Error("Test(254) should return false when only bits 0 and 255 are set")
+	}
+}
+
+func TestOctetBits_BitPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		setBits  []byte
+		testBits []struct {
+			bit      byte
+			expected bool
+		}
+	}{
+		{
+			name:    "alternating pattern",
+			setBits: []byte{0, 2, 4, 6, 8, 10, 12, 14},
+			testBits: []struct {
+				bit      byte
+				expected bool
+			}{
+				{0, true},
+				{1, false},
+				{2, true},
+				{3, false},
+				{4, true},
+				{5, false},
+			},
+		},
+		{
+			name:    "byte boundaries",
+			setBits: []byte{7, 8, 15, 16, 31, 32},
+			testBits: []struct {
+				bit      byte
+				expected bool
+			}{
+				{7, true},
+				{8, true},
+				{15, true},
+				{16, true},
+				{31, true},
+				{32, true},
+				{6, false},
+				{9, false},
+				{14, false},
+				{17, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := &OctetBits{}
+
+			// Set the specified bits
+			for _, bit := range tt.setBits {
+				ob.Set(bit)
+			}
+
+			// Test the expected results
+			for _, testCase := range tt.testBits {
+				result := ob.Test(testCase.bit)
+				if result != testCase.expected {
+					t.Errorf("Test(%d) = %v, expected %v", testCase.bit, result, testCase.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		expected  int
+	}{
+		{"empty", []Interval{}, 0},
+		{"single value", []Interval{{10, 10}}, 1},
+		{"range", []Interval{{10, 20}}, 11},
+		{"overlapping ranges", []Interval{{10, 20}, {15, 30}}, 21},
+		{"full range", []Interval{{0, 255}}, 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := New(tt.intervals)
+			if got := ob.Count(); got != tt.expected {
+				t.Errorf("Count() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	a := New([]Interval{{0, 20}, {100, 120}})
+	b := New([]Interval{{10, 110}})
+
+	got := a.Intersect(b)
+	want := New([]Interval{{10, 20}, {100, 110}})
+	if got != want {
+		t.Errorf("Intersect() = %v, expected %v", got, want)
+	}
+
+	if empty := a.Intersect(OctetBits{}); empty.Count() != 0 {
+		t.Errorf("Intersect() with the empty set has %d values", empty.Count())
+	}
+}
+
+func TestNot(t *testing.T) {
+	ob := New([]Interval{{0, 9}, {250, 255}})
+
+	got := ob.Not()
+	if got != New([]Interval{{10, 249}}) {
+		t.Errorf("Not() = %v, expected [10, 249]", got.Intervals())
+	}
+	if got.Not() != ob {
+		t.Errorf("Not() is not an involution")
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		expected  []Interval
+	}{
+		{"empty", []Interval{}, nil},
+		{"single value", []Interval{{7, 7}}, []Interval{{7, 7}}},
+		{"merged ranges", []Interval{{20, 30}, {1, 5}, {6, 10}, {25, 40}}, []Interval{{1, 10}, {20, 40}}},
+		{"boundaries", []Interval{{0, 0}, {255, 255}, {128, 128}}, []Interval{{0, 0}, {128, 128}, {255, 255}}},
+		{"full range", []Interval{{0, 255}}, []Interval{{0, 255}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.intervals).Intervals()
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Intervals() = %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Intervals()[%d] = %v, expected %v", i, got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+// Benchmark tests
+func BenchmarkNew_SingleInterval(b *testing.B) {
+	intervals := []Interval{{10, 20}}
+
+	for i := 0; i < b.N; i++ {
+		New(intervals)
+	}
+}
+
+func BenchmarkNew_MultipleIntervals(b *testing.B) {
+	intervals := []Interval{{1, 10}, {20, 30}, {40, 50}, {60, 70}}
+
+	for i := 0; i < b.N; i++ {
+		New(intervals)
+	}
+}
+
+func BenchmarkNew_FullRange(b *testing.B) {
+	intervals := []Interval{{0, 255}}
+
+	for i := 0; i < b.N; i++ {
+		New(intervals)
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	ob := &OctetBits{}
+
+	for i := 0; i < b.N; i++ {
+		ob.Set(byte(i % 256))
+	}
+}
+
+func BenchmarkTest(b *testing.B) {
+	ob := AllSet
+
+	for i := 0; i < b.N; i++ {
+		ob.Test(byte(i % 256))
+	}
+}
+
+func BenchmarkTest_EmptyBits(b *testing.B) {
+	ob := &OctetBits{}
+
+	for i := 0; i < b.N; i++ {
+		ob.Test(byte(i % 256))
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	a := New([]Interval{{0, 100}, {200, 210}})
+	b := New([]Interval{{50, 150}, {205, 255}})
+
+	tests := []struct {
+		name     string
+		got      OctetBits
+		expected OctetBits
+	}{
+		{"union", a.Union(b), New([]Interval{{0, 150}, {200, 255}})},
+		{"intersect", a.Intersect(b), New([]Interval{{50, 100}, {205, 210}})},
+		{"xor", a.Xor(b), New([]Interval{{0, 49}, {101, 150}, {200, 204}, {211, 255}})},
+		{"not", a.Not(), New([]Interval{{101, 199}, {211, 255}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("got %s, expected %s", tt.got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	if !(OctetBits{}).Empty() {
+		t.Error("zero value should be empty")
+	}
+	if New([]Interval{{200, 200}}).Empty() {
+		t.Error("set with one value should not be empty")
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		min, max  byte
+		ok        bool
+	}{
+		{"empty", []Interval{}, 0, 0, false},
+		{"single value", []Interval{{70, 70}}, 70, 70, true},
+		{"across words", []Interval{{3, 3}, {64, 64}, {190, 192}}, 3, 192, true},
+		{"boundaries", []Interval{{0, 0}, {255, 255}}, 0, 255, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := New(tt.intervals)
+			if v, ok := ob.Min(); v != tt.min || ok != tt.ok {
+				t.Errorf("Min() = %d, %v, expected %d, %v", v, ok, tt.min, tt.ok)
+			}
+			if v, ok := ob.Max(); v != tt.max || ok != tt.ok {
+				t.Errorf("Max() = %d, %v, expected %d, %v", v, ok, tt.max, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNextSetPrevSet(t *testing.T) {
+	ob := New([]Interval{{10, 10}, {63, 64}, {128, 128}, {250, 250}})
+
+	next := []struct {
+		from, expected byte
+		ok             bool
+	}{
+		{0, 10, true},
+		{10, 10, true},
+		{11, 63, true},
+		{64, 64, true},
+		{65, 128, true},
+		{129, 250, true},
+		{251, 0, false},
+		{255, 0, false},
+	}
+	for _, tc := range next {
+		if v, ok := ob.NextSet(tc.from); v != tc.expected || ok != tc.ok {
+			t.Errorf("NextSet(%d) = %d, %v, expected %d, %v", tc.from, v, ok, tc.expected, tc.ok)
+		}
+	}
+
+	prev := []struct {
+		from, expected byte
+		ok             bool
+	}{
+		{255, 250, true},
+		{250, 250, true},
+		{249, 128, true},
+		{127, 64, true},
+		{63, 63, true},
+		{62, 10, true},
+		{9, 0, false},
+		{0, 0, false},
+	}
+	for _, tc := range prev {
+		if v, ok := ob.PrevSet(tc.from); v != tc.expected || ok != tc.ok {
+			t.Errorf("PrevSet(%d) = %d, %v, expected %d, %v", tc.from, v, ok, tc.expected, tc.ok)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	values := []byte{0, 1, 63, 64, 127, 128, 200, 255}
+
+	ob := OctetBits{}
+	for _, v := range values {
+		ob.Set(v)
+	}
+
+	var got []byte
+	for v := range ob.All() {
+		got = append(got, v)
+	}
+	if string(got) != string(values) {
+		t.Errorf("All() = %v, expected %v", got, values)
+	}
+
+	// early termination
+	n := 0
+	for range ob.All() {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Errorf("All() yielded %d values before break, expected 3", n)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		expected  string
+	}{
+		{"empty", []Interval{}, ""},
+		{"full", []Interval{{0, 255}}, "*"},
+		{"single", []Interval{{42, 42}}, "42"},
+		{"mixed", []Interval{{1, 5}, {10, 10}, {20, 255}}, "1-5,10,20-255"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.intervals).String(); got != tt.expected {
+				t.Errorf("String() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	ob := New([]Interval{{1, 10}, {20, 30}, {40, 50}, {60, 70}})
+
+	for b.Loop() {
+		ob.Count()
+	}
+}
+
+func BenchmarkIntervals(b *testing.B) {
+	ob := New([]Interval{{1, 10}, {20, 30}, {40, 50}, {60, 70}})
+
+	for b.Loop() {
+		ob.Intervals()
+	}
+}
@@ -0,0 +1,60 @@
+package bitsvector
+
+import "testing"
+
+// naiveNew is the reference bit by bit construction New is checked against.
+func naiveNew(its []Interval) OctetBits {
+	var ob OctetBits
+	for _, it := range its {
+		for i := int(it[0]); i <= int(it[1]); i++ {
+			ob.Set(byte(i))
+		}
+	}
+	return ob
+}
+
+// intervalsFrom turns fuzz input into intervals, two bytes each.
+func intervalsFrom(data []byte) []Interval {
+	its := make([]Interval, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		its = append(its, Interval{data[i], data[i+1]})
+	}
+	return its
+}
+
+func FuzzNew(f *testing.F) {
+	f.Add([]byte{255, 255})
+	f.Add([]byte{0, 255})
+	f.Add([]byte{10, 5})
+	f.Add([]byte{63, 64, 127, 128, 191, 192})
+	f.Add([]byte{1, 10, 5, 20, 200, 255})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		its := intervalsFrom(data)
+
+		got, want := New(its), naiveNew(its)
+		if got != want {
+			t.Fatalf("New(%v) = %x, reference %x", its, got, want)
+		}
+
+		for _, it := range got.Intervals() {
+			if it[0] > it[1] {
+				t.Fatalf("Intervals() returned reversed interval %v", it)
+			}
+		}
+		if New(got.Intervals()) != got {
+			t.Fatalf("Intervals() of %x does not rebuild the same set", got)
+		}
+
+		n := 0
+		for v := range got.All() {
+			if !want.Test(v) {
+				t.Fatalf("All() yielded %d, missing from the reference", v)
+			}
+			n++
+		}
+		if n != got.Count() {
+			t.Fatalf("All() yielded %d values, Count() = %d", n, got.Count())
+		}
+	})
+}
@@ -0,0 +1,239 @@
+package ipdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// csvLayout is the columns of a CSV database, -1 when absent, and whether
+// its first row is a header.
+type csvLayout struct {
+	first, last, network int
+	country, asn, org    int
+	header               bool
+}
+
+// csvHeaders maps the header names of ipinfo and similar CSV files to their
+// column.
+var csvHeaders = map[string]func(c *csvLayout) *int{
+	"start_ip":                       func(c *csvLayout) *int { return &c.first },
+	"ip_from":                        func(c *csvLayout) *int { return &c.first },
+	"end_ip":                         func(c *csvLayout) *int { return &c.last },
+	"ip_to":                          func(c *csvLayout) *int { return &c.last },
+	"network":                        func(c *csvLayout) *int { return &c.network },
+	"cidr":                           func(c *csvLayout) *int { return &c.network },
+	"country":                        func(c *csvLayout) *int { return &c.country },
+	"country_code":                   func(c *csvLayout) *int { return &c.country },
+	"country_iso_code":               func(c *csvLayout) *int { return &c.country },
+	"asn":                            func(c *csvLayout) *int { return &c.asn },
+	"autonomous_system_number":       func(c *csvLayout) *int { return &c.asn },
+	"as_name":                        func(c *csvLayout) *int { return &c.org },
+	"name":                           func(c *csvLayout) *int { return &c.org },
+	"org":                            func(c *csvLayout) *int { return &c.org },
+	"autonomous_system_organization": func(c *csvLayout) *int { return &c.org },
+}
+
+// AddCSV loads a CSV database. Files with a header row, as ipinfo's, name
+// their columns: start_ip and end_ip, or network, then country, asn and
+// as_name, among others. Files without one are read as IP2Location LITE
+// files: the first and last address as integers, then either the country
+// code and name (DB1), or the network, the ASN and its name (ASN).
+//
+// Only the IPv4 networks are loaded: IPv6 rows are skipped, except for
+// IPv4-mapped ones. Unknown countries are written "-" or left empty.
+func (db *DB) AddCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	var cols *csvLayout
+	var b sourceBuilder
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+
+		if cols == nil {
+			cols, err = newCSVLayout(row)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			if cols.header {
+				continue
+			}
+		}
+
+		first, last, ok, err := cols.span(row)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if !ok {
+			continue
+		}
+		rec, err := cols.record(row)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		b.add(first, last, rec)
+	}
+
+	src, err := b.build()
+	if err != nil {
+		return err
+	}
+	db.sources = append(db.sources, src)
+	return nil
+}
+
+// newCSVLayout finds the columns of a CSV database from its first row.
+func newCSVLayout(row []string) (*csvLayout, error) {
+	c := &csvLayout{first: -1, last: -1, network: -1, country: -1, asn: -1, org: -1}
+	if len(row) == 0 {
+		return nil, fmt.Errorf("empty row")
+	}
+
+	if _, _, err := parseCSVAddr(row[0]); err != nil {
+		// not an address: a header row
+		c.header = true
+		for i, name := range row {
+			if col, ok := csvHeaders[strings.ToLower(strings.TrimSpace(name))]; ok && *col(c) < 0 {
+				*col(c) = i
+			}
+		}
+		switch {
+		case c.network < 0 && (c.first < 0 || c.last < 0):
+			return nil, fmt.Errorf("no network columns in header %q", strings.Join(row, ","))
+		case c.country < 0 && c.asn < 0:
+			return nil, fmt.Errorf("no country or asn column in header %q", strings.Join(row, ","))
+		}
+		return c, nil
+	}
+
+	// IP2Location LITE: ip_from, ip_to, then country_code, country_name or
+	// cidr, asn, as
+	if len(row) < 3 {
+		return nil, fmt.Errorf("%d columns, want 3 at least", len(row))
+	}
+	c.first, c.last = 0, 1
+	if _, err := netip.ParsePrefix(row[2]); err == nil && len(row) >= 4 {
+		c.asn = 3
+		if len(row) >= 5 {
+			c.org = 4
+		}
+	} else {
+		c.country = 2
+	}
+	return c, nil
+}
+
+// span returns the first and last address of the network of row, false for
+// IPv6 networks.
+func (c *csvLayout) span(row []string) (uint32, uint32, bool, error) {
+	if c.network >= 0 && c.network < len(row) && row[c.network] != "" {
+		p, err := netip.ParsePrefix(strings.TrimSpace(row[c.network]))
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if !p.Addr().Is4() {
+			return 0, 0, false, nil
+		}
+		first := addrToUint32(p.Masked().Addr())
+		return first, first | uint32(uint64(1)<<(32-p.Bits())-1), true, nil
+	}
+
+	if c.first >= len(row) || c.last >= len(row) {
+		return 0, 0, false, fmt.Errorf("%d columns, want %d at least", len(row), max(c.first, c.last)+1)
+	}
+	first, ok1, err := parseCSVAddr(row[c.first])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	last, ok2, err := parseCSVAddr(row[c.last])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !ok1 || !ok2 {
+		return 0, 0, false, nil
+	}
+	if first > last {
+		return 0, 0, false, fmt.Errorf("range %s-%s starts after its end", uint32ToAddr(first), uint32ToAddr(last))
+	}
+	return first, last, true, nil
+}
+
+func (c *csvLayout) record(row []string) (Record, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var r Record
+	if country := field(c.country); country != "-" {
+		if len(country) != 2 && country != "" {
+			return Record{}, fmt.Errorf("invalid country code %q", country)
+		}
+		r.Country = strings.ToUpper(country)
+	}
+	if asn := field(c.asn); asn != "" && asn != "-" {
+		n, err := parseASN(asn)
+		if err != nil {
+			return Record{}, err
+		}
+		r.ASN = n
+		if org := field(c.org); org != "-" {
+			r.Org = org
+		}
+	}
+	return r, nil
+}
+
+// mappedBase is the first IPv4-mapped IPv6 address, ::ffff:0.0.0.0, as an
+// integer.
+const mappedBase = 0xffff_0000_0000
+
+// parseCSVAddr parses an address written as a dotted quad or as an integer,
+// as IP2Location does. IPv6 addresses, other than IPv4-mapped ones, are
+// reported as not ok.
+func parseCSVAddr(s string) (uint32, bool, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, ".:") {
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return 0, false, err
+		}
+		a = a.Unmap()
+		if !a.Is4() {
+			return 0, false, nil
+		}
+		return addrToUint32(a), true, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// past 2^64, IPv6 addresses are not IPv4-mapped
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid address %q", s)
+	}
+	switch {
+	case n <= 0xffff_ffff:
+		return uint32(n), true, nil
+	case n >= mappedBase && n-mappedBase <= 0xffff_ffff:
+		return uint32(n - mappedBase), true, nil
+	default:
+		return 0, false, nil
+	}
+}
@@ -0,0 +1,305 @@
+// Package ipdata loads offline GeoIP and ASN databases, MaxMind MMDB files or
+// the CSV files of IP2Location and ipinfo, to look up the country and the
+// autonomous system of IPv4 addresses.
+//
+// A DB is an ipexpr.Resolver: patterns parsed with it may hold the attribute
+// atoms country:IT and asn:13335, which are resolved into the networks the
+// database assigns to the country or the autonomous system:
+//
+//	db, err := ipdata.Open("GeoLite2-Country.mmdb", "GeoLite2-ASN.mmdb")
+//	...
+//	e, err := ipexpr.ParseWithOptions("country:IT,asn:13335", ipexpr.ParseOptions{Resolver: db})
+package ipdata
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+// Record is what a database knows about a network.
+type Record struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, in upper case,
+	// or empty if unknown.
+	Country string
+	// ASN is the number of the autonomous system announcing the network, or
+	// 0 if unknown.
+	ASN uint32
+	// Org is the name of the autonomous system.
+	Org string
+}
+
+// DB holds the networks of one or more databases, such as a country database
+// and an ASN one. Lookups and resolutions combine them: every attribute comes
+// from the first database that knows it.
+//
+// A DB must not be modified while it is used.
+type DB struct {
+	sources []*source
+}
+
+// source is the networks of a database as sorted, disjoint spans of
+// addresses, each pointing to its record.
+type source struct {
+	spans   []span
+	records []Record
+}
+
+type span struct {
+	first, last uint32
+	rec         int32
+}
+
+// Open loads the databases at paths, told apart by their content: MMDB files
+// hold the MaxMind metadata marker, anything else is read as CSV.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(data, mmdbMetadataMarker) {
+			err = db.AddMMDB(data)
+		} else {
+			err = db.AddCSV(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return db, nil
+}
+
+// Len returns the number of databases loaded.
+func (db *DB) Len() int {
+	return len(db.sources)
+}
+
+// sourceBuilder collects the networks of a database, sharing the records
+// holding the same attributes.
+type sourceBuilder struct {
+	src source
+	ids map[Record]int32
+}
+
+func (b *sourceBuilder) add(first, last uint32, r Record) {
+	if r == (Record{}) {
+		return
+	}
+	if b.ids == nil {
+		b.ids = make(map[Record]int32)
+	}
+	id, ok := b.ids[r]
+	if !ok {
+		id = int32(len(b.src.records))
+		b.src.records = append(b.src.records, r)
+		b.ids[r] = id
+	}
+	b.src.spans = append(b.src.spans, span{first, last, id})
+}
+
+// build sorts the spans and merges the adjacent ones of the same record.
+// Overlapping networks are an error.
+func (b *sourceBuilder) build() (*source, error) {
+	spans := b.src.spans
+	slices.SortFunc(spans, func(a, b span) int { return cmp.Compare(a.first, b.first) })
+
+	var merged []span
+	for _, s := range spans {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			if s.first <= prev.last {
+				return nil, fmt.Errorf("networks %s and %s overlap", spanRange(*prev), spanRange(s))
+			}
+			if s.rec == prev.rec && s.first == prev.last+1 {
+				prev.last = s.last
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+	b.src.spans = merged
+	return &b.src, nil
+}
+
+func (s *source) lookup(v uint32) (Record, bool) {
+	i, found := slices.BinarySearchFunc(s.spans, v, func(s span, v uint32) int { return cmp.Compare(s.first, v) })
+	if !found {
+		if i == 0 {
+			return Record{}, false
+		}
+		i--
+	}
+	if v > s.spans[i].last {
+		return Record{}, false
+	}
+	return s.records[s.spans[i].rec], true
+}
+
+// Lookup returns what the databases know about addr, false if none holds it.
+// IPv4-mapped IPv6 addresses are unmapped; any other IPv6 address is never
+// found.
+func (db *DB) Lookup(addr netip.Addr) (Record, bool) {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return Record{}, false
+	}
+	v := addrToUint32(addr)
+
+	var rec Record
+	found := false
+	for _, s := range db.sources {
+		r, ok := s.lookup(v)
+		if !ok {
+			continue
+		}
+		found = true
+		if rec.Country == "" {
+			rec.Country = r.Country
+		}
+		if rec.ASN == 0 && r.ASN != 0 {
+			rec.ASN, rec.Org = r.ASN, r.Org
+		}
+	}
+	return rec, found
+}
+
+// Country returns an expression matching the networks of the country with
+// ISO 3166-1 alpha-2 code code, in any case.
+func (db *DB) Country(code string) (*ipexpr.IPExpr, error) {
+	if len(code) != 2 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz") != "" {
+		return nil, fmt.Errorf("invalid country code %q", code)
+	}
+	code = strings.ToUpper(code)
+	return db.match(func(r Record) bool { return r.Country != "" }, func(r Record) bool { return r.Country == code })
+}
+
+// ASN returns an expression matching the networks announced by the
+// autonomous system number asn.
+func (db *DB) ASN(asn uint32) (*ipexpr.IPExpr, error) {
+	return db.match(func(r Record) bool { return r.ASN != 0 }, func(r Record) bool { return r.ASN == asn })
+}
+
+// Resolve resolves the attribute atoms country:CODE and asn:NUMBER, whose
+// number may be written AS13335. It makes DB an ipexpr.Resolver.
+func (db *DB) Resolve(key, value string) (*ipexpr.IPExpr, error) {
+	switch strings.ToLower(key) {
+	case "country":
+		return db.Country(value)
+	case "asn":
+		asn, err := parseASN(value)
+		if err != nil {
+			return nil, err
+		}
+		return db.ASN(asn)
+	default:
+		return nil, fmt.Errorf("unknown attribute %q", key)
+	}
+}
+
+// match returns an expression matching the addresses whose attribute, as
+// Lookup combines the databases, satisfies f. known reports whether a record
+// holds the attribute: the addresses an earlier database knows it of are
+// left to that database.
+func (db *DB) match(known, f func(Record) bool) (*ipexpr.IPExpr, error) {
+	var ranges []ipexpr.Range
+	// claimed are the sorted spans of the earlier databases knowing the
+	// attribute
+	var claimed []span
+	for i, s := range db.sources {
+		var knows, matches []span
+		for _, sp := range s.spans {
+			if r := s.records[sp.rec]; known(r) {
+				knows = append(knows, sp)
+				if f(r) {
+					matches = append(matches, sp)
+				}
+			}
+		}
+		for _, sp := range subtractSpans(matches, claimed) {
+			ranges = append(ranges, spanRange(sp))
+		}
+		if i < len(db.sources)-1 {
+			claimed = unionSpans(claimed, knows)
+		}
+	}
+	return ipexpr.FromRanges(ranges...)
+}
+
+// subtractSpans returns the parts of the sorted, disjoint spans a outside
+// the sorted, disjoint spans b.
+func subtractSpans(a, b []span) []span {
+	var out []span
+	j := 0
+	for _, s := range a {
+		for j < len(b) && b[j].last < s.first {
+			j++
+		}
+		first, covered := s.first, false
+		for k := j; k < len(b) && b[k].first <= s.last; k++ {
+			if b[k].first > first {
+				out = append(out, span{first, b[k].first - 1, s.rec})
+			}
+			if b[k].last >= s.last {
+				covered = true
+				break
+			}
+			first = b[k].last + 1
+		}
+		if !covered {
+			out = append(out, span{first, s.last, s.rec})
+		}
+	}
+	return out
+}
+
+// unionSpans merges the sorted, disjoint spans a and b into sorted, disjoint
+// spans, whose records are meaningless.
+func unionSpans(a, b []span) []span {
+	all := slices.Concat(a, b)
+	slices.SortFunc(all, func(a, b span) int { return cmp.Compare(a.first, b.first) })
+	var out []span
+	for _, s := range all {
+		if n := len(out); n > 0 && s.first <= out[n-1].last {
+			out[n-1].last = max(out[n-1].last, s.last)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// parseASN parses an autonomous system number, with or without the AS
+// prefix.
+func parseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASN %q", s)
+	}
+	return uint32(n), nil
+}
+
+func spanRange(s span) ipexpr.Range {
+	return ipexpr.Range{First: uint32ToAddr(s.first), Last: uint32ToAddr(s.last)}
+}
+
+func addrToUint32(a netip.Addr) uint32 {
+	b := a.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func uint32ToAddr(v uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
@@ -0,0 +1,159 @@
+package ipdata_test
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipdata"
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestAddCSV(t *testing.T) {
+	tests := []struct {
+		files []string
+		addr  string
+		want  ipdata.Record
+		ok    bool
+	}{
+		{[]string{"ipinfo_country_asn.csv"}, "1.0.0.1", ipdata.Record{Country: "AU", ASN: 13335, Org: "Cloudflare, Inc."}, true},
+		{[]string{"ipinfo_country_asn.csv"}, "5.8.4.4", ipdata.Record{Country: "FR"}, true},
+		{[]string{"ipinfo_country_asn.csv"}, "9.9.9.9", ipdata.Record{Country: "CH", ASN: 19281, Org: "Quad9"}, true},
+		{[]string{"ipinfo_country_asn.csv"}, "5.9.0.0", ipdata.Record{}, false},
+		{[]string{"ipinfo_asn.csv"}, "104.23.255.255", ipdata.Record{ASN: 13335, Org: "Cloudflare, Inc."}, true},
+		{[]string{"ip2location_db1.csv"}, "0.1.2.3", ipdata.Record{}, false},
+		{[]string{"ip2location_db1.csv"}, "1.0.2.0", ipdata.Record{Country: "CN"}, true},
+		{[]string{"ip2location_db1.csv"}, "8.8.8.8", ipdata.Record{Country: "US"}, true},
+		{[]string{"ip2location_db1.csv", "ip2location_asn.csv"}, "8.8.8.8", ipdata.Record{Country: "US", ASN: 15169, Org: "Google LLC"}, true},
+		{[]string{"ip2location_asn.csv", "ip2location_db1.csv"}, "1.1.1.1", ipdata.Record{ASN: 13335, Org: "CloudFlare Inc."}, true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.files, "+")+"/"+tt.addr, func(t *testing.T) {
+			db := mustOpen(t, tt.files...)
+			got, ok := db.Lookup(netip.MustParseAddr(tt.addr))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Lookup() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAddCSV_Errors(t *testing.T) {
+	tests := map[string]string{
+		"no network":  "country,asn\nIT,AS1\n",
+		"no country":  "start_ip,end_ip,domain\n1.0.0.0,1.0.0.255,example.com\n",
+		"few columns": "1.0.0.0,1.0.0.255\n",
+		"reversed":    "start_ip,end_ip,country\n1.0.0.255,1.0.0.0,IT\n",
+		"address":     "start_ip,end_ip,country\n1.0.0.0,1.0.0.256,IT\n",
+		"country":     "start_ip,end_ip,country\n1.0.0.0,1.0.0.255,Italy\n",
+		"asn":         "network,asn\n1.0.0.0/24,ASX\n",
+		"prefix":      "network,asn\n1.0.0.0/33,AS1\n",
+		"overlap":     "\"16843008\",\"16843263\",\"1.1.1.0/24\",\"13335\",\"CloudFlare Inc.\"\n\"16843100\",\"16843300\",\"1.1.1.0/24\",\"1\",\"Other\"\n",
+		"quotes":      "start_ip,end_ip,country\n\"1.0.0.0,1.0.0.255,IT\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := (&ipdata.DB{}).AddCSV(strings.NewReader(data)); err == nil {
+				t.Errorf("AddCSV() expected error but got none")
+			}
+		})
+	}
+
+	if _, err := ipdata.Open("testdata/missing.csv"); err == nil {
+		t.Errorf("Open() expected error but got none")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	db := mustOpen(t, "country.mmdb", "asn.mmdb", "ipinfo_country_asn.csv")
+	opts := ipexpr.ParseOptions{Resolver: db}
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"country:IT", "2.16.0.0-2.23.255.255,5.8.0.0-5.8.3.255,5.8.5.0-5.8.7.255"},
+		{"country:it", "2.16.0.0-2.23.255.255,5.8.0.0-5.8.3.255,5.8.5.0-5.8.7.255"},
+		{"country:FR", "5.8.4.* | 45.0.*.*"},
+		{"asn:13335", "1.0.0.* | 1.1.1.* | 104.16-23.*.*"},
+		{"asn:AS20940", "2.16-23.*.*"},
+		{"country:AU, asn:15169", "1.0.0.* | 8.8.8.*"},
+		{"country:IT | 10.*.*.*", "2.16.0.0-2.23.255.255,5.8.0.0-5.8.3.255,5.8.5.0-5.8.7.255,10.0.0.0-10.255.255.255"},
+		{"country:ZZ", "1-0.1-0.1-0.1-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			e, err := ipexpr.ParseWithOptions(tt.pattern, opts)
+			if err != nil {
+				t.Fatalf("ParseWithOptions() failed: %v", err)
+			}
+			want, err := ipexpr.Parse(tt.want)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if !e.Equal(want) {
+				t.Errorf("ParseWithOptions() = %s, want %s", e, want)
+			}
+		})
+	}
+
+	// negated atoms match whatever the databases do not assign
+	e, err := ipexpr.ParseWithOptions("!country:IT", opts)
+	if err != nil {
+		t.Fatalf("ParseWithOptions() failed: %v", err)
+	}
+	for addr, want := range map[string]bool{"2.17.0.1": false, "5.8.4.1": true, "8.8.8.8": true} {
+		if got := e.ContainsAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("!country:IT contains %s = %v, want %v", addr, got, want)
+		}
+	}
+
+	for _, pattern := range []string{"city:Rome", "country:ITA", "country:I1", "asn:x", "asn:4294967296", "country:IT,asn:"} {
+		if _, err := ipexpr.ParseWithOptions(pattern, opts); err == nil {
+			t.Errorf("ParseWithOptions(%q) expected error but got none", pattern)
+		}
+	}
+	if _, err := ipexpr.Parse("country:IT"); err == nil {
+		t.Errorf("Parse() resolved an atom without a resolver")
+	}
+}
+
+func TestResolve_Precedence(t *testing.T) {
+	// resolutions agree with Lookup: every attribute comes from the first
+	// database that knows it
+	db := &ipdata.DB{}
+	for _, data := range []string{
+		"start_ip,end_ip,country\n10.0.1.0,10.0.1.255,IT\n",
+		"network,asn\n10.0.0.0/16,AS1\n",
+		"start_ip,end_ip,country,asn\n10.0.0.0,10.0.255.255,FR,AS2\n",
+	} {
+		if err := db.AddCSV(strings.NewReader(data)); err != nil {
+			t.Fatalf("AddCSV() failed: %v", err)
+		}
+	}
+	if got, _ := db.Lookup(netip.MustParseAddr("10.0.1.1")); got != (ipdata.Record{Country: "IT", ASN: 1}) {
+		t.Fatalf("Lookup() = %+v, want IT and AS1", got)
+	}
+
+	tests := map[string]string{
+		"country:IT": "10.0.1.*",
+		"country:FR": "10.0.0,2-255.*",
+		"asn:1":      "10.0.*.*",
+		"asn:2":      "1-0.1-0.1-0.1-0",
+	}
+	for pattern, want := range tests {
+		t.Run(pattern, func(t *testing.T) {
+			e, err := ipexpr.ParseWithOptions(pattern, ipexpr.ParseOptions{Resolver: db})
+			if err != nil {
+				t.Fatalf("ParseWithOptions() failed: %v", err)
+			}
+			w, err := ipexpr.Parse(want)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if !e.Equal(w) {
+				t.Errorf("ParseWithOptions() = %s, want %s", e, w)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package ipdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// mmdbMetadataMarker precedes the metadata map at the end of MMDB files.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Data types of the MaxMind DB format.
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+// mmdbIntSizes is the largest size of the integer types, in bytes.
+var mmdbIntSizes = map[int]int{mmdbUint16: 2, mmdbUint32: 4, mmdbUint64: 8, mmdbUint128: 16, mmdbInt32: 4}
+
+// maxMMDBDepth bounds the nesting of decoded maps and arrays.
+const maxMMDBDepth = 32
+
+// AddMMDB loads a MaxMind DB file, such as GeoLite2-Country or GeoLite2-ASN,
+// or the MMDB files of ipinfo. Only the IPv4 networks are loaded. The country
+// is read from country.iso_code, registered_country.iso_code or a country
+// string; the autonomous system from autonomous_system_number and
+// autonomous_system_organization, or asn and as_name.
+func (db *DB) AddMMDB(data []byte) error {
+	i := bytes.LastIndex(data, mmdbMetadataMarker)
+	if i < 0 {
+		return fmt.Errorf("not an MMDB file: no metadata")
+	}
+	meta, _, err := (&mmdbDecoder{data: data[i+len(mmdbMetadataMarker):]}).decode(0, 0)
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid metadata: not a map")
+	}
+
+	nodes, ok1 := asUint(m["node_count"])
+	recordSize, ok2 := asUint(m["record_size"])
+	version, ok3 := asUint(m["ip_version"])
+	if !ok1 || !ok2 || !ok3 {
+		return fmt.Errorf("invalid metadata: missing node_count, record_size or ip_version")
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return fmt.Errorf("unsupported record size %d", recordSize)
+	}
+	if version != 4 && version != 6 {
+		return fmt.Errorf("unsupported IP version %d", version)
+	}
+	// the tree and the 16 bytes following it precede the metadata; divided
+	// rather than multiplied, as hostile node counts overflow
+	if uint64(i) < 16 || nodes > (uint64(i)-16)*4/recordSize {
+		return fmt.Errorf("search tree of %d nodes overflows the file", nodes)
+	}
+	treeSize := nodes * recordSize / 4
+
+	t := &mmdbTree{
+		tree:       data[:treeSize],
+		nodes:      int(nodes),
+		recordSize: int(recordSize),
+		dec:        mmdbDecoder{data: data[treeSize+16 : i]},
+		offsets:    make(map[int]Record),
+	}
+	if err := t.load(int(version)); err != nil {
+		return err
+	}
+	src, err := t.b.build()
+	if err != nil {
+		return err
+	}
+	db.sources = append(db.sources, src)
+	return nil
+}
+
+// mmdbTree walks the binary search tree of an MMDB file. Every node holds two
+// records, for the next bit being 0 and 1: a record is either another node,
+// the node count for no data, or an offset in the data section past the node
+// count and the 16 bytes separating the tree from the data.
+type mmdbTree struct {
+	tree       []byte
+	nodes      int
+	recordSize int
+	dec        mmdbDecoder
+	// offsets caches the records decoded at every data offset
+	offsets map[int]Record
+	visited int
+	b       sourceBuilder
+}
+
+func (t *mmdbTree) record(node, bit int) int {
+	switch t.recordSize {
+	case 24:
+		b := t.tree[node*6+bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		b := t.tree[node*7:]
+		if bit == 0 {
+			return int(b[3]&0xf0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0f)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	default:
+		return int(binary.BigEndian.Uint32(t.tree[node*8+bit*4:]))
+	}
+}
+
+// load walks the IPv4 part of the tree: the whole tree of IPv4 databases,
+// the subtree of ::/96 in IPv6 ones.
+func (t *mmdbTree) load(version int) error {
+	r := 0
+	if version == 6 {
+		for range 96 {
+			if r >= t.nodes {
+				break
+			}
+			r = t.record(r, 0)
+		}
+	}
+	return t.walk(r, 0, 0)
+}
+
+// walk adds the networks of record r, standing for the addresses whose
+// first depth bits are the ones of prefix.
+func (t *mmdbTree) walk(r int, prefix uint32, depth int) error {
+	switch {
+	case r < t.nodes:
+		if depth == 32 {
+			return fmt.Errorf("search tree deeper than 32 bits")
+		}
+		// a tree visits every node once at most
+		if t.visited++; t.visited > t.nodes {
+			return fmt.Errorf("search tree has cycles")
+		}
+		if err := t.walk(t.record(r, 0), prefix, depth+1); err != nil {
+			return err
+		}
+		return t.walk(t.record(r, 1), prefix|1<<(31-depth), depth+1)
+	case r == t.nodes:
+		return nil
+	}
+
+	off := r - t.nodes - 16
+	rec, ok := t.offsets[off]
+	if !ok {
+		v, _, err := t.dec.decode(off, 0)
+		if err != nil {
+			return fmt.Errorf("data of %s/%d: %w", uint32ToAddr(prefix), depth, err)
+		}
+		rec = mmdbRecord(v)
+		t.offsets[off] = rec
+	}
+	t.b.add(prefix, prefix|uint32(uint64(1)<<(32-depth)-1), rec)
+	return nil
+}
+
+// mmdbRecord extracts the country and the autonomous system of a data map.
+func mmdbRecord(v any) Record {
+	m, _ := v.(map[string]any)
+	var r Record
+
+	for _, key := range []string{"country", "registered_country", "country_code"} {
+		switch c := m[key].(type) {
+		case map[string]any:
+			r.Country, _ = c["iso_code"].(string)
+		case string:
+			r.Country = c
+		}
+		if r.Country != "" {
+			break
+		}
+	}
+	if len(r.Country) != 2 {
+		r.Country = ""
+	}
+	r.Country = strings.ToUpper(r.Country)
+
+	if n, ok := asUint(m["autonomous_system_number"]); ok && n <= math.MaxUint32 {
+		r.ASN = uint32(n)
+		r.Org, _ = m["autonomous_system_organization"].(string)
+	} else if s, ok := m["asn"].(string); ok {
+		r.ASN, _ = parseASN(s)
+		r.Org, _ = m["as_name"].(string)
+	} else if n, ok := asUint(m["asn"]); ok && n <= math.MaxUint32 {
+		r.ASN = uint32(n)
+		r.Org, _ = m["as_name"].(string)
+	}
+	return r
+}
+
+func asUint(v any) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case int64:
+		return uint64(n), n >= 0
+	case *big.Int:
+		return n.Uint64(), n.IsUint64()
+	default:
+		return 0, false
+	}
+}
+
+// mmdbDecoder decodes the values of a data section, or of the metadata.
+// Pointers are offsets from the start of data.
+type mmdbDecoder struct {
+	data []byte
+	// pointed caches the values pointers point to by offset: they are
+	// decoded once however many pointers share them, as maps of pointers to
+	// maps of pointers would otherwise expand exponentially.
+	pointed map[int]any
+}
+
+// decode returns the value at off and the offset following it.
+func (d *mmdbDecoder) decode(off, depth int) (any, int, error) {
+	if depth > maxMMDBDepth {
+		return nil, 0, fmt.Errorf("values nested deeper than %d", maxMMDBDepth)
+	}
+	b, off, err := d.read(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	typ := int(ctrl >> 5)
+
+	if typ == mmdbPointer {
+		n := int(ctrl>>3&3) + 1
+		b, next, err := d.read(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		vvv := int(ctrl & 7)
+		var p int
+		switch n {
+		case 1:
+			p = vvv<<8 | int(b[0])
+		case 2:
+			p = (vvv<<16 | int(b[0])<<8 | int(b[1])) + 2048
+		case 3:
+			p = (vvv<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+		default:
+			p = int(binary.BigEndian.Uint32(b))
+		}
+		// pointers never point to pointers
+		if p < len(d.data) && d.data[p]>>5 == mmdbPointer {
+			return nil, 0, fmt.Errorf("pointer at %d points to a pointer", off-1)
+		}
+		if v, ok := d.pointed[p]; ok {
+			return v, next, nil
+		}
+		v, _, err := d.decode(p, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if d.pointed == nil {
+			d.pointed = make(map[int]any)
+		}
+		d.pointed[p] = v
+		return v, next, nil
+	}
+
+	if typ == mmdbExtended {
+		if b, off, err = d.read(off, 1); err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + int(b[0])
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, off, err = d.read(off, n); err != nil {
+			return nil, 0, err
+		}
+		switch n {
+		case 1:
+			size = 29 + int(b[0])
+		case 2:
+			size = 285 + (int(b[0])<<8 | int(b[1]))
+		default:
+			size = 65821 + (int(b[0])<<16 | int(b[1])<<8 | int(b[2]))
+		}
+	}
+
+	switch typ {
+	case mmdbString:
+		b, off, err := d.read(off, size)
+		return string(b), off, err
+	case mmdbBytes:
+		b, off, err := d.read(off, size)
+		return bytes.Clone(b), off, err
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+		b, off, err := d.read(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+		b, off, err := d.read(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128, mmdbInt32:
+		if size > mmdbIntSizes[typ] {
+			return nil, 0, fmt.Errorf("integer of type %d has %d bytes", typ, size)
+		}
+		b, off, err := d.read(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ == mmdbUint128 && size > 8 {
+			return new(big.Int).SetBytes(b), off, nil
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if typ == mmdbInt32 {
+			return int64(int32(uint32(n))), off, nil
+		}
+		return n, off, nil
+	case mmdbBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("boolean of value %d", size)
+		}
+		return size == 1, off, nil
+	case mmdbMap:
+		// every entry takes two bytes at least
+		if size > (len(d.data)-off)/2 {
+			return nil, 0, fmt.Errorf("map of %d entries overflows the data", size)
+		}
+		m := make(map[string]any, size)
+		for range size {
+			var k, v any
+			if k, off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			if v, off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, off, nil
+	case mmdbArray:
+		if size > len(d.data)-off {
+			return nil, 0, fmt.Errorf("array of %d elements overflows the data", size)
+		}
+		a := make([]any, 0, size)
+		for range size {
+			var v any
+			if v, off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, off, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+func (d *mmdbDecoder) read(off, n int) ([]byte, int, error) {
+	if off < 0 || n > len(d.data)-off {
+		return nil, 0, fmt.Errorf("value at %d overflows the data", off)
+	}
+	return d.data[off : off+n], off + n, nil
+}
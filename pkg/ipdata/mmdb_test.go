@@ -0,0 +1,459 @@
+package ipdata_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipdata"
+)
+
+var update = flag.Bool("update", false, "rewrite the fixture databases")
+
+// mmdbNetwork is a network of a database built by buildMMDB.
+type mmdbNetwork struct {
+	prefix string
+	data   map[string]any
+}
+
+// buildMMDB writes a MaxMind DB holding networks, later networks nested in
+// earlier ones overriding them. IPv4 networks of IPv6 databases are stored
+// under ::/96. Repeated strings are written as pointers.
+func buildMMDB(ipVersion, recordSize int, dbType string, networks []mmdbNetwork) []byte {
+	const (
+		empty = iota
+		node
+		data
+	)
+	type record struct{ kind, v int }
+	nodes := [][2]record{{}}
+
+	w := &mmdbWriter{strings: make(map[string]int)}
+	for _, n := range networks {
+		p := netip.MustParsePrefix(n.prefix)
+		a := p.Addr().As4()
+		v := binary.BigEndian.Uint32(a[:])
+		skip := 0
+		if ipVersion == 6 {
+			skip = 96
+		}
+		bit := func(i int) int {
+			if i < skip {
+				return 0
+			}
+			return int(v>>(31-(i-skip))) & 1
+		}
+
+		off := len(w.data)
+		w.encode(n.data)
+
+		cur := 0
+		bits := skip + p.Bits()
+		for i := range bits - 1 {
+			r := nodes[cur][bit(i)]
+			if r.kind != node {
+				// split an empty or data record into a node inheriting it
+				nodes = append(nodes, [2]record{r, r})
+				nodes[cur][bit(i)] = record{node, len(nodes) - 1}
+				r = nodes[cur][bit(i)]
+			}
+			cur = r.v
+		}
+		nodes[cur][bit(bits-1)] = record{data, off}
+	}
+
+	var out []byte
+	for _, n := range nodes {
+		var vals [2]uint32
+		for i, r := range n {
+			switch r.kind {
+			case empty:
+				vals[i] = uint32(len(nodes))
+			case node:
+				vals[i] = uint32(r.v)
+			default:
+				vals[i] = uint32(len(nodes) + 16 + r.v)
+			}
+		}
+		switch recordSize {
+		case 24:
+			out = append(out, byte(vals[0]>>16), byte(vals[0]>>8), byte(vals[0]),
+				byte(vals[1]>>16), byte(vals[1]>>8), byte(vals[1]))
+		case 28:
+			out = append(out, byte(vals[0]>>16), byte(vals[0]>>8), byte(vals[0]),
+				byte(vals[0]>>24<<4)|byte(vals[1]>>24),
+				byte(vals[1]>>16), byte(vals[1]>>8), byte(vals[1]))
+		default:
+			out = binary.BigEndian.AppendUint32(out, vals[0])
+			out = binary.BigEndian.AppendUint32(out, vals[1])
+		}
+	}
+	out = append(out, make([]byte, 16)...)
+	out = append(out, w.data...)
+
+	meta := &mmdbWriter{}
+	meta.encode(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1767225600),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "ippy test fixture"},
+		"ip_version":                  uint16(ipVersion),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(recordSize),
+	})
+	out = append(out, "\xab\xcd\xefMaxMind.com"...)
+	return append(out, meta.data...)
+}
+
+// mmdbWriter encodes values in the MaxMind DB data format.
+type mmdbWriter struct {
+	data []byte
+	// strings holds the offset of the strings written so far, to point to
+	// them; nil disables pointers.
+	strings map[string]int
+}
+
+func (w *mmdbWriter) control(typ, size int) {
+	ctrl := byte(typ << 5)
+	var ext []byte
+	if typ > 7 {
+		ctrl, ext = 0, []byte{byte(typ - 7)}
+	}
+	var sz []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		sz = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		sz = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		ctrl |= 31
+		n := size - 65821
+		sz = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	w.data = append(w.data, ctrl)
+	w.data = append(w.data, ext...)
+	w.data = append(w.data, sz...)
+}
+
+func (w *mmdbWriter) uint(typ int, n uint64) {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	w.control(typ, len(b))
+	w.data = append(w.data, b...)
+}
+
+// pointer writes a pointer to the value at offset p.
+func (w *mmdbWriter) pointer(p int) {
+	switch {
+	case p < 2048:
+		w.data = append(w.data, 1<<5|byte(p>>8), byte(p))
+	case p < 2048+1<<19:
+		p -= 2048
+		w.data = append(w.data, 1<<5|1<<3|byte(p>>16), byte(p>>8), byte(p))
+	default:
+		w.data = append(w.data, 1<<5|3<<3)
+		w.data = binary.BigEndian.AppendUint32(w.data, uint32(p))
+	}
+}
+
+func (w *mmdbWriter) encode(v any) {
+	switch v := v.(type) {
+	case string:
+		if p, ok := w.strings[v]; ok {
+			w.pointer(p)
+			return
+		}
+		if w.strings != nil {
+			w.strings[v] = len(w.data)
+		}
+		w.control(2, len(v))
+		w.data = append(w.data, v...)
+	case float64:
+		w.control(3, 8)
+		w.data = binary.BigEndian.AppendUint64(w.data, math.Float64bits(v))
+	case uint16:
+		w.uint(5, uint64(v))
+	case uint32:
+		w.uint(6, uint64(v))
+	case uint64:
+		w.uint(9, v)
+	case int32:
+		w.control(8, 4)
+		w.data = binary.BigEndian.AppendUint32(w.data, uint32(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		w.control(14, size)
+	case map[string]any:
+		w.control(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			w.encode(k)
+			w.encode(v[k])
+		}
+	case []any:
+		w.control(11, len(v))
+		for _, e := range v {
+			w.encode(e)
+		}
+	default:
+		panic("unsupported value")
+	}
+}
+
+func country(code, name string) map[string]any {
+	return map[string]any{"iso_code": code, "names": map[string]any{"en": name}, "geoname_id": uint32(len(name))}
+}
+
+// fixtures are the databases of testdata, shaped as GeoLite2-Country and
+// GeoLite2-ASN ones.
+var fixtures = map[string][]byte{
+	"country.mmdb": buildMMDB(6, 24, "GeoLite2-Country", []mmdbNetwork{
+		{"1.0.0.0/24", map[string]any{"country": country("AU", "Australia"), "registered_country": country("AU", "Australia")}},
+		{"2.16.0.0/13", map[string]any{"country": country("IT", "Italy"), "continent": map[string]any{"code": "EU"}}},
+		{"5.8.0.0/21", map[string]any{"country": country("IT", "Italy"), "is_in_european_union": true}},
+		{"5.8.4.0/24", map[string]any{"country": country("FR", "France")}},
+		{"8.8.8.0/24", map[string]any{"country": country("US", "United States"), "location": map[string]any{"accuracy_radius": uint16(1000), "latitude": 37.751}}},
+		{"45.0.0.0/16", map[string]any{"registered_country": country("FR", "France")}},
+		{"104.16.0.0/13", map[string]any{"country": country("US", "United States")}},
+	}),
+	"asn.mmdb": buildMMDB(4, 28, "GeoLite2-ASN", []mmdbNetwork{
+		{"1.1.1.0/24", map[string]any{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"}},
+		{"2.16.0.0/13", map[string]any{"autonomous_system_number": uint32(20940), "autonomous_system_organization": "Akamai International B.V."}},
+		{"8.8.8.0/24", map[string]any{"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"}},
+		{"104.16.0.0/13", map[string]any{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"}},
+		{"200.0.0.0/8", map[string]any{"autonomous_system_number": uint32(4200000000), "autonomous_system_organization": "Private use"}},
+	}),
+}
+
+// TestFixtures checks that the MMDB files of testdata are the ones buildMMDB
+// writes; run with -update to rewrite them.
+func TestFixtures(t *testing.T) {
+	for name, data := range fixtures {
+		path := filepath.Join("testdata", name)
+		if *update {
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading fixture: %v (run with -update to create it)", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s is stale, run with -update", path)
+		}
+	}
+}
+
+func mustOpen(t *testing.T, names ...string) *ipdata.DB {
+	t.Helper()
+	paths := make([]string, len(names))
+	for i, n := range names {
+		paths[i] = filepath.Join("testdata", n)
+	}
+	db, err := ipdata.Open(paths...)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	return db
+}
+
+func TestAddMMDB(t *testing.T) {
+	db := mustOpen(t, "country.mmdb", "asn.mmdb")
+	tests := []struct {
+		addr string
+		want ipdata.Record
+		ok   bool
+	}{
+		{"1.0.0.7", ipdata.Record{Country: "AU"}, true},
+		{"1.1.1.1", ipdata.Record{ASN: 13335, Org: "CLOUDFLARENET"}, true},
+		{"2.23.255.255", ipdata.Record{Country: "IT", ASN: 20940, Org: "Akamai International B.V."}, true},
+		{"5.8.3.1", ipdata.Record{Country: "IT"}, true},
+		{"5.8.4.1", ipdata.Record{Country: "FR"}, true},
+		{"5.8.5.1", ipdata.Record{Country: "IT"}, true},
+		{"8.8.8.8", ipdata.Record{Country: "US", ASN: 15169, Org: "GOOGLE"}, true},
+		{"45.0.9.9", ipdata.Record{Country: "FR"}, true},
+		{"200.1.2.3", ipdata.Record{ASN: 4200000000, Org: "Private use"}, true},
+		{"::ffff:104.16.0.1", ipdata.Record{Country: "US", ASN: 13335, Org: "CLOUDFLARENET"}, true},
+		{"9.9.9.9", ipdata.Record{}, false},
+		{"2001:db8::1", ipdata.Record{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, ok := db.Lookup(netip.MustParseAddr(tt.addr))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Lookup() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+	if db.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", db.Len())
+	}
+}
+
+func TestAddMMDB_Layouts(t *testing.T) {
+	networks := []mmdbNetwork{
+		{"0.0.0.0/1", map[string]any{"country": "de"}},
+		{"10.0.0.0/8", map[string]any{"country": "NL", "asn": "AS1136", "as_name": "KPN"}},
+		{"10.1.2.3/32", map[string]any{"country": "BE", "asn": uint64(5432)}},
+		{"255.255.255.0/24", map[string]any{"country_code": "JP"}},
+	}
+	tests := []struct {
+		addr string
+		want ipdata.Record
+	}{
+		{"1.2.3.4", ipdata.Record{Country: "DE"}},
+		{"10.0.0.1", ipdata.Record{Country: "NL", ASN: 1136, Org: "KPN"}},
+		{"10.1.2.3", ipdata.Record{Country: "BE", ASN: 5432}},
+		{"10.1.2.4", ipdata.Record{Country: "NL", ASN: 1136, Org: "KPN"}},
+		{"255.255.255.255", ipdata.Record{Country: "JP"}},
+	}
+
+	for _, version := range []int{4, 6} {
+		for _, size := range []int{24, 28, 32} {
+			db := &ipdata.DB{}
+			if err := db.AddMMDB(buildMMDB(version, size, "ipinfo", networks)); err != nil {
+				t.Fatalf("v%d/%d: AddMMDB() failed: %v", version, size, err)
+			}
+			for _, tt := range tests {
+				if got, _ := db.Lookup(netip.MustParseAddr(tt.addr)); got != tt.want {
+					t.Errorf("v%d/%d: Lookup(%s) = %+v, want %+v", version, size, tt.addr, got, tt.want)
+				}
+			}
+			if _, ok := db.Lookup(netip.MustParseAddr("200.0.0.1")); ok {
+				t.Errorf("v%d/%d: Lookup(200.0.0.1) found a record", version, size)
+			}
+		}
+	}
+}
+
+// TestAddMMDB_LongStrings covers the larger size encodings and pointers.
+func TestAddMMDB_LongStrings(t *testing.T) {
+	var networks []mmdbNetwork
+	for i, n := range []int{28, 29, 284, 285, 65820, 65821, 70000} {
+		networks = append(networks, mmdbNetwork{
+			netip.PrefixFrom(netip.AddrFrom4([4]byte{byte(i + 1), 0, 0, 0}), 8).String(),
+			map[string]any{"asn": uint32(i + 1), "as_name": strings.Repeat("x", n), "padding": strings.Repeat("y", 1<<19)},
+		})
+	}
+	// the same strings again, far enough for every pointer size
+	networks = append(networks, mmdbNetwork{"100.0.0.0/8", map[string]any{"asn": uint32(100), "as_name": strings.Repeat("x", 70000)}})
+
+	db := &ipdata.DB{}
+	if err := db.AddMMDB(buildMMDB(4, 32, "test", networks)); err != nil {
+		t.Fatalf("AddMMDB() failed: %v", err)
+	}
+	for i, n := range []int{28, 29, 284, 285, 65820, 65821, 70000} {
+		r, _ := db.Lookup(netip.AddrFrom4([4]byte{byte(i + 1), 2, 3, 4}))
+		if r.ASN != uint32(i+1) || len(r.Org) != n {
+			t.Errorf("record %d: ASN %d, org of %d bytes, want %d", i, r.ASN, len(r.Org), n)
+		}
+	}
+	if r, _ := db.Lookup(netip.MustParseAddr("100.0.0.1")); len(r.Org) != 70000 {
+		t.Errorf("pointed string of %d bytes, want 70000", len(r.Org))
+	}
+}
+
+func TestAddMMDB_SharedPointers(t *testing.T) {
+	// every level is a map of 20 pointers to the map of the level below:
+	// decoding every pointer anew reads 20^8 maps out of a 1 KB file
+	w := &mmdbWriter{strings: make(map[string]int)}
+	prev := len(w.data)
+	w.encode(map[string]any{"leaf": true})
+	for range 8 {
+		off := len(w.data)
+		w.control(7, 20)
+		for k := range 20 {
+			w.encode(fmt.Sprintf("k%d", k))
+			w.pointer(prev)
+		}
+		prev = off
+	}
+	top := len(w.data)
+	w.control(7, 2)
+	w.encode("country_code")
+	w.encode("IT")
+	w.encode("nested")
+	w.pointer(prev)
+
+	// a single node, both halves of the address space pointing to top
+	rec := uint32(1 + 16 + top)
+	data := []byte{byte(rec >> 16), byte(rec >> 8), byte(rec), byte(rec >> 16), byte(rec >> 8), byte(rec)}
+	data = append(data, make([]byte, 16)...)
+	data = append(data, w.data...)
+	data = append(data, "\xab\xcd\xefMaxMind.com"...)
+	meta := &mmdbWriter{}
+	meta.encode(map[string]any{"node_count": uint32(1), "record_size": uint16(24), "ip_version": uint16(4)})
+	data = append(data, meta.data...)
+	if len(data) > 1024 {
+		t.Fatalf("database of %d bytes, want 1 KB at most", len(data))
+	}
+
+	db := &ipdata.DB{}
+	if err := db.AddMMDB(data); err != nil {
+		t.Fatalf("AddMMDB() failed: %v", err)
+	}
+	if r, ok := db.Lookup(netip.MustParseAddr("200.1.2.3")); !ok || r.Country != "IT" {
+		t.Errorf("Lookup() = %+v, %v, want IT", r, ok)
+	}
+}
+
+func TestAddMMDB_Errors(t *testing.T) {
+	valid := fixtures["asn.mmdb"]
+	marker := bytes.LastIndex(valid, []byte("MaxMind.com")) - 3
+
+	cyclic := slices.Clone(buildMMDB(4, 32, "test", []mmdbNetwork{{"10.0.0.0/16", map[string]any{"asn": uint32(1)}}}))
+	// the first node points to itself
+	binary.BigEndian.PutUint32(cyclic[0:], 0)
+	binary.BigEndian.PutUint32(cyclic[4:], 0)
+
+	badPointer := slices.Clone(buildMMDB(4, 24, "test", []mmdbNetwork{{"0.0.0.0/1", map[string]any{"asn": uint32(1)}}}))
+	// the data of the only network is a pointer past the data
+	dataStart := bytes.Index(badPointer, make([]byte, 16)) + 16
+	badPointer[dataStart] = 1<<5 | 7
+
+	// node_count * record_size / 4 wraps around to 0, fitting any file
+	overflow := &mmdbWriter{strings: make(map[string]int)}
+	overflow.data = append(make([]byte, 32), "\xab\xcd\xefMaxMind.com"...)
+	overflow.encode(map[string]any{"node_count": uint64(1 << 62), "record_size": uint16(24), "ip_version": uint16(4)})
+
+	tests := map[string][]byte{
+		"no metadata": valid[:marker],
+		"truncated":   valid[:40],
+		"record size": bytes.Replace(slices.Clone(valid), []byte("record_size\xa1\x1c"), []byte("record_size\xa1\x1d"), 1),
+		"ip version":  bytes.Replace(slices.Clone(valid), []byte("ip_version\xa1\x04"), []byte("ip_version\xa1\x05"), 1),
+		"cycle":       cyclic,
+		"pointer":     badPointer,
+		"node count":  overflow.data,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := (&ipdata.DB{}).AddMMDB(data); err == nil {
+				t.Errorf("AddMMDB() expected error but got none")
+			}
+		})
+	}
+}
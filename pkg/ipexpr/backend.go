@@ -0,0 +1,166 @@
+package ipexpr
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Backend is the compiled representation used to match addresses. The octet
+// sets of an expression are always kept; a backend is an accelerator built
+// from them.
+type Backend int
+
+const (
+	// BackendAuto lets the cost model pick the representation.
+	BackendAuto Backend = iota
+	// BackendBitset tests each octet against its 256-bit set, for every
+	// term of the expression.
+	BackendBitset
+	// BackendRangeTable binary-searches a sorted table of address ranges.
+	BackendRangeTable
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendAuto:
+		return "auto"
+	case BackendBitset:
+		return "bitset"
+	case BackendRangeTable:
+		return "range-table"
+	default:
+		return fmt.Sprintf("Backend(%d)", int(b))
+	}
+}
+
+const (
+	// autoTableRanges is the largest number of ranges for which the cost
+	// model picks the range table. A single range is one subtraction and
+	// one comparison against four bitset probes; from two ranges on the
+	// scan loses to the probes, which stay constant-time.
+	autoTableRanges = 1
+	// inlineRanges is the number of ranges stored in the expression itself,
+	// sparing small tables a pointer chase.
+	inlineRanges = 4
+	// maxTableRanges bounds the table size when the range table is
+	// requested explicitly.
+	maxTableRanges = 1 << 16
+)
+
+// Backend returns the representation currently used for matching.
+func (ie *IPExpr) Backend() Backend {
+	if ie.backend == BackendRangeTable {
+		return BackendRangeTable
+	}
+	return BackendBitset
+}
+
+// SetBackend switches the representation used for matching. BackendAuto
+// applies the cost model, which is also what Parse does. Requesting the range
+// table fails for expressions made of too many ranges.
+func (ie *IPExpr) SetBackend(b Backend) error {
+	switch b {
+	case BackendBitset:
+		ie.backend, ie.table, ie.ninline = BackendBitset, nil, 0
+	case BackendAuto:
+		// the terms of multi-term expressions are tested one by one, so
+		// binary-searching fewer ranges than terms is cheaper
+		limit := autoTableRanges
+		if ie.rest != nil {
+			limit = max(limit, min(len(ie.rest), maxTableRanges))
+		}
+		if !ie.buildTable(limit) {
+			ie.backend = BackendBitset
+		}
+	case BackendRangeTable:
+		if !ie.buildTable(maxTableRanges) {
+			return fmt.Errorf("expression %s has more than %d ranges", ie, maxTableRanges)
+		}
+	default:
+		return fmt.Errorf("unknown backend %s", b)
+	}
+	return nil
+}
+
+// buildTable switches to the range table backend, unless the expression has
+// more than limit ranges.
+func (ie *IPExpr) buildTable(limit int) bool {
+	var table []uint32
+	for r := range ie.Ranges() {
+		if len(table) == 2*limit {
+			return false
+		}
+		table = append(table, addrToUint32(r.First), addrToUint32(r.Last))
+	}
+
+	ie.backend, ie.table, ie.ninline = BackendRangeTable, nil, 0
+	if len(table) <= len(ie.inline) {
+		ie.ninline = uint8(copy(ie.inline[:], table) / 2)
+	} else {
+		ie.table = table
+	}
+	return true
+}
+
+// searchTable reports whether v falls into one of the table ranges. Inline
+// tables are scanned linearly, larger ones binary-searched.
+func (ie *IPExpr) searchTable(v uint32) bool {
+	if ie.table == nil {
+		if ie.ninline == 1 {
+			return v-ie.inline[0] <= ie.inline[1]-ie.inline[0]
+		}
+		for i := range int(ie.ninline) {
+			if v < ie.inline[2*i] {
+				return false
+			}
+			if v <= ie.inline[2*i+1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// find the last range starting at or before v
+	lo, hi := 0, len(ie.table)/2
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if ie.table[2*mid] <= v {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo > 0 && v <= ie.table[2*lo-1]
+}
+
+// parseUint32 parses a dotted-quad address without allocating.
+func parseUint32(s string) (uint32, bool) {
+	var v uint32
+	octet, val, digits := 0, 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == '.' {
+			if digits == 0 || octet > 3 {
+				return 0, false
+			}
+			v = v<<8 | uint32(val)
+			octet, val, digits = octet+1, 0, 0
+			continue
+		}
+
+		c := s[i]
+		// octets have no leading zeros, as in ip.Parse
+		if c < '0' || c > '9' || digits > 0 && val == 0 {
+			return 0, false
+		}
+		val = val*10 + int(c-'0')
+		digits++
+		if val > 255 {
+			return 0, false
+		}
+	}
+	return v, octet == 4
+}
+
+func ipToUint32(b []byte) uint32 {
+	return binary.BigEndian.Uint32(b)
+}
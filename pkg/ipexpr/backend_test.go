@@ -0,0 +1,210 @@
+package ipexpr_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestParse_BackendSelection(t *testing.T) {
+	tests := []struct {
+		expr string
+		want ipexpr.Backend
+	}{
+		{"192.168.1.1", ipexpr.BackendRangeTable},
+		{"10.*.*.*", ipexpr.BackendRangeTable},
+		{"10.0-50.*.*", ipexpr.BackendRangeTable},
+		{"0-127.*.*.*", ipexpr.BackendRangeTable},
+		{"192.168.1.1-5,10", ipexpr.BackendBitset},
+		{"10.0-50.*.1-254", ipexpr.BackendBitset},
+		{"*.*.*.1", ipexpr.BackendBitset},
+		{"192.168.1.5-3", ipexpr.BackendRangeTable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := mustParse(t, tt.expr).Backend(); got != tt.want {
+				t.Errorf("Backend() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPExpr_SetBackend(t *testing.T) {
+	e := mustParse(t, "10.0-50.*.1-254")
+
+	if err := e.SetBackend(ipexpr.BackendRangeTable); err != nil {
+		t.Fatalf("SetBackend(range-table) failed: %v", err)
+	}
+	if e.Backend() != ipexpr.BackendRangeTable {
+		t.Errorf("Backend() = %s, want range-table", e.Backend())
+	}
+	if err := e.SetBackend(ipexpr.BackendBitset); err != nil {
+		t.Fatalf("SetBackend(bitset) failed: %v", err)
+	}
+	if e.Backend() != ipexpr.BackendBitset {
+		t.Errorf("Backend() = %s, want bitset", e.Backend())
+	}
+
+	if err := mustParse(t, "*.*.*.1").SetBackend(ipexpr.BackendRangeTable); err == nil {
+		t.Errorf("SetBackend(range-table) with 16M ranges expected error but got none")
+	}
+	if err := e.SetBackend(ipexpr.Backend(42)); err == nil {
+		t.Errorf("SetBackend(42) expected error but got none")
+	}
+}
+
+func TestBackends_Agree(t *testing.T) {
+	exprs := []string{
+		"10.0.*.*",
+		"10.0.1-3,7.1-254",
+		"10.0.0,255.*",
+		"*.0.1,3,5.1,2",
+		"10.0.5.5",
+		"10.0.200-100.*",
+	}
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for _, s := range exprs {
+		t.Run(s, func(t *testing.T) {
+			bitset, table := mustParse(t, s), mustParse(t, s)
+			if err := bitset.SetBackend(ipexpr.BackendBitset); err != nil {
+				t.Fatalf("SetBackend(bitset) failed: %v", err)
+			}
+			if err := table.SetBackend(ipexpr.BackendRangeTable); err != nil {
+				t.Fatalf("SetBackend(range-table) failed: %v", err)
+			}
+
+			check := func(ip net.IP) {
+				s := ip.String()
+				a, errA := bitset.Matches(s)
+				b, errB := table.Matches(s)
+				if a != b || errA != nil || errB != nil {
+					t.Fatalf("Matches(%s): bitset = %v (%v), range-table = %v (%v)", s, a, errA, b, errB)
+				}
+				if bitset.Contains(ip) != table.Contains(ip) {
+					t.Fatalf("Contains(%s) disagrees between backends", s)
+				}
+			}
+			for x := range 256 {
+				for y := range 256 {
+					check(net.IPv4(10, 0, byte(x), byte(y)))
+				}
+			}
+			for range 10000 {
+				check(net.IPv4(byte(rnd.IntN(256)), byte(rnd.IntN(256)), byte(rnd.IntN(256)), byte(rnd.IntN(256))))
+			}
+		})
+	}
+}
+
+func TestMatches_RangeTableErrors(t *testing.T) {
+	e := mustParse(t, "10.*.*.*")
+	if e.Backend() != ipexpr.BackendRangeTable {
+		t.Fatalf("Backend() = %s, want range-table", e.Backend())
+	}
+
+	for _, ip := range []string{"", "10.0.0", "10.0.0.256", "10.0.0.1.1", "10.0.0.a"} {
+		if _, err := e.Matches(ip); err == nil {
+			t.Errorf("Matches(%q) expected error but got none", ip)
+		}
+	}
+}
+
+// siteRuleSet builds rules sharing their leading octets, as found in the
+// allowlists of a single datacenter, where bitsets need every probe.
+func siteRuleSet(b *testing.B, n int) []*ipexpr.IPExpr {
+	b.Helper()
+	exprs := make([]*ipexpr.IPExpr, 0, n)
+	for i := range n {
+		s := fmt.Sprintf("10.20.%d.%d-%d", i%256, (i/256)*16%256, (i/256)*16%256+15)
+		e, err := ipexpr.Parse(s)
+		if err != nil {
+			b.Fatalf("Parse(%q) failed: %v", s, err)
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs
+}
+
+// ruleSet builds a realistic rule set: per-site /16 to /24 blocks, which are
+// a handful of ranges each, mixed with host lists.
+func ruleSet(b *testing.B, n int) []*ipexpr.IPExpr {
+	b.Helper()
+	exprs := make([]*ipexpr.IPExpr, 0, n)
+	for i := range n {
+		var s string
+		switch i % 4 {
+		case 0:
+			s = fmt.Sprintf("10.%d.*.*", i%256)
+		case 1:
+			s = fmt.Sprintf("172.%d.%d-%d.*", 16+i%16, i%200, i%200+10)
+		case 2:
+			s = fmt.Sprintf("192.168.%d.%d-%d", i%256, i%100, i%100+50)
+		default:
+			s = fmt.Sprintf("100.64.%d.1,5,9-12", i%256)
+		}
+		e, err := ipexpr.Parse(s)
+		if err != nil {
+			b.Fatalf("Parse(%q) failed: %v", s, err)
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs
+}
+
+func benchmarkRuleSet(b *testing.B, exprs []*ipexpr.IPExpr, backend ipexpr.Backend, addrs []string) {
+	for _, e := range exprs {
+		if err := e.SetBackend(backend); err != nil {
+			b.Fatalf("SetBackend() failed: %v", err)
+		}
+	}
+
+	parsed := make([]netip.Addr, len(addrs))
+	for i, a := range addrs {
+		parsed[i] = netip.MustParseAddr(a)
+	}
+
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		a := parsed[i%len(parsed)]
+		for _, e := range exprs {
+			if e.ContainsAddr(a) {
+				break
+			}
+		}
+	}
+}
+
+var (
+	mixedAddrs = []string{"8.8.8.8", "192.168.200.140", "172.31.150.1", "100.64.255.12"}
+	siteAddrs  = []string{"10.20.255.250", "10.20.7.200", "10.21.0.1", "10.20.100.100"}
+)
+
+func BenchmarkRuleSet_Mixed_Bitset(b *testing.B) {
+	benchmarkRuleSet(b, ruleSet(b, 4000), ipexpr.BackendBitset, mixedAddrs)
+}
+
+func BenchmarkRuleSet_Mixed_RangeTable(b *testing.B) {
+	benchmarkRuleSet(b, ruleSet(b, 4000), ipexpr.BackendRangeTable, mixedAddrs)
+}
+
+func BenchmarkRuleSet_Mixed_Auto(b *testing.B) {
+	benchmarkRuleSet(b, ruleSet(b, 4000), ipexpr.BackendAuto, mixedAddrs)
+}
+
+func BenchmarkRuleSet_Site_Bitset(b *testing.B) {
+	benchmarkRuleSet(b, siteRuleSet(b, 4000), ipexpr.BackendBitset, siteAddrs)
+}
+
+func BenchmarkRuleSet_Site_RangeTable(b *testing.B) {
+	benchmarkRuleSet(b, siteRuleSet(b, 4000), ipexpr.BackendRangeTable, siteAddrs)
+}
+
+func BenchmarkRuleSet_Site_Auto(b *testing.B) {
+	benchmarkRuleSet(b, siteRuleSet(b, 4000), ipexpr.BackendAuto, siteAddrs)
+}
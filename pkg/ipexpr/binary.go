@@ -0,0 +1,297 @@
+package ipexpr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"unsafe"
+)
+
+// Binary formats. Every encoding starts with a four byte magic and a uint16
+// version, and carries a CRC-32C checksum in its header. Integers are
+// little-endian.
+const (
+	exprMagic  = "IPXE"
+	tableMagic = "IPXT"
+
+	// exprVersion 2 counts the terms of expressions in a uint32 instead of
+	// a uint16.
+	exprVersion  = 2
+	tableVersion = 1
+
+	// exprHeaderSize is the size of the encoded IPExpr header.
+	exprHeaderSize = 14
+
+	// tableHeaderSize is the size of the encoded Table header, a multiple
+	// of 8 so that the entries following it stay aligned.
+	tableHeaderSize = 32
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ExprBinarySize is the length of the encoding of an IPExpr made of a single
+// term: the magic, the version, the number of further terms (uint32), the
+// checksum of the terms and the four 32 byte octet sets of every term.
+// Every further term adds ExprTermSize bytes.
+const ExprBinarySize = exprHeaderSize + ExprTermSize
+
+// ExprTermSize is the length of the encoding of a term: four octet sets.
+const ExprTermSize = 4 * 32
+
+// MarshalBinary encodes the expression in ExprBinarySize bytes, plus
+// ExprTermSize bytes for every term after the first one. The matching backend
+// is not encoded: UnmarshalBinary applies the cost model again.
+func (ie *IPExpr) MarshalBinary() ([]byte, error) {
+	return ie.AppendBinary(make([]byte, 0, ExprBinarySize+len(ie.rest)*ExprTermSize))
+}
+
+// AppendBinary appends the encoding of MarshalBinary to b.
+func (ie *IPExpr) AppendBinary(b []byte) ([]byte, error) {
+	if uint64(len(ie.rest)) > math.MaxUint32 {
+		return nil, fmt.Errorf("expression of %d terms, more than %d", 1+len(ie.rest), uint64(1+math.MaxUint32))
+	}
+	start := len(b)
+	b = append(b, exprMagic...)
+	b = binary.LittleEndian.AppendUint16(b, exprVersion)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(ie.rest)))
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = appendOctets(b, ie.octets)
+	for _, t := range ie.rest {
+		b = appendOctets(b, t)
+	}
+
+	sum := crc32.Checksum(b[start+exprHeaderSize:], castagnoli)
+	binary.LittleEndian.PutUint32(b[start+10:], sum)
+	return b, nil
+}
+
+// ExprBinaryLen returns the length of the expression encoding data starts
+// with, read from its header.
+func ExprBinaryLen(data []byte) (int, error) {
+	if len(data) < exprHeaderSize {
+		return 0, fmt.Errorf("invalid expression encoding: %d bytes, shorter than the header", len(data))
+	}
+	n := uint64(binary.LittleEndian.Uint32(data[6:]))
+	if n > (math.MaxInt-ExprBinarySize)/ExprTermSize {
+		return 0, fmt.Errorf("invalid expression encoding: %d terms", 1+n)
+	}
+	return ExprBinarySize + int(n)*ExprTermSize, nil
+}
+
+// UnmarshalBinary decodes an expression encoded by MarshalBinary. The
+// checksum guards against corruption; encodings whose terms overlap are
+// rejected in O(n log n) of their n terms.
+func (ie *IPExpr) UnmarshalBinary(data []byte) error {
+	n, err := ExprBinaryLen(data)
+	if err != nil {
+		return err
+	}
+	if len(data) != n {
+		return fmt.Errorf("invalid expression encoding: %d bytes, want %d", len(data), n)
+	}
+	if string(data[:4]) != exprMagic {
+		return fmt.Errorf("invalid expression encoding: bad magic %q", data[:4])
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != exprVersion {
+		return fmt.Errorf("unsupported expression encoding version %d", v)
+	}
+	if sum := crc32.Checksum(data[exprHeaderSize:], castagnoli); sum != binary.LittleEndian.Uint32(data[10:]) {
+		return fmt.Errorf("invalid expression encoding: checksum mismatch")
+	}
+
+	e := &IPExpr{octets: decodeOctets(data[exprHeaderSize:])}
+	if len(data) > ExprBinarySize && termCount(e.octets) == 0 {
+		return fmt.Errorf("invalid expression encoding: empty term")
+	}
+	if len(data) > ExprBinarySize {
+		e.rest = make([]term, 0, (len(data)-ExprBinarySize)/ExprTermSize)
+	}
+	for off := ExprBinarySize; off < len(data); off += ExprTermSize {
+		t := decodeOctets(data[off:])
+		if termCount(t) == 0 {
+			return fmt.Errorf("invalid expression encoding: empty term")
+		}
+		e.rest = append(e.rest, t)
+	}
+	if e.rest != nil && termsOverlap(e.terms()) {
+		return fmt.Errorf("invalid expression encoding: overlapping terms")
+	}
+	_ = e.SetBackend(BackendAuto)
+	*ie = *e
+	return nil
+}
+
+// appendOctets appends the four octet sets of a term to b.
+func appendOctets(b []byte, t term) []byte {
+	for _, o := range t {
+		for _, w := range o {
+			b = binary.LittleEndian.AppendUint64(b, w)
+		}
+	}
+	return b
+}
+
+// decodeOctets decodes the four octet sets written by appendOctets.
+func decodeOctets(data []byte) term {
+	var t term
+	for i := range t {
+		for w := range t[i] {
+			t[i][w] = binary.LittleEndian.Uint64(data[32*i+8*w:])
+		}
+	}
+	return t
+}
+
+// MarshalBinary encodes the table as a 32 byte header followed by its
+// entries, stored as they are in memory so that LoadTable can use them in
+// place.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	b := make([]byte, tableHeaderSize, tableHeaderSize+t.MemoryUsage())
+	copy(b, tableMagic)
+	binary.LittleEndian.PutUint16(b[4:], tableVersion)
+	b[6] = byte(t.layout)
+	binary.LittleEndian.PutUint32(b[12:], uint32(t.n))
+	binary.LittleEndian.PutUint32(b[16:], uint32(len(t.root)))
+	binary.LittleEndian.PutUint32(b[20:], uint32(len(t.mid)))
+	binary.LittleEndian.PutUint32(b[24:], uint32(len(t.leaf)))
+	for _, s := range [][]uint32{t.root, t.mid, t.leaf} {
+		for _, e := range s {
+			b = binary.LittleEndian.AppendUint32(b, e)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(b[8:], tableChecksum(b))
+	return b, nil
+}
+
+// UnmarshalBinary decodes a table encoded by MarshalBinary, copying its
+// entries.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	return t.load(data, false)
+}
+
+// LoadTable decodes a table encoded by MarshalBinary without copying its
+// entries when the host is little-endian and data is 4-byte aligned, as is
+// a memory-mapped file. The table then reads data, which must not be modified
+// for as long as the table is in use.
+//
+// The checksum is verified, which reads data once.
+func LoadTable(data []byte) (*Table, error) {
+	t := &Table{}
+	if err := t.load(data, true); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Table) load(data []byte, inPlace bool) error {
+	if len(data) < tableHeaderSize {
+		return fmt.Errorf("invalid table encoding: %d bytes, shorter than the header", len(data))
+	}
+	if string(data[:4]) != tableMagic {
+		return fmt.Errorf("invalid table encoding: bad magic %q", data[:4])
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != tableVersion {
+		return fmt.Errorf("unsupported table encoding version %d", v)
+	}
+
+	layout := Layout(data[6])
+	n := binary.LittleEndian.Uint32(data[12:])
+	lens := [3]uint64{
+		uint64(binary.LittleEndian.Uint32(data[16:])),
+		uint64(binary.LittleEndian.Uint32(data[20:])),
+		uint64(binary.LittleEndian.Uint32(data[24:])),
+	}
+	if got, want := uint64(len(data)), tableHeaderSize+4*(lens[0]+lens[1]+lens[2]); got != want {
+		return fmt.Errorf("invalid table encoding: %d bytes, want %d", got, want)
+	}
+	if tableChecksum(data) != binary.LittleEndian.Uint32(data[8:]) {
+		return fmt.Errorf("invalid table encoding: checksum mismatch")
+	}
+
+	var sections [3][]uint32
+	off := uint64(tableHeaderSize)
+	for i, l := range lens {
+		sections[i] = decodeEntries(data[off:off+4*l], inPlace)
+		off += 4 * l
+	}
+
+	nt := Table{layout: layout, n: int(n), root: sections[0], mid: sections[1], leaf: sections[2]}
+	if err := nt.validate(); err != nil {
+		return fmt.Errorf("invalid table encoding: %w", err)
+	}
+	*t = nt
+	return nil
+}
+
+// validate checks that every lookup stays within the table, so that a
+// corrupted table holding a valid checksum cannot make Lookup panic.
+func (t *Table) validate() error {
+	switch t.layout {
+	case Layout16_8_8:
+		if len(t.root) != 1<<16 {
+			return fmt.Errorf("%s root has %d entries", t.layout, len(t.root))
+		}
+	case LayoutDIR24_8:
+		if len(t.root) != 1<<24 || len(t.mid) != 0 {
+			return fmt.Errorf("%s root has %d entries", t.layout, len(t.root))
+		}
+	default:
+		return fmt.Errorf("unknown layout %s", t.layout)
+	}
+	if len(t.mid)%256 != 0 || len(t.leaf)%256 != 0 {
+		return fmt.Errorf("partial chunk")
+	}
+
+	// entries of the root point to mid chunks in the 16-8-8 layout, to leaf
+	// chunks otherwise
+	check := func(entries []uint32, chunks int, leaf bool) error {
+		for _, e := range entries {
+			switch {
+			case e&tablePtr != 0 && int(e&^tablePtr) >= chunks:
+				return fmt.Errorf("entry points to chunk %d of %d", e&^tablePtr, chunks)
+			case e&tablePtr != 0 && leaf:
+				return fmt.Errorf("leaf chunk holds a pointer")
+			case e&tablePtr == 0 && int(e) > t.n:
+				return fmt.Errorf("entry holds rule %d of %d", e-1, t.n)
+			}
+		}
+		return nil
+	}
+	if t.layout == Layout16_8_8 {
+		if err := check(t.root, len(t.mid)/256, false); err != nil {
+			return err
+		}
+		if err := check(t.mid, len(t.leaf)/256, false); err != nil {
+			return err
+		}
+	} else if err := check(t.root, len(t.leaf)/256, false); err != nil {
+		return err
+	}
+	return check(t.leaf, 0, true)
+}
+
+// tableChecksum covers the whole encoding but the checksum itself.
+func tableChecksum(data []byte) uint32 {
+	sum := crc32.Update(0, castagnoli, data[:8])
+	return crc32.Update(sum, castagnoli, data[12:])
+}
+
+func decodeEntries(b []byte, inPlace bool) []uint32 {
+	n := len(b) / 4
+	if n == 0 {
+		return nil
+	}
+	if inPlace && littleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), n)
+	}
+
+	s := make([]uint32, n)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return s
+}
+
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
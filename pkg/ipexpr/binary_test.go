@@ -0,0 +1,161 @@
+package ipexpr_test
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestIPExpr_MarshalBinary(t *testing.T) {
+	for _, s := range []string{"192.168.1.1", "10.*.1-5,10,200-255.*", "*.*.*.*", "1.2.5-3.4", "0,255.0.255.0-255"} {
+		t.Run(s, func(t *testing.T) {
+			e := mustParse(t, s)
+			data, err := e.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() failed: %v", err)
+			}
+			if len(data) != ipexpr.ExprBinarySize {
+				t.Errorf("len(MarshalBinary()) = %d, want %d", len(data), ipexpr.ExprBinarySize)
+			}
+
+			var got ipexpr.IPExpr
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary() failed: %v", err)
+			}
+			if got.String() != e.String() {
+				t.Errorf("UnmarshalBinary() = %s, want %s", got.String(), e.String())
+			}
+			if got.Backend() != e.Backend() {
+				t.Errorf("Backend() = %s, want %s", got.Backend(), e.Backend())
+			}
+		})
+	}
+}
+
+func TestIPExpr_UnmarshalBinaryErrors(t *testing.T) {
+	data, err := mustParse(t, "10.0.0.*").MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+
+	corrupt := func(i int, b byte) []byte {
+		d := append([]byte(nil), data...)
+		d[i] = b
+		return d
+	}
+	// the term of 10.0.0.* twice, with a valid checksum
+	overlapping := append([]byte(nil), data...)
+	overlapping = append(overlapping, data[len(data)-ipexpr.ExprTermSize:]...)
+	binary.LittleEndian.PutUint32(overlapping[6:], 1)
+	binary.LittleEndian.PutUint32(overlapping[10:], crc32.Checksum(overlapping[14:], crc32.MakeTable(crc32.Castagnoli)))
+
+	tests := map[string][]byte{
+		"empty":       nil,
+		"truncated":   data[:len(data)-1],
+		"magic":       corrupt(0, 'X'),
+		"version":     corrupt(4, 9),
+		"checksum":    corrupt(10, data[10]+1),
+		"terms":       corrupt(6, 1),
+		"octets":      corrupt(100, data[100]^1),
+		"overlapping": overlapping,
+	}
+	for name, d := range tests {
+		t.Run(name, func(t *testing.T) {
+			var e ipexpr.IPExpr
+			if err := e.UnmarshalBinary(d); err == nil {
+				t.Errorf("UnmarshalBinary() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestTable_MarshalBinary(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(5, 6))
+	var exprs []*ipexpr.IPExpr
+	for range 50 {
+		exprs = append(exprs, mustParse(t, randomExpr(rnd)))
+	}
+
+	for _, layout := range []ipexpr.Layout{ipexpr.Layout16_8_8, ipexpr.LayoutDIR24_8} {
+		t.Run(layout.String(), func(t *testing.T) {
+			tbl := mustTable(t, exprs, ipexpr.TableOptions{Layout: layout})
+			data, err := tbl.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() failed: %v", err)
+			}
+
+			var copied ipexpr.Table
+			if err := copied.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary() failed: %v", err)
+			}
+			loaded, err := ipexpr.LoadTable(data)
+			if err != nil {
+				t.Fatalf("LoadTable() failed: %v", err)
+			}
+			// an unaligned copy cannot be used in place
+			unaligned, err := ipexpr.LoadTable(append([]byte{0}, data...)[1:])
+			if err != nil {
+				t.Fatalf("LoadTable(unaligned) failed: %v", err)
+			}
+
+			for _, got := range []*ipexpr.Table{&copied, loaded, unaligned} {
+				if got.Layout() != layout || got.Len() != tbl.Len() || got.MemoryUsage() != tbl.MemoryUsage() {
+					t.Fatalf("decoded table is %s with %d rules in %d bytes, want %s with %d rules in %d bytes",
+						got.Layout(), got.Len(), got.MemoryUsage(), layout, tbl.Len(), tbl.MemoryUsage())
+				}
+				for range 20000 {
+					addr := netip.AddrFrom4([4]byte{byte(rnd.IntN(4)), byte(rnd.IntN(8)), byte(rnd.IntN(256)), byte(rnd.IntN(256))})
+					id, ok := got.Lookup(addr)
+					wantID, wantOK := tbl.Lookup(addr)
+					if id != wantID || ok != wantOK {
+						t.Fatalf("Lookup(%s) = %d, %v, want %d, %v", addr, id, ok, wantID, wantOK)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTable_Errors(t *testing.T) {
+	tbl := mustTable(t, []*ipexpr.IPExpr{mustParse(t, "10.0.0.1,3"), mustParse(t, "10.0.*.*")}, ipexpr.TableOptions{})
+	data, err := tbl.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+
+	// resign recomputes the checksum, to check the validation of the entries
+	resign := func(d []byte) []byte {
+		sum := crc32.Update(0, crc32.MakeTable(crc32.Castagnoli), d[:8])
+		sum = crc32.Update(sum, crc32.MakeTable(crc32.Castagnoli), d[12:])
+		binary.LittleEndian.PutUint32(d[8:], sum)
+		return d
+	}
+	modify := func(f func(d []byte)) []byte {
+		d := append([]byte(nil), data...)
+		f(d)
+		return d
+	}
+	root := func(i int) int { return 32 + 4*i }
+
+	tests := map[string][]byte{
+		"header":    data[:16],
+		"truncated": data[:len(data)-4],
+		"magic":     modify(func(d []byte) { d[0] = 'X' }),
+		"version":   modify(func(d []byte) { d[4] = 2 }),
+		"checksum":  modify(func(d []byte) { d[root(5)] = 1 }),
+		"layout":    resign(modify(func(d []byte) { d[6] = 7 })),
+		"rule":      resign(modify(func(d []byte) { binary.LittleEndian.PutUint32(d[root(5):], 3) })),
+		"pointer":   resign(modify(func(d []byte) { binary.LittleEndian.PutUint32(d[root(5):], 1<<31|9) })),
+	}
+	for name, d := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ipexpr.LoadTable(d); err == nil {
+				t.Errorf("LoadTable() expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package ipexpr
+
+import (
+	"math/bits"
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+// Classification is what the special-purpose registries say about an
+// address. Its slices are shared between the addresses classified alike and
+// must not be modified.
+type Classification struct {
+	// Categories are the categories of the blocks holding the address, in
+	// the order of Categories.
+	Categories []Category
+	// Blocks are the registry entries holding the address, the most
+	// specific one last.
+	Blocks []SpecialBlock
+	// IPv4 reports whether the address is an IPv4 one, which IPv6 addresses
+	// classified alike by the IPv4 registry are not.
+	IPv4 bool
+}
+
+// Special reports whether the address is in a special-purpose block.
+func (c Classification) Special() bool {
+	return len(c.Blocks) > 0
+}
+
+// Is reports whether the address belongs to category cat. Bogon addresses are
+// the ones of every category but Anycast and Broadcast.
+func (c Classification) Is(cat Category) bool {
+	if cat == Bogon {
+		return slices.ContainsFunc(c.Categories, func(c Category) bool { return c != Anycast && c != Broadcast })
+	}
+	return slices.Contains(c.Categories, cat)
+}
+
+// GloballyReachable reports whether the address is globally reachable, as
+// the most specific block holding it says. IPv4 addresses outside
+// special-purpose blocks are; IPv6 addresses, which the IPv4 registry says
+// nothing about, are not.
+func (c Classification) GloballyReachable() bool {
+	if !c.IPv4 {
+		return false
+	}
+	if len(c.Blocks) == 0 {
+		return true
+	}
+	return c.Blocks[len(c.Blocks)-1].GloballyReachable
+}
+
+// classifier tests addresses against the octet sets of every block, only
+// trying the blocks whose first octet matches. The results are computed once
+// for every set of blocks an address can be in.
+type classifier struct {
+	terms   []term
+	byFirst [256]uint32
+	results map[uint32]Classification
+}
+
+var classifierOnce = sync.OnceValue(func() *classifier {
+	c := &classifier{results: make(map[uint32]Classification)}
+	// the set of blocks holding an address only changes at the bounds of
+	// the blocks
+	bounds := []uint32{0}
+	for i, b := range specialBlocks {
+		first := addrToUint32(b.Prefix.Addr())
+		last := first | uint32(uint64(1)<<(32-b.Prefix.Bits())-1)
+		t := rangeTerms(first, last)[0]
+		c.terms = append(c.terms, t)
+		for v := range 256 {
+			if t[0].Test(byte(v)) {
+				c.byFirst[v] |= 1 << i
+			}
+		}
+		bounds = append(bounds, first)
+		if last != ^uint32(0) {
+			bounds = append(bounds, last+1)
+		}
+	}
+
+	for _, v := range bounds {
+		mask := c.mask(v)
+		if _, ok := c.results[mask]; ok {
+			continue
+		}
+		cl := Classification{IPv4: true}
+		for m := mask; m != 0; m &= m - 1 {
+			cl.Blocks = append(cl.Blocks, specialBlocks[bits.TrailingZeros32(m)])
+		}
+		for _, cat := range Categories {
+			if slices.ContainsFunc(cl.Blocks, func(b SpecialBlock) bool { return b.Category == cat }) {
+				cl.Categories = append(cl.Categories, cat)
+			}
+		}
+		c.results[mask] = cl
+	}
+	return c
+})
+
+// mask returns the set of blocks holding v, as bits indexing specialBlocks.
+func (c *classifier) mask(v uint32) uint32 {
+	var mask uint32
+	for m := c.byFirst[byte(v>>24)]; m != 0; m &= m - 1 {
+		i := bits.TrailingZeros32(m)
+		if termTest(c.terms[i], v) {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+// Classify returns the special-purpose categories and registry entries addr
+// belongs to. IPv4-mapped IPv6 addresses are unmapped; any other IPv6 address
+// belongs to none and is not globally reachable. Classify does not allocate.
+func Classify(addr netip.Addr) Classification {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return Classification{}
+	}
+	c := classifierOnce()
+	return c.results[c.mask(addrToUint32(addr))]
+}
@@ -0,0 +1,130 @@
+package ipexpr_test
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		addr       string
+		categories []ipexpr.Category
+		blocks     []string
+		global     bool
+	}{
+		{"8.8.8.8", nil, nil, true},
+		{"10.1.2.3", []ipexpr.Category{ipexpr.Private}, []string{"10.0.0.0/8"}, false},
+		{"100.100.0.1", []ipexpr.Category{ipexpr.Shared}, []string{"100.64.0.0/10"}, false},
+		{"127.0.0.1", []ipexpr.Category{ipexpr.Loopback}, []string{"127.0.0.0/8"}, false},
+		{"169.254.169.254", []ipexpr.Category{ipexpr.LinkLocal}, []string{"169.254.0.0/16"}, false},
+		{"192.0.2.10", []ipexpr.Category{ipexpr.Documentation}, []string{"192.0.2.0/24"}, false},
+		{"198.19.0.1", []ipexpr.Category{ipexpr.Benchmarking}, []string{"198.18.0.0/15"}, false},
+		{"239.1.1.1", []ipexpr.Category{ipexpr.Multicast}, []string{"224.0.0.0/4"}, false},
+		{"250.0.0.1", []ipexpr.Category{ipexpr.Reserved}, []string{"240.0.0.0/4"}, false},
+		{"255.255.255.255", []ipexpr.Category{ipexpr.Reserved, ipexpr.Broadcast}, []string{"240.0.0.0/4", "255.255.255.255/32"}, false},
+		{"0.0.0.0", []ipexpr.Category{ipexpr.ThisNetwork}, []string{"0.0.0.0/8", "0.0.0.0/32"}, false},
+		{"192.0.0.9", []ipexpr.Category{ipexpr.Protocol}, []string{"192.0.0.0/24", "192.0.0.9/32"}, true},
+		{"192.0.0.100", []ipexpr.Category{ipexpr.Protocol}, []string{"192.0.0.0/24"}, false},
+		{"192.175.48.1", []ipexpr.Category{ipexpr.Anycast}, []string{"192.175.48.0/24"}, true},
+		{"::ffff:192.168.1.1", []ipexpr.Category{ipexpr.Private}, []string{"192.168.0.0/16"}, false},
+		{"::1", nil, nil, false},
+		{"2001:4860::8888", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			c := ipexpr.Classify(netip.MustParseAddr(tt.addr))
+			if !slices.Equal(c.Categories, tt.categories) {
+				t.Errorf("Categories = %v, want %v", c.Categories, tt.categories)
+			}
+			var blocks []string
+			for _, b := range c.Blocks {
+				blocks = append(blocks, b.Prefix.String())
+			}
+			if !slices.Equal(blocks, tt.blocks) {
+				t.Errorf("Blocks = %v, want %v", blocks, tt.blocks)
+			}
+			if c.Special() != (len(tt.blocks) > 0) {
+				t.Errorf("Special() = %v", c.Special())
+			}
+			if c.GloballyReachable() != tt.global {
+				t.Errorf("GloballyReachable() = %v, want %v", c.GloballyReachable(), tt.global)
+			}
+		})
+	}
+}
+
+func TestClassify_Is(t *testing.T) {
+	c := ipexpr.Classify(netip.MustParseAddr("255.255.255.255"))
+	if !c.Is(ipexpr.Broadcast) || !c.Is(ipexpr.Reserved) || !c.Is(ipexpr.Bogon) || c.Is(ipexpr.Private) {
+		t.Errorf("255.255.255.255: %v", c.Categories)
+	}
+	c = ipexpr.Classify(netip.MustParseAddr("192.31.196.1"))
+	if !c.Is(ipexpr.Anycast) || c.Is(ipexpr.Bogon) {
+		t.Errorf("192.31.196.1: %v", c.Categories)
+	}
+	c = ipexpr.Classify(netip.MustParseAddr("1.1.1.1"))
+	if c.Is(ipexpr.Bogon) {
+		t.Errorf("1.1.1.1: %v", c.Categories)
+	}
+}
+
+// TestClassify_Expr checks that the categories of an address are the ones
+// whose expression contains it.
+func TestClassify_Expr(t *testing.T) {
+	var addrs []netip.Addr
+	for _, b := range ipexpr.SpecialBlocks() {
+		addrs = append(addrs, b.Prefix.Addr(), b.Prefix.Addr().Prev(), lastAddr(b.Prefix), lastAddr(b.Prefix).Next())
+	}
+	rnd := rand.New(rand.NewPCG(46, 46))
+	for range 10000 {
+		addrs = append(addrs, netip.AddrFrom4(u32Addr(rnd.Uint32())))
+	}
+
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			continue
+		}
+		c := ipexpr.Classify(addr)
+		for _, cat := range append(slices.Clone(ipexpr.Categories), ipexpr.Bogon) {
+			if got, want := c.Is(cat), cat.Expr().ContainsAddr(addr); got != want {
+				t.Errorf("Classify(%s).Is(%s) = %v, want %v", addr, cat, got, want)
+			}
+		}
+		for _, b := range c.Blocks {
+			if !b.Prefix.Contains(addr) {
+				t.Errorf("Classify(%s) holds %s", addr, b.Prefix)
+			}
+		}
+	}
+}
+
+func TestClassify_Allocs(t *testing.T) {
+	addr := netip.MustParseAddr("192.0.0.9")
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = ipexpr.Classify(addr)
+	})
+	if allocs != 0 {
+		t.Errorf("Classify() allocates %v times per run, want 0", allocs)
+	}
+}
+
+func BenchmarkClassify(b *testing.B) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("8.8.8.8"),
+		netip.MustParseAddr("10.1.2.3"),
+		netip.MustParseAddr("192.0.0.9"),
+		netip.MustParseAddr("255.255.255.255"),
+	}
+
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		_ = ipexpr.Classify(addrs[i%len(addrs)])
+		i++
+	}
+}
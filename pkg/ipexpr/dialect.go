@@ -0,0 +1,216 @@
+package ipexpr
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Dialect is a notation for address targets, as used by scanners and
+// configuration files, that ParseAny understands.
+type Dialect int
+
+const (
+	// DialectAuto detects the dialect of every target.
+	DialectAuto Dialect = iota
+	// DialectIppy is the pattern syntax of Parse, e.g. 10.0.1-3,5.*.
+	DialectIppy
+	// DialectWildcard is the subset of patterns whose octets are a number or
+	// *, e.g. 10.0.0.*.
+	DialectWildcard
+	// DialectNmap is the target syntax of nmap: octet ranges and lists whose
+	// bounds may be omitted, 0 and 255 being implied (10.0.0,1,3-7.-), and
+	// CIDR prefixes. Host names are not supported.
+	DialectNmap
+	// DialectMasscan is the range syntax of masscan: addresses, start-end
+	// ranges of addresses (10.0.0.0-10.0.255.255) and CIDR prefixes, in
+	// comma separated lists.
+	DialectMasscan
+	// DialectCIDR is CIDR prefixes and plain addresses.
+	DialectCIDR
+	// DialectRange is start-end ranges of addresses and plain addresses.
+	DialectRange
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectAuto:
+		return "auto"
+	case DialectIppy:
+		return "ippy"
+	case DialectWildcard:
+		return "wildcard"
+	case DialectNmap:
+		return "nmap"
+	case DialectMasscan:
+		return "masscan"
+	case DialectCIDR:
+		return "cidr"
+	case DialectRange:
+		return "range"
+	default:
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// ParseAny parses whitespace separated targets written in dialect d into the
+// list of expressions matching them. With DialectAuto every target is parsed
+// in the dialect its syntax gives away: CIDR prefixes contain a slash, ranges
+// join two full addresses with a dash, comma lists of full addresses are
+// split as masscan does, and everything else is an octet pattern, in the
+// syntax of nmap that extends the one of Parse.
+//
+// Every target becomes an expression. Start-end ranges that are not aligned
+// on octet boundaries, such as 10.0.0.200-10.0.1.50, are expressions made of
+// several terms, as Parse builds for the same range.
+func ParseAny(s string, d Dialect) (List, error) {
+	if d < DialectAuto || d > DialectRange {
+		return nil, fmt.Errorf("unknown dialect %s", d)
+	}
+
+	var l List
+	for _, target := range strings.Fields(s) {
+		items := []string{target}
+		if d == DialectMasscan || d == DialectAuto && isAddrList(target) {
+			items = strings.Split(target, ",")
+		}
+
+		for _, item := range items {
+			e, err := parseTarget(item, d)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", item, err)
+			}
+			l = append(l, e)
+		}
+	}
+	if len(l) == 0 {
+		return nil, fmt.Errorf("no targets in %q", s)
+	}
+	return l, nil
+}
+
+func parseTarget(t string, d Dialect) (*IPExpr, error) {
+	if d == DialectAuto {
+		d = detectDialect(t)
+	}
+
+	switch d {
+	case DialectIppy:
+		return Parse(t)
+	case DialectWildcard:
+		for part := range strings.SplitSeq(t, ".") {
+			if part != "*" && strings.Trim(part, "0123456789") != "" {
+				return nil, fmt.Errorf("octet %q is neither a number nor *", part)
+			}
+		}
+		return Parse(t)
+	case DialectNmap:
+		if strings.Contains(t, "/") {
+			return parseCIDR(t)
+		}
+		return Parse(nmapPattern(t))
+	case DialectMasscan:
+		if strings.Contains(t, "/") {
+			return parseCIDR(t)
+		}
+		return parseAddrRange(t)
+	case DialectCIDR:
+		return parseCIDR(t)
+	default:
+		return parseAddrRange(t)
+	}
+}
+
+func detectDialect(t string) Dialect {
+	switch {
+	case strings.Contains(t, "/"):
+		return DialectCIDR
+	case isAddrRange(t):
+		return DialectRange
+	default:
+		return DialectNmap
+	}
+}
+
+// isAddrRange reports whether t joins two full addresses with a dash, which
+// no octet pattern does: 10.0.0.1-10 is a pattern, 10.0.0.1-10.0.0.9 a range.
+func isAddrRange(t string) bool {
+	first, last, ok := strings.Cut(t, "-")
+	return ok && strings.Count(first, ".") == 3 && strings.Count(last, ".") == 3
+}
+
+// isAddrList reports whether t is a comma separated list of full addresses,
+// ranges or prefixes, rather than a pattern whose octets hold lists: every
+// element of the list contains the dots of an address.
+func isAddrList(t string) bool {
+	if !strings.Contains(t, ",") {
+		return false
+	}
+	for item := range strings.SplitSeq(t, ",") {
+		if strings.Count(item, ".") < 3 {
+			return false
+		}
+	}
+	return true
+}
+
+// nmapPattern rewrites the open ranges of nmap, whose missing bounds are 0
+// and 255, as ranges of Parse: 10.-.0-.-5 becomes 10.0-255.0-255.0-5.
+func nmapPattern(t string) string {
+	octets := strings.Split(t, ".")
+	for i, o := range octets {
+		terms := strings.Split(o, ",")
+		for j, term := range terms {
+			if strings.HasPrefix(term, "-") {
+				term = "0" + term
+			}
+			if strings.HasSuffix(term, "-") {
+				term += "255"
+			}
+			terms[j] = term
+		}
+		octets[i] = strings.Join(terms, ",")
+	}
+	return strings.Join(octets, ".")
+}
+
+// parseCIDR parses a CIDR prefix, or a plain address. As nmap and masscan
+// do, host bits are ignored: 10.0.0.1/24 is 10.0.0.0/24.
+func parseCIDR(t string) (*IPExpr, error) {
+	if !strings.Contains(t, "/") {
+		return parseAddrRange(t)
+	}
+	p, err := netip.ParsePrefix(t)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Addr().Is4() {
+		return nil, fmt.Errorf("not an IPv4 prefix")
+	}
+	first := addrToUint32(p.Masked().Addr())
+	last := first | uint32(uint64(1)<<(32-p.Bits())-1)
+	e := fromSpans([][2]uint32{{first, last}})
+	_ = e.SetBackend(BackendAuto)
+	return e, nil
+}
+
+// parseAddrRange parses a start-end range of addresses, or a plain address.
+// The named ranges and attribute atoms parseRangeList resolves are not
+// addresses.
+func parseAddrRange(t string) (*IPExpr, error) {
+	if i := strings.IndexAny(t, ",@:"); i >= 0 {
+		return nil, fmt.Errorf("unexpected %q in address range", t[i])
+	}
+	return parseRangeList(t, ParseOptions{})
+}
+
+func parseAddr4(s string) (netip.Addr, error) {
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !a.Is4() {
+		return netip.Addr{}, fmt.Errorf("%s is not an IPv4 address", s)
+	}
+	return a, nil
+}
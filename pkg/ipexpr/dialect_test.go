@@ -0,0 +1,142 @@
+package ipexpr_test
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestParseAny(t *testing.T) {
+	tests := []struct {
+		input   string
+		dialect ipexpr.Dialect
+		want    string
+	}{
+		// ippy and wildcard patterns
+		{"10.0.0.*", ipexpr.DialectAuto, "10.0.0.*"},
+		{"10.0.0.*", ipexpr.DialectWildcard, "10.0.0.*"},
+		{"192.168.1.1-5,10", ipexpr.DialectIppy, "192.168.1.1-5,10"},
+		{"192.168.1.1-5,10", ipexpr.DialectAuto, "192.168.1.1-5,10"},
+
+		// examples of the nmap reference guide, Target Specification
+		{"192.168.10.0/24", ipexpr.DialectNmap, "192.168.10.*"},
+		{"192.168.0-255.1-254", ipexpr.DialectNmap, "192.168.*.1-254"},
+		{"0-255.0-255.13.37", ipexpr.DialectNmap, "*.*.13.37"},
+		{"192.168.3-5,7.1", ipexpr.DialectNmap, "192.168.3-5,7.1"},
+		{"10.0.0,1,3-7.-", ipexpr.DialectNmap, "10.0.0-1,3-7.*"},
+		{"192.168.0.0/8 10.0.0,1,3-7.-", ipexpr.DialectAuto, "192.*.*.* 10.0.0-1,3-7.*"},
+		{"10.-100.200-.-", ipexpr.DialectAuto, "10.0-100.200-255.*"},
+		{"192.168.1.130/25", ipexpr.DialectNmap, "192.168.1.128-255"},
+
+		// examples of the masscan documentation
+		{"10.0.0.0/8", ipexpr.DialectMasscan, "10.*.*.*"},
+		{"0.0.0.0/0", ipexpr.DialectMasscan, "*.*.*.*"},
+		{"255.255.255.255", ipexpr.DialectMasscan, "255.255.255.255"},
+		{"10.0.0.0-10.0.255.255", ipexpr.DialectMasscan, "10.0.*.*"},
+		{"10.0.0.1-10.0.0.255", ipexpr.DialectMasscan, "10.0.0.1-255"},
+		{"192.168.0.0/16,10.0.0.1-10.0.0.5", ipexpr.DialectMasscan, "192.168.*.* 10.0.0.1-5"},
+		{"192.168.0.0/16,10.0.0.1-10.0.0.5", ipexpr.DialectAuto, "192.168.*.* 10.0.0.1-5"},
+
+		// ranges across octet boundaries
+		{"10.0.0.200-10.0.1.50", ipexpr.DialectRange, "10.0.0.200-10.0.1.50"},
+		{"10.0.0.5-10.0.3.17 10.0.4.0-10.0.4.9", ipexpr.DialectAuto, "10.0.0.5-10.0.3.17 10.0.4.0-9"},
+		{"10.255.255.255-11.0.0.0", ipexpr.DialectRange, "10.255.255.255-11.0.0.0"},
+		{"10.0.0.0-10.0.0.255,10.0.2.0-10.0.2.255", ipexpr.DialectMasscan, "10.0.0.* 10.0.2.*"},
+
+		// CIDR prefixes
+		{"172.16.0.0/12", ipexpr.DialectCIDR, "172.16-31.*.*"},
+		{"10.0.0.1", ipexpr.DialectCIDR, "10.0.0.1"},
+		{"10.0.0.0/20", ipexpr.DialectAuto, "10.0.0-15.*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String()+"/"+tt.input, func(t *testing.T) {
+			l, err := ipexpr.ParseAny(tt.input, tt.dialect)
+			if err != nil {
+				t.Fatalf("ParseAny() failed: %v", err)
+			}
+			if got := l.String(); got != tt.want {
+				t.Errorf("ParseAny() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAny_Errors(t *testing.T) {
+	tests := []struct {
+		input   string
+		dialect ipexpr.Dialect
+	}{
+		{"", ipexpr.DialectAuto},
+		{"scanme.nmap.org", ipexpr.DialectNmap},
+		{"scanme.nmap.org/28", ipexpr.DialectAuto},
+		{"10.0.0.1-5", ipexpr.DialectWildcard},
+		{"10.0.0.*", ipexpr.DialectCIDR},
+		{"10.0.0.0/33", ipexpr.DialectCIDR},
+		{"2001:db8::/32", ipexpr.DialectCIDR},
+		{"10.0.0.9-10.0.0.1", ipexpr.DialectRange},
+		{"10.0.0.1-5", ipexpr.DialectMasscan},
+		{"10.0.0.-", ipexpr.DialectIppy},
+		{"10.0.0.0/8", ipexpr.Dialect(42)},
+		{"@private", ipexpr.DialectRange},
+		{"@private", ipexpr.DialectMasscan},
+		{"@private", ipexpr.DialectCIDR},
+		{"asn:1", ipexpr.DialectRange},
+		{"10.0.0.1-asn:1", ipexpr.DialectMasscan},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String()+"/"+tt.input, func(t *testing.T) {
+			if _, err := ipexpr.ParseAny(tt.input, tt.dialect); err == nil {
+				t.Errorf("ParseAny() expected error but got none")
+			}
+		})
+	}
+
+	// attribute atoms are a syntax error, not an atom lacking a resolver
+	_, err := ipexpr.ParseAny("asn:1", ipexpr.DialectRange)
+	if err == nil || !strings.Contains(err.Error(), `unexpected ':'`) {
+		t.Errorf("ParseAny(asn:1) = %v, want a syntax error", err)
+	}
+}
+
+func TestParseAny_RangeTerms(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for range 2000 {
+		a, b := rnd.Uint32(), rnd.Uint32()
+		if rnd.IntN(2) == 0 {
+			b = a + rnd.Uint32N(1<<16)
+		}
+		lo, hi := netip.AddrFrom4(u32Addr(min(a, b))), netip.AddrFrom4(u32Addr(max(a, b)))
+
+		l, err := ipexpr.ParseAny(lo.String()+"-"+hi.String(), ipexpr.DialectRange)
+		if err != nil {
+			t.Fatalf("ParseAny(%s-%s) failed: %v", lo, hi, err)
+		}
+		terms := l[0].Terms()
+		if len(l) != 1 || len(terms) > 7 {
+			t.Errorf("ParseAny(%s-%s) = %d expressions of %d terms, want 1 of at most 7", lo, hi, len(l), len(terms))
+		}
+
+		// the terms are disjoint and their union is the range
+		var count uint64
+		for _, e := range terms {
+			count += e.Count()
+		}
+		var ranges []ipexpr.Range
+		for r := range ipexpr.Ranges(terms...) {
+			ranges = append(ranges, r)
+		}
+		want := ipexpr.Range{First: lo, Last: hi}
+		if len(ranges) != 1 || ranges[0] != want || count != want.Count() {
+			t.Fatalf("ParseAny(%s-%s) = %s, covering %v in %d addresses", lo, hi, l, ranges, count)
+		}
+	}
+}
+
+func u32Addr(v uint32) [4]byte {
+	return [4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
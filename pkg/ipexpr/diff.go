@@ -0,0 +1,91 @@
+package ipexpr
+
+// DiffResult holds the addresses two expressions disagree on. Both sets are
+// expressed as disjoint expressions, which can be turned into ranges or CIDR
+// prefixes through Ranges and Prefixes.
+type DiffResult struct {
+	// Added holds the addresses matched by b only.
+	Added []*IPExpr
+	// Removed holds the addresses matched by a only.
+	Removed []*IPExpr
+
+	AddedCount   uint64
+	RemovedCount uint64
+}
+
+// Equal reports whether both expressions match the same addresses.
+func (d DiffResult) Equal() bool {
+	return d.AddedCount == 0 && d.RemovedCount == 0
+}
+
+// Diff compares expression a with its replacement b. It works on the octet
+// sets of their terms directly, so its cost does not depend on the number of
+// addresses involved.
+func Diff(a, b *IPExpr) DiffResult {
+	d := DiffResult{
+		Added:   b.subtract(a),
+		Removed: a.subtract(b),
+	}
+	for _, e := range d.Added {
+		d.AddedCount += e.Count()
+	}
+	for _, e := range d.Removed {
+		d.RemovedCount += e.Count()
+	}
+	return d
+}
+
+// subtract returns the addresses matched by ie but not by o as disjoint
+// expressions, subtracting every term of o from every term of ie.
+func (ie *IPExpr) subtract(o *IPExpr) []*IPExpr {
+	if ie.rest == nil && o.rest == nil {
+		return ie.subtractTerm(o)
+	}
+
+	var out []*IPExpr
+	for _, e := range ie.Terms() {
+		pieces := []*IPExpr{e}
+		for _, u := range o.Terms() {
+			var rest []*IPExpr
+			for _, p := range pieces {
+				rest = append(rest, p.subtractTerm(u)...)
+			}
+			pieces = rest
+		}
+		out = append(out, pieces...)
+	}
+	return out
+}
+
+// subtractTerm returns the addresses matched by the single term ie but not by
+// the single term o as at most four disjoint expressions. The i-th one holds
+// the addresses that agree with o on the first i octets and first differ on
+// octet i.
+func (ie *IPExpr) subtractTerm(o *IPExpr) []*IPExpr {
+	if ie.Count() == 0 {
+		return nil
+	}
+	if !ie.Overlaps(o) {
+		e := *ie
+		return []*IPExpr{&e}
+	}
+
+	var out []*IPExpr
+	for i := range ie.octets {
+		e := &IPExpr{}
+		for k := range ie.octets {
+			switch {
+			case k < i:
+				e.octets[k] = ie.octets[k].Intersect(o.octets[k])
+			case k == i:
+				e.octets[k] = ie.octets[k].Intersect(o.octets[k].Not())
+			default:
+				e.octets[k] = ie.octets[k]
+			}
+		}
+		if !e.octets[i].Empty() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
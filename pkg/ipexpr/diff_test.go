@@ -0,0 +1,141 @@
+package ipexpr_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name: "identical",
+			a:    "10.0.*.1-254",
+			b:    "10.0.*.1-254",
+		},
+		{
+			name:      "review example",
+			a:         "10.0-50.*.1-254",
+			b:         "10.0-60.*.0-254",
+			wantAdded: []string{"10.51-60.*.0-254", "10.0-50.*.0"},
+		},
+		{
+			name:        "disjoint",
+			a:           "10.0.0.*",
+			b:           "10.0.1.*",
+			wantAdded:   []string{"10.0.1.*"},
+			wantRemoved: []string{"10.0.0.*"},
+		},
+		{
+			name:        "both directions",
+			a:           "10.0.1-5.*",
+			b:           "10.0.3-8.0-127",
+			wantAdded:   []string{"10.0.6-8.0-127"},
+			wantRemoved: []string{"10.0.1-2.*", "10.0.3-5.128-255"},
+		},
+		{
+			name:        "comma lists",
+			a:           "10.0.1,3,5.1,2",
+			b:           "10.0.1-5.2",
+			wantAdded:   []string{"10.0.2,4.2"},
+			wantRemoved: []string{"10.0.1,3,5.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := mustParse(t, tt.a), mustParse(t, tt.b)
+			d := ipexpr.Diff(a, b)
+
+			checkPatterns(t, "Added", d.Added, tt.wantAdded)
+			checkPatterns(t, "Removed", d.Removed, tt.wantRemoved)
+			checkDiff(t, a, b, d)
+		})
+	}
+}
+
+func TestDiff_Counts(t *testing.T) {
+	a := mustParse(t, "10.0-50.*.1-254")
+	b := mustParse(t, "10.0-60.*.0-254")
+
+	d := ipexpr.Diff(a, b)
+	if want := uint64(10*256*255 + 51*256); d.AddedCount != want {
+		t.Errorf("AddedCount = %d, want %d", d.AddedCount, want)
+	}
+	if d.RemovedCount != 0 {
+		t.Errorf("RemovedCount = %d, want 0", d.RemovedCount)
+	}
+	if d.Equal() {
+		t.Errorf("Equal() = true, want false")
+	}
+}
+
+// checkDiff compares a diff with a brute-force evaluation of both
+// expressions over 10.0.*.*. Counts are only compared when both expressions
+// fall within that block.
+func checkDiff(t *testing.T, a, b *ipexpr.IPExpr, d ipexpr.DiffResult) {
+	t.Helper()
+
+	var added, removed uint64
+	for x := range 256 {
+		for y := range 256 {
+			ip := net.IPv4(10, 0, byte(x), byte(y))
+			inA, inB := a.Contains(ip), b.Contains(ip)
+			if inB && !inA {
+				added++
+			}
+			if inA && !inB {
+				removed++
+			}
+			if got := containsAny(d.Added, ip); got != (inB && !inA) {
+				t.Fatalf("Added contains %s = %v, want %v", ip, got, inB && !inA)
+			}
+			if got := containsAny(d.Removed, ip); got != (inA && !inB) {
+				t.Fatalf("Removed contains %s = %v, want %v", ip, got, inA && !inB)
+			}
+		}
+	}
+
+	block := mustParse(t, "10.0.*.*")
+	if block.Covers(a) && block.Covers(b) {
+		if d.AddedCount != added || d.RemovedCount != removed {
+			t.Errorf("counts = +%d -%d, want +%d -%d", d.AddedCount, d.RemovedCount, added, removed)
+		}
+	}
+}
+
+func containsAny(exprs []*ipexpr.IPExpr, ip net.IP) bool {
+	for _, e := range exprs {
+		if e.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPatterns(t *testing.T, field string, got []*ipexpr.IPExpr, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", field, got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("%s[%d] = %s, want %s", field, i, got[i], want[i])
+		}
+	}
+}
+
+func mustParse(t testing.TB, expr string) *ipexpr.IPExpr {
+	t.Helper()
+	e, err := ipexpr.Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", expr, err)
+	}
+	return e
+}
@@ -0,0 +1,185 @@
+package ipexpr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strings"
+)
+
+// MarshalText encodes the expression in its canonical form, as String does.
+// It has a value receiver, as MarshalJSON, so that IPExpr fields are encoded
+// too when their struct is not addressable.
+func (ie IPExpr) MarshalText() ([]byte, error) {
+	return []byte(ie.String()), nil
+}
+
+// UnmarshalText parses a pattern into the expression.
+func (ie *IPExpr) UnmarshalText(text []byte) error {
+	e, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*ie = *e
+	return nil
+}
+
+// MarshalJSON encodes the expression as a JSON string holding its canonical
+// form.
+func (ie IPExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ie.String())
+}
+
+// UnmarshalJSON parses a JSON string holding a pattern. Errors are returned
+// as *json.UnmarshalTypeError, which encoding/json completes with the path of
+// the struct field being decoded.
+func (ie *IPExpr) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return &json.UnmarshalTypeError{Value: jsonKind(data), Type: exprType}
+	}
+	if err := ie.UnmarshalText([]byte(s)); err != nil {
+		return &json.UnmarshalTypeError{Value: fmt.Sprintf("pattern %q (%s)", s, err), Type: exprType}
+	}
+	return nil
+}
+
+// Set parses a pattern into the expression, making *IPExpr a flag.Value.
+func (ie *IPExpr) Set(s string) error {
+	return ie.UnmarshalText([]byte(s))
+}
+
+// List is a list of expressions, matching the addresses any of them matches.
+// In JSON and YAML it is either an array of patterns or a single pattern.
+// As a flag.Value, every occurrence of the flag appends a pattern.
+type List []*IPExpr
+
+// ParseList parses every pattern into a List.
+func ParseList(patterns ...string) (List, error) {
+	l := make(List, 0, len(patterns))
+	for _, p := range patterns {
+		e, err := Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		l = append(l, e)
+	}
+	return l, nil
+}
+
+// ContainsAddr reports whether addr matches any expression of the list.
+func (l List) ContainsAddr(addr netip.Addr) bool {
+	for _, e := range l {
+		if e.ContainsAddr(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the canonical forms of the expressions, separated by
+// spaces.
+func (l List) String() string {
+	s := make([]string, len(l))
+	for i, e := range l {
+		s[i] = e.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// Set appends a pattern to the list.
+func (l *List) Set(s string) error {
+	e, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, e)
+	return nil
+}
+
+// UnmarshalJSON parses a JSON array of patterns, or a single pattern string.
+// The first invalid pattern is reported as a *json.UnmarshalTypeError, which
+// encoding/json completes with the path of the struct field being decoded.
+func (l *List) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal(data, &patterns); err != nil {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return &json.UnmarshalTypeError{Value: jsonKind(data), Type: listType}
+		}
+		patterns = []string{s}
+	}
+
+	list, err := parseElements(patterns)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: err.Error(), Type: listType}
+	}
+	*l = list
+	return nil
+}
+
+// UnmarshalYAML parses a YAML sequence of patterns, or a single pattern. It
+// implements the unmarshaler interface of gopkg.in/yaml.v2, which
+// gopkg.in/yaml.v3 supports too.
+func (l *List) UnmarshalYAML(unmarshal func(any) error) error {
+	var patterns []string
+	if err := unmarshal(&patterns); err != nil {
+		var s string
+		if err := unmarshal(&s); err != nil {
+			return fmt.Errorf("expected a pattern or a list of patterns")
+		}
+		patterns = []string{s}
+	}
+
+	list, err := parseElements(patterns)
+	if err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// parseElements is ParseList, with errors describing the invalid element.
+func parseElements(patterns []string) (List, error) {
+	list := make(List, 0, len(patterns))
+	for i, p := range patterns {
+		e, err := Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q at index %d (%s)", p, i, err)
+		}
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+var (
+	exprType = reflect.TypeFor[IPExpr]()
+	listType = reflect.TypeFor[List]()
+)
+
+// jsonKind describes a JSON value the way encoding/json does in its errors.
+func jsonKind(data []byte) string {
+	switch data[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	default:
+		return "number " + string(data)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build go1.27 && goexperiment.jsonv2
+
+package ipexpr
+
+import (
+	"encoding/json"
+	"encoding/json/jsontext"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// UnmarshalJSONFrom is UnmarshalJSON for encoding/json/v2, which also backs
+// encoding/json under the jsonv2 experiment and returns the errors of
+// unmarshal methods without their path. The path is filled in here instead.
+func (ie *IPExpr) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	v, err := dec.ReadValue()
+	if err != nil {
+		return err
+	}
+	return withPath(ie.UnmarshalJSON(v), dec)
+}
+
+// UnmarshalJSONFrom is UnmarshalJSON for encoding/json/v2, see
+// IPExpr.UnmarshalJSONFrom.
+func (l *List) UnmarshalJSONFrom(dec *jsontext.Decoder) error {
+	v, err := dec.ReadValue()
+	if err != nil {
+		return err
+	}
+	return withPath(l.UnmarshalJSON(v), dec)
+}
+
+// withPath sets the field of a type error to the dot-separated path of the
+// value just read, as encoding/json does.
+func withPath(err error, dec *jsontext.Decoder) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field == "" {
+		typeErr.Field = strings.Join(slices.Collect(dec.StackPointer().Tokens()), ".")
+	}
+	return err
+}
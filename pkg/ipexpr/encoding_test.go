@@ -0,0 +1,202 @@
+package ipexpr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+type firewallConfig struct {
+	Name     string `json:"name"`
+	Firewall struct {
+		Admin ipexpr.IPExpr  `json:"admin"`
+		Proxy *ipexpr.IPExpr `json:"proxy"`
+		Allow ipexpr.List    `json:"allow"`
+	} `json:"firewall"`
+}
+
+func TestIPExpr_JSON(t *testing.T) {
+	var cfg firewallConfig
+	data := `{"name": "edge", "firewall": {"admin": "10.0.0.1-5", "proxy": "192.168.1.*", "allow": ["10.*.*.*", "172.16-31.*.*"]}}`
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	fw := cfg.Firewall
+	if fw.Admin.String() != "10.0.0.1-5" || fw.Proxy.String() != "192.168.1.*" {
+		t.Errorf("admin, proxy = %s, %s, want 10.0.0.1-5, 192.168.1.*", fw.Admin.String(), fw.Proxy.String())
+	}
+	if fw.Allow.String() != "10.*.*.* 172.16-31.*.*" {
+		t.Errorf("allow = %s, want 10.*.*.* 172.16-31.*.*", fw.Allow)
+	}
+	if !fw.Allow.ContainsAddr(netip.MustParseAddr("172.20.1.1")) || fw.Allow.ContainsAddr(netip.MustParseAddr("8.8.8.8")) {
+		t.Errorf("allow matches the wrong addresses")
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	want := `{"name":"edge","firewall":{"admin":"10.0.0.1-5","proxy":"192.168.1.*","allow":["10.*.*.*","172.16-31.*.*"]}}`
+	if string(out) != want {
+		t.Errorf("Marshal() = %s, want %s", out, want)
+	}
+}
+
+func TestList_UnmarshalJSONString(t *testing.T) {
+	var cfg firewallConfig
+	if err := json.Unmarshal([]byte(`{"firewall": {"allow": "10.1,2.*.*", "proxy": null}}`), &cfg); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if len(cfg.Firewall.Allow) != 1 || cfg.Firewall.Allow[0].String() != "10.1-2.*.*" {
+		t.Errorf("allow = %s, want 10.1-2.*.*", cfg.Firewall.Allow)
+	}
+	if cfg.Firewall.Proxy != nil {
+		t.Errorf("proxy = %s, want nil", cfg.Firewall.Proxy)
+	}
+}
+
+func TestUnmarshalJSON_Errors(t *testing.T) {
+	tests := []struct {
+		data  string
+		field string
+		msg   string
+	}{
+		{`{"firewall": {"admin": "10.0.0.300"}}`, "firewall.admin", `pattern "10.0.0.300"`},
+		{`{"firewall": {"proxy": "10.0.0"}}`, "firewall.proxy", `pattern "10.0.0"`},
+		{`{"firewall": {"admin": 42}}`, "firewall.admin", "number 42"},
+		{`{"firewall": {"allow": ["10.*.*.*", "10.x.*.*"]}}`, "firewall.allow", `pattern "10.x.*.*" at index 1`},
+		{`{"firewall": {"allow": "1.2.3"}}`, "firewall.allow", `pattern "1.2.3" at index 0`},
+		{`{"firewall": {"allow": {"a": 1}}}`, "firewall.allow", "object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			var cfg firewallConfig
+			err := json.Unmarshal([]byte(tt.data), &cfg)
+
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				t.Fatalf("Unmarshal() error = %v, want *json.UnmarshalTypeError", err)
+			}
+			if typeErr.Field != tt.field {
+				t.Errorf("Field = %q, want %q", typeErr.Field, tt.field)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Unmarshal() error = %v, want it to contain %q", err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestIPExpr_Text(t *testing.T) {
+	e := mustParse(t, "10.0.1,2,3.*")
+	text, err := e.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() failed: %v", err)
+	}
+	if string(text) != "10.0.1-3.*" {
+		t.Errorf("MarshalText() = %s, want 10.0.1-3.*", text)
+	}
+
+	var got ipexpr.IPExpr
+	if err := got.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText() failed: %v", err)
+	}
+	if !got.Equal(e) {
+		t.Errorf("UnmarshalText() = %s, want %s", got.String(), e)
+	}
+	if err := got.UnmarshalText([]byte("10.0.0")); err == nil {
+		t.Errorf("UnmarshalText(10.0.0) expected error but got none")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	var admin ipexpr.IPExpr
+	var allow ipexpr.List
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&admin, "admin", "admin addresses")
+	fs.Var(&allow, "allow", "allowed addresses, repeatable")
+	if err := fs.Parse([]string{"-admin", "10.0.0.1", "-allow", "10.*.*.*", "-allow", "192.168.1.*"}); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if admin.String() != "10.0.0.1" {
+		t.Errorf("admin = %s, want 10.0.0.1", admin.String())
+	}
+	if allow.String() != "10.*.*.* 192.168.1.*" {
+		t.Errorf("allow = %s, want 10.*.*.* 192.168.1.*", allow)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{})
+	fs.Var(&allow, "allow", "allowed addresses, repeatable")
+	if err := fs.Parse([]string{"-allow", "10.0.0.256"}); err == nil {
+		t.Errorf("Parse(-allow 10.0.0.256) expected error but got none")
+	}
+}
+
+// yamlUnmarshal mimics the callback passed by gopkg.in/yaml to
+// UnmarshalYAML, decoding a scalar or a sequence of scalars.
+func yamlUnmarshal(v any) func(any) error {
+	return func(out any) error {
+		switch out := out.(type) {
+		case *string:
+			s, ok := v.(string)
+			if !ok {
+				return errors.New("cannot unmarshal !!seq into string")
+			}
+			*out = s
+		case *[]string:
+			s, ok := v.([]string)
+			if !ok {
+				return errors.New("cannot unmarshal !!str into []string")
+			}
+			*out = s
+		}
+		return nil
+	}
+}
+
+func TestList_UnmarshalYAML(t *testing.T) {
+	var l ipexpr.List
+	if err := l.UnmarshalYAML(yamlUnmarshal([]string{"10.*.*.*", "192.168.1.1"})); err != nil {
+		t.Fatalf("UnmarshalYAML(sequence) failed: %v", err)
+	}
+	if l.String() != "10.*.*.* 192.168.1.1" {
+		t.Errorf("UnmarshalYAML(sequence) = %s, want 10.*.*.* 192.168.1.1", l)
+	}
+
+	if err := l.UnmarshalYAML(yamlUnmarshal("172.16.*.*")); err != nil {
+		t.Fatalf("UnmarshalYAML(scalar) failed: %v", err)
+	}
+	if l.String() != "172.16.*.*" {
+		t.Errorf("UnmarshalYAML(scalar) = %s, want 172.16.*.*", l)
+	}
+
+	err := l.UnmarshalYAML(yamlUnmarshal([]string{"10.*.*.*", "10.0.0"}))
+	if err == nil || !strings.Contains(err.Error(), "index 1") {
+		t.Errorf("UnmarshalYAML(invalid) error = %v, want it to name index 1", err)
+	}
+	if err := l.UnmarshalYAML(yamlUnmarshal(42)); err == nil {
+		t.Errorf("UnmarshalYAML(42) expected error but got none")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	l, err := ipexpr.ParseList("10.*.*.*", "192.168.1.1")
+	if err != nil {
+		t.Fatalf("ParseList() failed: %v", err)
+	}
+	if len(l) != 2 {
+		t.Errorf("len(ParseList()) = %d, want 2", len(l))
+	}
+	if _, err := ipexpr.ParseList("10.*.*.*", "10.0.0"); err == nil {
+		t.Errorf("ParseList() with an invalid pattern expected error but got none")
+	}
+}
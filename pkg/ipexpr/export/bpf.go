@@ -0,0 +1,168 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// Selector picks the addresses of a packet a BPF filter checks.
+type Selector int
+
+const (
+	// Src checks the source address.
+	Src Selector = iota
+	// Dst checks the destination address.
+	Dst
+	// Host checks both addresses, matching if either does.
+	Host
+)
+
+func (s Selector) String() string {
+	switch s {
+	case Src:
+		return "src"
+	case Dst:
+		return "dst"
+	case Host:
+		return "host"
+	default:
+		return fmt.Sprintf("Selector(%d)", int(s))
+	}
+}
+
+// bpfMaxPrefixes is the largest number of CIDR prefixes BPFFilter spells out;
+// beyond it the filter tests the octets of the address instead.
+const bpfMaxPrefixes = 16
+
+// BPFFilter returns a pcap filter expression, as accepted by tcpdump, matching
+// the IPv4 packets whose addresses are matched by any of exprs, e.g.
+//
+//	ip and (src net 10.0.0.0/16 or src host 192.168.1.1)
+//
+// Sets made of a few CIDR prefixes are tested as networks, restricted to IP
+// packets as net and host also match ARP and RARP ones; the others are
+// tested octet by octet on the IP header, e.g. ip[12] = 10 and ip[15] <= 5.
+func BPFFilter(sel Selector, exprs ...*ipexpr.IPExpr) string {
+	prefixes := []string{}
+	for p := range ipexpr.Prefixes(exprs...) {
+		if len(prefixes) == bpfMaxPrefixes {
+			prefixes = nil
+			break
+		}
+		prefixes = append(prefixes, prefixString(p))
+	}
+
+	if prefixes != nil {
+		if len(prefixes) == 0 {
+			return "ip and not ip"
+		}
+		if prefixes[0] == "0.0.0.0/0" {
+			return "ip"
+		}
+
+		dir := sel.String() + " "
+		if sel == Host {
+			dir = ""
+		}
+		terms := make([]string, len(prefixes))
+		for i, p := range prefixes {
+			kind := "net"
+			if !strings.Contains(p, "/") {
+				kind = "host"
+			}
+			terms[i] = dir + kind + " " + p
+		}
+		return "ip and " + bpfOr(terms)
+	}
+
+	var terms []string
+	for _, e := range termsOf(exprs) {
+		switch sel {
+		case Src:
+			terms = append(terms, bpfOctets(e, 12))
+		case Dst:
+			terms = append(terms, bpfOctets(e, 16))
+		default:
+			terms = append(terms, bpfOctets(e, 12), bpfOctets(e, 16))
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	// and and or have the same precedence in pcap filters
+	return "(" + strings.Join(terms, ") or (") + ")"
+}
+
+// termsOf returns the non-empty terms of exprs, which are products of octet
+// sets.
+func termsOf(exprs []*ipexpr.IPExpr) []*ipexpr.IPExpr {
+	var terms []*ipexpr.IPExpr
+	for _, e := range exprs {
+		for _, t := range e.Terms() {
+			if t.Count() > 0 {
+				terms = append(terms, t)
+			}
+		}
+	}
+	return terms
+}
+
+// bpfOctets tests the address at offset off of the IP header octet by octet.
+func bpfOctets(e *ipexpr.IPExpr, off int) string {
+	var terms []string
+	for i, o := range e.Octets() {
+		if o == bitsvector.AllSet {
+			continue
+		}
+		operand := fmt.Sprintf("ip[%d]", off+i)
+
+		var alts []string
+		for _, it := range o.Intervals() {
+			switch {
+			case it[0] == it[1]:
+				alts = append(alts, fmt.Sprintf("%s = %d", operand, it[0]))
+			case it[0] == 0:
+				alts = append(alts, fmt.Sprintf("%s <= %d", operand, it[1]))
+			case it[1] == 255:
+				alts = append(alts, fmt.Sprintf("%s >= %d", operand, it[0]))
+			default:
+				alts = append(alts, fmt.Sprintf("(%s >= %d and %s <= %d)", operand, it[0], operand, it[1]))
+			}
+		}
+		terms = append(terms, bpfOr(alts))
+	}
+	if terms == nil {
+		return "ip"
+	}
+	return strings.Join(terms, " and ")
+}
+
+func bpfOr(alts []string) string {
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return "(" + strings.Join(alts, " or ") + ")"
+}
+
+// WriteBPF renders rules as a pcap filter expression matching the packets
+// allowed by the rules, on their source address (destination address with
+// Options.Destination).
+func WriteBPF(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	allow, deny := resolve(rules)
+
+	sel := Src
+	if opts.Destination {
+		sel = Dst
+	}
+	filter := BPFFilter(sel, allow...)
+	if opts.Default == DefaultAllow {
+		filter = "ip and not (" + BPFFilter(sel, deny...) + ")"
+	}
+	_, err := io.WriteString(w, filter+"\n")
+	return err
+}
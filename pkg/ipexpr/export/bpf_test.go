@@ -0,0 +1,261 @@
+package export_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipexpr/export"
+)
+
+func TestBPFFilter(t *testing.T) {
+	tests := []struct {
+		exprs []string
+		sel   export.Selector
+		want  string
+	}{
+		{[]string{"10.0.*.*"}, export.Src, "ip and src net 10.0.0.0/16"},
+		{[]string{"10.0.*.*", "192.168.1.1"}, export.Dst, "ip and (dst net 10.0.0.0/16 or dst host 192.168.1.1)"},
+		{[]string{"192.168.1.1-5"}, export.Host, "ip and (host 192.168.1.1 or net 192.168.1.2/31 or net 192.168.1.4/31)"},
+		{[]string{"*.*.*.*"}, export.Src, "ip"},
+		{[]string{"1.2.3.5-4"}, export.Src, "ip and not ip"},
+		{[]string{"10.*.*.1-5,9"}, export.Src, "ip[12] = 10 and ((ip[15] >= 1 and ip[15] <= 5) or ip[15] = 9)"},
+		{[]string{"*.*.0-9.200-255"}, export.Dst, "ip[18] <= 9 and ip[19] >= 200"},
+		{
+			[]string{"10.*.*.1", "11.*.*.2"},
+			export.Host,
+			"(ip[12] = 10 and ip[15] = 1) or (ip[16] = 10 and ip[19] = 1) or (ip[12] = 11 and ip[15] = 2) or (ip[16] = 11 and ip[19] = 2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.exprs, "|")+"/"+tt.sel.String(), func(t *testing.T) {
+			exprs := make([]*ipexpr.IPExpr, len(tt.exprs))
+			for i, s := range tt.exprs {
+				exprs[i] = mustParse(t, s)
+			}
+			if got := export.BPFFilter(tt.sel, exprs...); got != tt.want {
+				t.Errorf("BPFFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteBPF(t *testing.T) {
+	rules := readRules(t)
+	for _, def := range []export.DefaultAction{export.DefaultAllow, export.DefaultDeny} {
+		var buf bytes.Buffer
+		if err := export.Write(&buf, export.BPF, rules, export.Options{Default: def}); err != nil {
+			t.Fatalf("Write(bpf) failed: %v", err)
+		}
+		checkGolden(t, "bpf_default_"+def.String(), buf.Bytes())
+	}
+}
+
+// runBPF interprets the subset of classic BPF emitted by BPFProgram, and
+// returns the number of bytes the program accepts.
+func runBPF(t *testing.T, prog []export.Instruction, pkt []byte) uint32 {
+	t.Helper()
+	var a, x uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Op {
+		case 0x00: // ld #k
+			a = ins.K
+		case 0x28: // ldh [k]
+			if int(ins.K)+2 > len(pkt) {
+				return 0
+			}
+			a = uint32(pkt[ins.K])<<8 | uint32(pkt[ins.K+1])
+		case 0x30: // ldb [k]
+			if int(ins.K) >= len(pkt) {
+				return 0
+			}
+			a = uint32(pkt[ins.K])
+		case 0x54: // and #k
+			a &= ins.K
+		case 0x74: // rsh #k
+			a >>= ins.K
+		case 0x7c: // rsh x
+			a >>= x
+		case 0x07: // tax
+			x = a
+		case 0x05: // ja
+			pc += int(ins.K)
+		case 0x15, 0x25, 0x35: // jeq, jgt, jge
+			var cond bool
+			switch ins.Op {
+			case 0x15:
+				cond = a == ins.K
+			case 0x25:
+				cond = a > ins.K
+			default:
+				cond = a >= ins.K
+			}
+			if cond {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case 0x06: // ret #k
+			return ins.K
+		default:
+			t.Fatalf("unsupported instruction %s at %d", ins, pc)
+		}
+	}
+	t.Fatalf("program ran past its end")
+	return 0
+}
+
+// packet builds an IPv4 packet, behind an Ethernet header unless raw.
+func packet(src, dst netip.Addr, raw bool) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	s, d := src.As4(), dst.As4()
+	copy(ip[12:], s[:])
+	copy(ip[16:], d[:])
+	if raw {
+		return ip
+	}
+	eth := make([]byte, 14, 34)
+	eth[12], eth[13] = 0x08, 0x00
+	return append(eth, ip...)
+}
+
+func TestBPFProgram(t *testing.T) {
+	exprSets := [][]string{
+		{"10.0.*.*"},
+		{"10.*.*.1-5,9,100-200,255"},
+		{"*.1,3,5,7.0-63,128-130,250.*", "192.168.1.1"},
+		{"10.1.200.7-10.3.17.250", "0.5.0.0-0.5.128.3"},
+		{"1.2.3.5-4"},
+		{"*.*.*.*"},
+	}
+	rnd := rand.New(rand.NewPCG(7, 8))
+	randAddr := func() netip.Addr {
+		return netip.AddrFrom4([4]byte{byte(rnd.IntN(2) * 10), byte(rnd.IntN(8)), byte(rnd.IntN(256)), byte(rnd.IntN(256))})
+	}
+
+	for _, set := range exprSets {
+		exprs := make([]*ipexpr.IPExpr, len(set))
+		for i, s := range set {
+			exprs[i] = mustParse(t, s)
+		}
+		matches := func(a netip.Addr) bool {
+			for _, e := range exprs {
+				if e.ContainsAddr(a) {
+					return true
+				}
+			}
+			return false
+		}
+
+		for _, sel := range []export.Selector{export.Src, export.Dst, export.Host} {
+			for _, link := range []export.LinkType{export.LinkEthernet, export.LinkRaw} {
+				t.Run(fmt.Sprintf("%s/%s/%d", strings.Join(set, "|"), sel, link), func(t *testing.T) {
+					prog, err := export.BPFProgram(export.BPFOptions{Selector: sel, Link: link}, exprs...)
+					if err != nil {
+						t.Fatalf("BPFProgram() failed: %v", err)
+					}
+
+					for range 5000 {
+						src, dst := randAddr(), randAddr()
+						want := false
+						switch sel {
+						case export.Src:
+							want = matches(src)
+						case export.Dst:
+							want = matches(dst)
+						default:
+							want = matches(src) || matches(dst)
+						}
+						got := runBPF(t, prog, packet(src, dst, link == export.LinkRaw)) != 0
+						if got != want {
+							t.Fatalf("program on %s > %s = %v, want %v", src, dst, got, want)
+						}
+					}
+
+					// not IPv4
+					pkt := packet(randAddr(), randAddr(), link == export.LinkRaw)
+					if link == export.LinkRaw {
+						pkt[0] = 0x60
+					} else {
+						pkt[12], pkt[13] = 0x86, 0xdd
+					}
+					if runBPF(t, prog, pkt) != 0 {
+						t.Errorf("program accepted a non-IPv4 packet")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestBPFProgram_Golden(t *testing.T) {
+	prog, err := export.BPFProgram(export.BPFOptions{Selector: export.Src}, mustParse(t, "10.0-5.*.1-5,9,200-255"))
+	if err != nil {
+		t.Fatalf("BPFProgram() failed: %v", err)
+	}
+
+	var sb strings.Builder
+	for i, ins := range prog {
+		fmt.Fprintf(&sb, "(%03d) %s\n", i, ins)
+	}
+	sb.WriteString("\n" + export.FormatBPF(prog))
+	checkGolden(t, "bpf_program", []byte(sb.String()))
+}
+
+func TestBPFProgram_Errors(t *testing.T) {
+	e := mustParse(t, "10.*.*.*")
+	if _, err := export.BPFProgram(export.BPFOptions{Selector: export.Selector(5)}, e); err == nil {
+		t.Errorf("BPFProgram() with unknown selector expected error but got none")
+	}
+	if _, err := export.BPFProgram(export.BPFOptions{Link: export.LinkType(5)}, e); err == nil {
+		t.Errorf("BPFProgram() with unknown link type expected error but got none")
+	}
+}
+
+func TestBPFProgram_Large(t *testing.T) {
+	// far more instructions than conditional jumps can skip
+	var exprs []*ipexpr.IPExpr
+	for i := range 60 {
+		exprs = append(exprs, mustParse(t, fmt.Sprintf("10.%d.*.1,3,5,7", i)))
+	}
+	for _, link := range []export.LinkType{export.LinkEthernet, export.LinkRaw} {
+		prog, err := export.BPFProgram(export.BPFOptions{Selector: export.Host, Link: link}, exprs...)
+		if err != nil {
+			t.Fatalf("BPFProgram() failed: %v", err)
+		}
+		if len(prog) <= 255 {
+			t.Fatalf("BPFProgram() = %d instructions, want more than 255", len(prog))
+		}
+
+		raw := link == export.LinkRaw
+		tests := map[[2]string]bool{
+			{"192.168.0.1", "10.59.3.7"}:  true,
+			{"10.0.200.1", "192.168.0.1"}: true,
+			{"10.59.3.2", "10.60.3.1"}:    false,
+			{"1.1.1.1", "8.8.8.8"}:        false,
+		}
+		for addrs, want := range tests {
+			pkt := packet(netip.MustParseAddr(addrs[0]), netip.MustParseAddr(addrs[1]), raw)
+			if got := runBPF(t, prog, pkt) != 0; got != want {
+				t.Errorf("program on %s > %s = %v, want %v", addrs[0], addrs[1], got, want)
+			}
+		}
+
+		pkt := packet(netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.1"), raw)
+		if raw {
+			pkt[0] = 0x60
+		} else {
+			pkt[12], pkt[13] = 0x86, 0xdd
+		}
+		if runBPF(t, prog, pkt) != 0 {
+			t.Errorf("program accepted a non-IPv4 packet")
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+// Instruction is a classic BPF instruction, laid out as the sock_filter
+// structure of Linux.
+type Instruction struct {
+	Op uint16
+	Jt uint8
+	Jf uint8
+	K  uint32
+}
+
+// Classic BPF opcodes, from linux/filter.h.
+const (
+	bpfLD   = 0x00
+	bpfALU  = 0x04
+	bpfJMP  = 0x05
+	bpfRET  = 0x06
+	bpfMISC = 0x07
+
+	bpfW = 0x00
+	bpfH = 0x08
+	bpfB = 0x10
+
+	bpfIMM = 0x00
+	bpfABS = 0x20
+
+	bpfAND = 0x50
+	bpfRSH = 0x70
+
+	bpfJA  = 0x00
+	bpfJEQ = 0x10
+	bpfJGT = 0x20
+	bpfJGE = 0x30
+
+	bpfK   = 0x00
+	bpfX   = 0x08
+	bpfTAX = 0x00
+)
+
+// String disassembles the instruction in the syntax of tcpdump -d, with jump
+// targets relative to the next instruction.
+func (ins Instruction) String() string {
+	switch ins.Op {
+	case bpfLD | bpfW | bpfIMM:
+		return fmt.Sprintf("ld #%#x", ins.K)
+	case bpfLD | bpfH | bpfABS:
+		return fmt.Sprintf("ldh [%d]", ins.K)
+	case bpfLD | bpfB | bpfABS:
+		return fmt.Sprintf("ldb [%d]", ins.K)
+	case bpfALU | bpfAND | bpfK:
+		return fmt.Sprintf("and #%#x", ins.K)
+	case bpfALU | bpfRSH | bpfK:
+		return fmt.Sprintf("rsh #%d", ins.K)
+	case bpfALU | bpfRSH | bpfX:
+		return "rsh x"
+	case bpfMISC | bpfTAX:
+		return "tax"
+	case bpfJMP | bpfJA:
+		return fmt.Sprintf("ja +%d", ins.K)
+	case bpfJMP | bpfJEQ | bpfK:
+		return fmt.Sprintf("jeq #%#x, +%d, +%d", ins.K, ins.Jt, ins.Jf)
+	case bpfJMP | bpfJGT | bpfK:
+		return fmt.Sprintf("jgt #%#x, +%d, +%d", ins.K, ins.Jt, ins.Jf)
+	case bpfJMP | bpfJGE | bpfK:
+		return fmt.Sprintf("jge #%#x, +%d, +%d", ins.K, ins.Jt, ins.Jf)
+	case bpfRET | bpfK:
+		return fmt.Sprintf("ret #%d", ins.K)
+	default:
+		return fmt.Sprintf("op %#x jt %d jf %d k %#x", ins.Op, ins.Jt, ins.Jf, ins.K)
+	}
+}
+
+// LinkType is the link-layer header preceding the IP header of the packets
+// a BPF program runs on.
+type LinkType int
+
+const (
+	// LinkEthernet is an Ethernet header, as on DLT_EN10MB captures and
+	// packet sockets.
+	LinkEthernet LinkType = iota
+	// LinkRaw is no header: packets start with the IP header, as on
+	// DLT_RAW captures.
+	LinkRaw
+)
+
+// BPFOptions configures BPFProgram.
+type BPFOptions struct {
+	Selector Selector
+	Link     LinkType
+	// SnapLen is the number of bytes kept from matching packets. It defaults
+	// to 262144, as tcpdump does.
+	SnapLen uint32
+}
+
+// BPFProgram compiles a classic BPF program accepting the IPv4 packets whose
+// addresses are matched by any of exprs. Octets matching a single interval
+// are tested with two comparisons; the others are looked up in their 256-bit
+// set, split in eight 32-bit words.
+func BPFProgram(opts BPFOptions, exprs ...*ipexpr.IPExpr) ([]Instruction, error) {
+	if opts.SnapLen == 0 {
+		opts.SnapLen = 262144
+	}
+
+	// other packets are rejected right away: conditional jumps only skip
+	// 255 instructions, too few to reach the end of the program
+	var a bpfAssembler
+	ip := uint32(0)
+	switch opts.Link {
+	case LinkEthernet:
+		ip = 14
+		// ethertype must be IPv4
+		a.emit(Instruction{Op: bpfLD | bpfH | bpfABS, K: 12})
+		a.jump(bpfJEQ, 0x0800, "ipv4", "")
+	case LinkRaw:
+		// the version nibble must be 4
+		a.emit(Instruction{Op: bpfLD | bpfB | bpfABS, K: 0})
+		a.emit(Instruction{Op: bpfALU | bpfRSH | bpfK, K: 4})
+		a.jump(bpfJEQ, 4, "ipv4", "")
+	default:
+		return nil, fmt.Errorf("unknown link type %d", opts.Link)
+	}
+	a.emit(Instruction{Op: bpfRET | bpfK, K: 0})
+	a.label("ipv4")
+
+	var offsets []uint32
+	switch opts.Selector {
+	case Src:
+		offsets = []uint32{ip + 12}
+	case Dst:
+		offsets = []uint32{ip + 16}
+	case Host:
+		offsets = []uint32{ip + 12, ip + 16}
+	default:
+		return nil, fmt.Errorf("unknown selector %s", opts.Selector)
+	}
+
+	// every block checks one term of the expressions against one address,
+	// falling through to the next block when it does not match
+	block := 0
+	for _, e := range termsOf(exprs) {
+		for _, off := range offsets {
+			next := fmt.Sprintf("block%d", block+1)
+			a.label(fmt.Sprintf("block%d", block))
+			for i, o := range e.Octets() {
+				a.octet(off+uint32(i), o, next, fmt.Sprintf("block%d_octet%d", block, i+1))
+				a.label(fmt.Sprintf("block%d_octet%d", block, i+1))
+			}
+			a.jump(bpfJA, 0, "accept", "")
+			block++
+		}
+	}
+
+	a.label(fmt.Sprintf("block%d", block))
+	a.emit(Instruction{Op: bpfRET | bpfK, K: 0})
+	a.label("accept")
+	a.emit(Instruction{Op: bpfRET | bpfK, K: opts.SnapLen})
+	return a.assemble()
+}
+
+// bpfAssembler lays out instructions whose jumps target labels, resolved
+// into relative offsets once the program is complete.
+type bpfAssembler struct {
+	prog   []Instruction
+	jumps  map[int][2]string
+	labels map[string]int
+	seq    int
+}
+
+func (a *bpfAssembler) emit(ins Instruction) {
+	a.prog = append(a.prog, ins)
+}
+
+// jump emits a jump to labels jt and jf; an empty label is the next
+// instruction. For ja, jt is the target.
+func (a *bpfAssembler) jump(op uint16, k uint32, jt, jf string) {
+	if a.jumps == nil {
+		a.jumps = make(map[int][2]string)
+	}
+	a.jumps[len(a.prog)] = [2]string{jt, jf}
+	a.emit(Instruction{Op: bpfJMP | op | bpfK, K: k})
+}
+
+func (a *bpfAssembler) label(name string) {
+	if a.labels == nil {
+		a.labels = make(map[string]int)
+	}
+	a.labels[name] = len(a.prog)
+}
+
+// local returns a label name unique to the program.
+func (a *bpfAssembler) local() string {
+	a.seq++
+	return fmt.Sprintf("l%d", a.seq)
+}
+
+// octet emits the test of the byte at off against o, jumping to fail if it
+// is not in the set and to ok if it is.
+func (a *bpfAssembler) octet(off uint32, o bitsvector.OctetBits, fail, ok string) {
+	if o == bitsvector.AllSet {
+		return
+	}
+	load := Instruction{Op: bpfLD | bpfB | bpfABS, K: off}
+
+	if its := o.Intervals(); len(its) == 1 {
+		a.emit(load)
+		if its[0][0] > 0 {
+			a.jump(bpfJGE, uint32(its[0][0]), "", fail)
+		}
+		if its[0][1] < 255 {
+			a.jump(bpfJGT, uint32(its[0][1]), fail, ok)
+		}
+		return
+	}
+
+	// X holds the bit of the value in its word, A the index of the word
+	a.emit(load)
+	a.emit(Instruction{Op: bpfALU | bpfAND | bpfK, K: 31})
+	a.emit(Instruction{Op: bpfMISC | bpfTAX})
+	a.emit(load)
+	a.emit(Instruction{Op: bpfALU | bpfRSH | bpfK, K: 5})
+
+	var words [8]uint32
+	var targets [8]string
+	for k := range words {
+		words[k] = uint32(o[k/2] >> (32 * (k % 2)))
+		switch words[k] {
+		case 0:
+			targets[k] = fail
+		case ^uint32(0):
+			targets[k] = ok
+		default:
+			targets[k] = a.local()
+		}
+	}
+	for k := range 7 {
+		a.jump(bpfJEQ, uint32(k), targets[k], "")
+	}
+	a.jump(bpfJA, 0, targets[7], "")
+
+	for k, w := range words {
+		if w == 0 || w == ^uint32(0) {
+			continue
+		}
+		a.label(targets[k])
+		a.emit(Instruction{Op: bpfLD | bpfW | bpfIMM, K: w})
+		a.emit(Instruction{Op: bpfALU | bpfRSH | bpfX})
+		a.emit(Instruction{Op: bpfALU | bpfAND | bpfK, K: 1})
+		a.jump(bpfJEQ, 0, fail, ok)
+	}
+}
+
+func (a *bpfAssembler) assemble() ([]Instruction, error) {
+	resolve := func(pc int, label string) (uint32, error) {
+		if label == "" {
+			return 0, nil
+		}
+		target, ok := a.labels[label]
+		if !ok {
+			return 0, fmt.Errorf("undefined label %s", label)
+		}
+		return uint32(target - pc - 1), nil
+	}
+
+	for pc, targets := range a.jumps {
+		jt, err := resolve(pc, targets[0])
+		if err != nil {
+			return nil, err
+		}
+		jf, err := resolve(pc, targets[1])
+		if err != nil {
+			return nil, err
+		}
+
+		ins := &a.prog[pc]
+		if ins.Op == bpfJMP|bpfJA {
+			ins.K = jt
+			continue
+		}
+		if jt > 255 || jf > 255 {
+			return nil, fmt.Errorf("program too large: jump of %d instructions at %d", max(jt, jf), pc)
+		}
+		ins.Jt, ins.Jf = uint8(jt), uint8(jf)
+	}
+	return a.prog, nil
+}
+
+// FormatBPF renders a program as tcpdump -ddd does: the number of
+// instructions, then one "op jt jf k" line per instruction. Joined with
+// commas instead of newlines, it is the bytecode accepted by iptables -m bpf.
+func FormatBPF(prog []Instruction) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d\n", len(prog))
+	for _, ins := range prog {
+		fmt.Fprintf(&sb, "%d %d %d %d\n", ins.Op, ins.Jt, ins.Jf, ins.K)
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// WriteEnvoy renders rules as the YAML rules of an Envoy RBAC filter, HTTP or
+// network. RBAC policies cannot be ordered against each other, so the rules
+// are resolved into the addresses whose action differs from the default one,
+// matched by a policy named after Options.Name: an ALLOW policy of the
+// allowed addresses when the default is deny, a DENY policy of the denied ones
+// when it is allow.
+//
+// Addresses are source_ip principals, or destination_ip permissions with
+// Options.Destination.
+func WriteEnvoy(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	name, err := opts.name()
+	if err != nil {
+		return err
+	}
+	allow, deny := resolve(rules)
+
+	exprs, action := allow, "ALLOW"
+	if opts.Default == DefaultAllow {
+		exprs, action = deny, "DENY"
+	}
+
+	b := opts.elements()
+	var cidrs strings.Builder
+	for p := range ipexpr.Prefixes(exprs...) {
+		if err := b.take(); err != nil {
+			return err
+		}
+		field := "source_ip"
+		if opts.Destination {
+			field = "destination_ip"
+		}
+		fmt.Fprintf(&cidrs, "    - %s:\n        address_prefix: %s\n        prefix_len: %d\n", field, p.Addr(), p.Bits())
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "action: %s\n", action)
+	if cidrs.Len() == 0 {
+		// no policy: ALLOW denies every request, DENY allows them all
+		sb.WriteString("policies: {}\n")
+		return flush(w, &sb)
+	}
+
+	fmt.Fprintf(&sb, "policies:\n  %s:\n", name)
+	if opts.Destination {
+		sb.WriteString("    permissions:\n" + cidrs.String())
+		sb.WriteString("    principals:\n    - any: true\n")
+	} else {
+		sb.WriteString("    permissions:\n    - any: true\n")
+		sb.WriteString("    principals:\n" + cidrs.String())
+	}
+	return flush(w, &sb)
+}
@@ -0,0 +1,209 @@
+// Package export renders ippy patterns in the configuration languages of
+// firewalls and packet filters.
+//
+// Rule sets are ordered lists of ipfilter rules evaluated first-match, as an
+// ipfilter.ACL does: an address is handled by the first rule matching it,
+// and by the default action when none does. Set-based formats (nftables,
+// ipset, HAProxy, Envoy RBAC) resolve the list into disjoint sets of allowed
+// and denied addresses; iptables and nginx keep the rules in order.
+package export
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// Format is an output dialect.
+type Format string
+
+const (
+	NFT      Format = "nft"
+	IPTables Format = "iptables"
+	IPSet    Format = "ipset"
+	BPF      Format = "bpf"
+
+	Nginx      Format = "nginx"
+	HAProxy    Format = "haproxy"
+	Envoy      Format = "envoy"
+	Kubernetes Format = "k8s"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{NFT, IPTables, IPSet, BPF, Nginx, HAProxy, Envoy, Kubernetes}
+
+// Options configures the exporters.
+type Options struct {
+	// Name names the generated table, chain, sets, ACL or policy. It defaults
+	// to "ippy".
+	Name string
+	// Default is the action applied to addresses no rule matches, DefaultDeny
+	// unless set.
+	Default DefaultAction
+	// Destination matches the destination address of packets instead of the
+	// source one.
+	Destination bool
+	// Intervals renders nftables set elements as address ranges instead of
+	// CIDR prefixes.
+	Intervals bool
+	// MaxElements bounds the CIDR prefixes or address ranges written, 1<<20
+	// unless set: patterns such as *.*.*.1 are made of millions of them, more
+	// than firewalls load. Exporting more is an error.
+	MaxElements int
+}
+
+// defaultMaxElements is the default of Options.MaxElements.
+const defaultMaxElements = 1 << 20
+
+// elements returns the budget of elements of an export.
+func (o Options) elements() *budget {
+	if o.MaxElements > 0 {
+		return &budget{max: o.MaxElements}
+	}
+	return &budget{max: defaultMaxElements}
+}
+
+// budget counts the elements written against Options.MaxElements.
+type budget struct {
+	n, max int
+}
+
+// take counts one more element, failing past the limit.
+func (b *budget) take() error {
+	if b.n++; b.n > b.max {
+		return fmt.Errorf("more than %d prefixes or ranges to export (see Options.MaxElements)", b.max)
+	}
+	return nil
+}
+
+// DefaultAction is the action applied to the addresses no rule matches. Its
+// zero value denies them, so that exports whose options leave it unset fail
+// closed.
+type DefaultAction int
+
+const (
+	DefaultDeny DefaultAction = iota
+	DefaultAllow
+)
+
+func (d DefaultAction) String() string {
+	switch d {
+	case DefaultDeny:
+		return "deny"
+	case DefaultAllow:
+		return "allow"
+	default:
+		return fmt.Sprintf("DefaultAction(%d)", int(d))
+	}
+}
+
+func (d DefaultAction) action() ipfilter.Action {
+	if d == DefaultAllow {
+		return ipfilter.Allow
+	}
+	return ipfilter.Deny
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+func (o Options) name() (string, error) {
+	if o.Name == "" {
+		return "ippy", nil
+	}
+	if !namePattern.MatchString(o.Name) {
+		return "", fmt.Errorf("invalid name %q: only letters, digits and underscores are allowed", o.Name)
+	}
+	return o.Name, nil
+}
+
+// Allow returns a rule set allowing the addresses matched by any of exprs, to
+// export expressions rather than rule files.
+func Allow(exprs ...*ipexpr.IPExpr) []ipfilter.Rule {
+	rules := make([]ipfilter.Rule, len(exprs))
+	for i, e := range exprs {
+		rules[i] = ipfilter.Rule{Action: ipfilter.Allow, Pattern: e.String(), Expr: e}
+	}
+	return rules
+}
+
+// Write renders rules in format f.
+func Write(w io.Writer, f Format, rules []ipfilter.Rule, opts Options) error {
+	switch f {
+	case NFT:
+		return WriteNFT(w, rules, opts)
+	case IPTables:
+		return WriteIPTables(w, rules, opts)
+	case IPSet:
+		return WriteIPSet(w, rules, opts)
+	case BPF:
+		return WriteBPF(w, rules, opts)
+	case Nginx:
+		return WriteNginx(w, rules, opts)
+	case HAProxy:
+		return WriteHAProxy(w, rules, opts)
+	case Envoy:
+		return WriteEnvoy(w, rules, opts)
+	case Kubernetes:
+		return WriteKubernetes(w, rules, opts)
+	default:
+		return fmt.Errorf("unknown format %q", f)
+	}
+}
+
+// resolve returns the addresses allowed and denied by the first-match rules,
+// as disjoint expressions: every rule only contributes the addresses no
+// earlier rule matches.
+func resolve(rules []ipfilter.Rule) (allow, deny []*ipexpr.IPExpr) {
+	for i, r := range rules {
+		pieces := []*ipexpr.IPExpr{r.Expr}
+		for _, earlier := range rules[:i] {
+			var rest []*ipexpr.IPExpr
+			for _, p := range pieces {
+				rest = append(rest, ipexpr.Diff(earlier.Expr, p).Added...)
+			}
+			pieces = rest
+		}
+
+		if r.Action == ipfilter.Deny {
+			deny = append(deny, pieces...)
+		} else {
+			allow = append(allow, pieces...)
+		}
+	}
+	return allow, deny
+}
+
+// ruleComment describes a rule in the comments of the generated files.
+func ruleComment(i int, r ipfilter.Rule) string {
+	s := fmt.Sprintf("rule %d: %s %s", i+1, r.Action, r.Pattern)
+	if r.Line > 0 {
+		s += fmt.Sprintf(" (line %d)", r.Line)
+	}
+	return s
+}
+
+// flush writes the generated file at once.
+func flush(w io.Writer, sb *strings.Builder) error {
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// prefixString renders single-address prefixes as plain addresses.
+func prefixString(p netip.Prefix) string {
+	if p.Bits() == 32 {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+func verdict(a ipfilter.Action) string {
+	if a == ipfilter.Deny {
+		return "drop"
+	}
+	return "accept"
+}
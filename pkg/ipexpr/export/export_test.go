@@ -0,0 +1,244 @@
+package export_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipexpr/export"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func readRules(t *testing.T) []ipfilter.Rule {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "rules.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	rules, err := ipfilter.ReadRules(f)
+	if err != nil {
+		t.Fatalf("ReadRules() failed: %v", err)
+	}
+	return rules
+}
+
+// checkGolden compares got with testdata/name.golden, rewriting the file
+// instead with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestWrite_Golden(t *testing.T) {
+	rules := readRules(t)
+	tests := []struct {
+		name   string
+		format export.Format
+		opts   export.Options
+	}{
+		{"nft", export.NFT, export.Options{Default: export.DefaultDeny}},
+		{"nft_intervals", export.NFT, export.Options{Default: export.DefaultDeny, Intervals: true}},
+		{"iptables", export.IPTables, export.Options{Default: export.DefaultDeny}},
+		{"iptables_destination", export.IPTables, export.Options{Name: "egress", Default: export.DefaultAllow, Destination: true}},
+		{"ipset", export.IPSet, export.Options{Name: "office"}},
+		{"nginx", export.Nginx, export.Options{Default: export.DefaultDeny}},
+		{"haproxy", export.HAProxy, export.Options{Default: export.DefaultDeny}},
+		{"haproxy_default_allow", export.HAProxy, export.Options{Name: "blocked", Default: export.DefaultAllow}},
+		{"envoy", export.Envoy, export.Options{Name: "office", Default: export.DefaultDeny}},
+		{"envoy_destination", export.Envoy, export.Options{Default: export.DefaultAllow, Destination: true}},
+		{"k8s", export.Kubernetes, export.Options{Name: "office_ingress", Default: export.DefaultDeny}},
+		{"k8s_default_allow", export.Kubernetes, export.Options{Default: export.DefaultAllow, Destination: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := export.Write(&buf, tt.format, rules, tt.opts); err != nil {
+				t.Fatalf("Write() failed: %v", err)
+			}
+			checkGolden(t, tt.name, buf.Bytes())
+		})
+	}
+}
+
+func TestWrite_SetsAreFirstMatch(t *testing.T) {
+	// the earlier allow rule takes 10.0.0.* out of the deny set
+	rules := []ipfilter.Rule{
+		{Action: ipfilter.Allow, Pattern: "10.0.0.*", Expr: mustParse(t, "10.0.0.*")},
+		{Action: ipfilter.Deny, Pattern: "10.0.0-1.*", Expr: mustParse(t, "10.0.0-1.*")},
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteIPSet(&buf, rules, export.Options{}); err != nil {
+		t.Fatalf("WriteIPSet() failed: %v", err)
+	}
+	want := "create ippy_allow hash:net family inet -exist\nflush ippy_allow\nadd ippy_allow 10.0.0.0/24\n" +
+		"create ippy_deny hash:net family inet -exist\nflush ippy_deny\nadd ippy_deny 10.0.1.0/24\n"
+	if buf.String() != want {
+		t.Errorf("WriteIPSet() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteKubernetes_Except(t *testing.T) {
+	rules := []ipfilter.Rule{
+		{Action: ipfilter.Allow, Pattern: "10.0.0.*", Expr: mustParse(t, "10.0.0.*")},
+		{Action: ipfilter.Deny, Pattern: "10.0.*.*", Expr: mustParse(t, "10.0.*.*")},
+		{Action: ipfilter.Deny, Pattern: "172.16.0.1", Expr: mustParse(t, "172.16.0.1")},
+		// 10.0.0.* is allowed by the first rule, 10.0.1-255.* denied by the
+		// second one, and 10.0.0.0/16 is entirely covered by both
+		{Action: ipfilter.Allow, Pattern: "10.0-1.*.*", Expr: mustParse(t, "10.0-1.*.*")},
+		{Action: ipfilter.Allow, Pattern: "172.16.0.*", Expr: mustParse(t, "172.16.0.*")},
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteKubernetes(&buf, rules, export.Options{Default: export.DefaultDeny}); err != nil {
+		t.Fatalf("WriteKubernetes() failed: %v", err)
+	}
+	want := `  ingress:
+  - from:
+    - ipBlock:
+        cidr: 10.0.0.0/24
+    - ipBlock:
+        cidr: 10.0.0.0/15
+        except:
+        - 10.0.1.0/24
+        - 10.0.2.0/23
+        - 10.0.4.0/22
+        - 10.0.8.0/21
+        - 10.0.16.0/20
+        - 10.0.32.0/19
+        - 10.0.64.0/18
+        - 10.0.128.0/17
+    - ipBlock:
+        cidr: 172.16.0.0/24
+        except:
+        - 172.16.0.1/32
+`
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("WriteKubernetes() = %s, want suffix %s", got, want)
+	}
+
+	buf.Reset()
+	rules = []ipfilter.Rule{{Action: ipfilter.Deny, Pattern: "10.*.*.*", Expr: mustParse(t, "10.*.*.*")}}
+	if err := export.WriteKubernetes(&buf, rules, export.Options{Default: export.DefaultDeny}); err != nil {
+		t.Fatalf("WriteKubernetes() failed: %v", err)
+	}
+	if !strings.HasSuffix(buf.String(), "  ingress: []\n") {
+		t.Errorf("WriteKubernetes() = %s, want no ingress peers", buf.String())
+	}
+}
+
+func TestWriteIPSet_Everything(t *testing.T) {
+	var buf bytes.Buffer
+	if err := export.WriteIPSet(&buf, export.Allow(mustParse(t, "*.*.*.*")), export.Options{}); err != nil {
+		t.Fatalf("WriteIPSet() failed: %v", err)
+	}
+	// hash:net sets cannot hold 0.0.0.0/0
+	want := "create ippy_allow hash:net family inet -exist\nflush ippy_allow\n" +
+		"add ippy_allow 0.0.0.0/1\nadd ippy_allow 128.0.0.0/1\n" +
+		"create ippy_deny hash:net family inet -exist\nflush ippy_deny\n"
+	if buf.String() != want {
+		t.Errorf("WriteIPSet() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWrite_MaxElements(t *testing.T) {
+	// *.*.*.1 is 2^24 single addresses
+	rules := export.Allow(mustParse(t, "*.*.*.1"))
+	for _, f := range export.Formats {
+		if f == export.BPF {
+			// tested octet by octet past a few prefixes
+			continue
+		}
+		err := export.Write(&bytes.Buffer{}, f, rules, export.Options{MaxElements: 1000})
+		if err == nil {
+			t.Errorf("Write(%s) of %s expected error but got none", f, rules[0].Pattern)
+		}
+	}
+
+	rules = export.Allow(mustParse(t, "10.0.0-3.1"))
+	if err := export.Write(&bytes.Buffer{}, export.NFT, rules, export.Options{MaxElements: 4}); err != nil {
+		t.Errorf("Write(nft) of 4 prefixes failed: %v", err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	var buf bytes.Buffer
+	rules := export.Allow(mustParse(t, "10.*.*.*"), mustParse(t, "11.*.*.*"))
+	if err := export.WriteIPSet(&buf, rules, export.Options{}); err != nil {
+		t.Fatalf("WriteIPSet() failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "add ippy_allow 10.0.0.0/7\n") {
+		t.Errorf("WriteIPSet() = %q, want 10.0.0.0/7 merged from both expressions", buf.String())
+	}
+}
+
+func TestWrite_DefaultDeny(t *testing.T) {
+	// options left unset deny the addresses the expressions do not match
+	rules := export.Allow(mustParse(t, "10.*.*.*"))
+	tests := map[export.Format][]string{
+		export.NFT:        {"policy drop;"},
+		export.IPTables:   {"iptables -A IPPY -j DROP\n"},
+		export.BPF:        {"ip and src net 10.0.0.0/8\n"},
+		export.Nginx:      {"allow 10.0.0.0/8;", "deny all;"},
+		export.Envoy:      {"action: ALLOW\n", "address_prefix: 10.0.0.0\n"},
+		export.Kubernetes: {"cidr: 10.0.0.0/8\n"},
+	}
+	for f, wants := range tests {
+		var buf bytes.Buffer
+		if err := export.Write(&buf, f, rules, export.Options{}); err != nil {
+			t.Fatalf("Write(%s) failed: %v", f, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Write(%s) = %q, want it to hold %q", f, buf.String(), want)
+			}
+		}
+	}
+}
+
+func TestWrite_Errors(t *testing.T) {
+	rules := export.Allow(mustParse(t, "10.*.*.*"))
+	if err := export.Write(&bytes.Buffer{}, "pf", rules, export.Options{}); err == nil {
+		t.Errorf("Write(pf) expected error but got none")
+	}
+	if err := export.WriteNginx(&bytes.Buffer{}, rules, export.Options{Destination: true}); err == nil {
+		t.Errorf("WriteNginx() with Destination expected error but got none")
+	}
+	for _, name := range []string{"my-table", "1abc", "a b", "x;"} {
+		if err := export.WriteNFT(&bytes.Buffer{}, rules, export.Options{Name: name}); err == nil {
+			t.Errorf("WriteNFT() with name %q expected error but got none", name)
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string) *ipexpr.IPExpr {
+	t.Helper()
+	e, err := ipexpr.Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+	return e
+}
@@ -0,0 +1,44 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// WriteHAProxy renders rules as an HAProxy ACL file: one address or CIDR
+// prefix per line, loaded with acl NAME src -f FILE. An ACL file is a single
+// set, so it holds the addresses whose action differs from the default one:
+// the allowed addresses when the default is deny, the denied ones when it is
+// allow. The header comment shows the directive applying it.
+func WriteHAProxy(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	name, err := opts.name()
+	if err != nil {
+		return err
+	}
+	allow, deny := resolve(rules)
+
+	fetch := "src"
+	if opts.Destination {
+		fetch = "dst"
+	}
+	exprs, cond := allow, "unless"
+	if opts.Default == DefaultAllow {
+		exprs, cond = deny, "if"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# acl %s %s -f %s.acl\n", name, fetch, name)
+	fmt.Fprintf(&sb, "# http-request deny %s %s\n", cond, name)
+	b := opts.elements()
+	for p := range ipexpr.Prefixes(exprs...) {
+		if err := b.take(); err != nil {
+			return err
+		}
+		sb.WriteString(prefixString(p) + "\n")
+	}
+	return flush(w, &sb)
+}
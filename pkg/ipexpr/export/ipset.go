@@ -0,0 +1,58 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// ipsetMaxElem is the default capacity of an ipset set.
+const ipsetMaxElem = 65536
+
+// WriteIPSet renders rules as an ipset restore file holding two hash:net sets
+// of CIDR prefixes, NAME_allow and NAME_deny, to be loaded with
+// ipset restore and matched with iptables -m set --match-set. The sets are
+// created unless they exist and flushed before being filled, so that loading
+// a new file replaces their content. The default action is left to the rules
+// using the sets.
+func WriteIPSet(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	name, err := opts.name()
+	if err != nil {
+		return err
+	}
+	allow, deny := resolve(rules)
+
+	b := opts.elements()
+	var sb strings.Builder
+	for _, set := range []struct {
+		name  string
+		exprs []*ipexpr.IPExpr
+	}{{name + "_allow", allow}, {name + "_deny", deny}} {
+		var elems []string
+		for p := range ipexpr.Prefixes(set.exprs...) {
+			if err := b.take(); err != nil {
+				return err
+			}
+			if p.Bits() == 0 {
+				// hash:net stores prefixes of 1 to 32 bits
+				elems = append(elems, "0.0.0.0/1", "128.0.0.0/1")
+				continue
+			}
+			elems = append(elems, prefixString(p))
+		}
+
+		fmt.Fprintf(&sb, "create %s hash:net family inet", set.name)
+		if len(elems) > ipsetMaxElem {
+			fmt.Fprintf(&sb, " maxelem %d", len(elems))
+		}
+		sb.WriteString(" -exist\n")
+		fmt.Fprintf(&sb, "flush %s\n", set.name)
+		for _, e := range elems {
+			fmt.Fprintf(&sb, "add %s %s\n", set.name, e)
+		}
+	}
+	return flush(w, &sb)
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// WriteIPTables renders rules as a shell script of iptables commands creating
+// a chain that checks the rules in order, one command per CIDR prefix, and
+// jumping to it from the INPUT chain (OUTPUT with Options.Destination).
+func WriteIPTables(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	name, err := opts.name()
+	if err != nil {
+		return err
+	}
+	chain := strings.ToUpper(name)
+
+	parent, flag := "INPUT", "-s"
+	if opts.Destination {
+		parent, flag = "OUTPUT", "-d"
+	}
+
+	b := opts.elements()
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\nset -e\n\n")
+	fmt.Fprintf(&sb, "iptables -N %s\n", chain)
+	for i, r := range rules {
+		fmt.Fprintf(&sb, "\n# %s\n", ruleComment(i, r))
+		target := strings.ToUpper(verdict(r.Action))
+		for p := range r.Expr.Prefixes() {
+			if err := b.take(); err != nil {
+				return err
+			}
+			fmt.Fprintf(&sb, "iptables -A %s %s %s -j %s\n", chain, flag, prefixString(p), target)
+		}
+	}
+
+	fmt.Fprintf(&sb, "\n# default %s\n", opts.Default.action())
+	fmt.Fprintf(&sb, "iptables -A %s -j %s\n", chain, strings.ToUpper(verdict(opts.Default.action())))
+	fmt.Fprintf(&sb, "iptables -A %s -j %s\n", parent, chain)
+	return flush(w, &sb)
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// WriteKubernetes renders rules as a Kubernetes NetworkPolicy selecting every
+// pod of its namespace, whose ingress rule (egress with Options.Destination)
+// allows the allowed addresses as ipBlock entries. NetworkPolicies can only
+// allow traffic, so denied addresses are the except list of the blocks they
+// fall in:
+//
+//   - with a deny default, every allow rule contributes one block per CIDR
+//     prefix, except the addresses earlier deny rules take out of it;
+//   - with an allow default, a single 0.0.0.0/0 block excepts every denied
+//     address.
+//
+// The policy is named after Options.Name, lowercased with underscores turned
+// into dashes, as Kubernetes names must be.
+func WriteKubernetes(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	name, err := opts.name()
+	if err != nil {
+		return err
+	}
+	name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	allow, deny := resolve(rules)
+
+	b := opts.elements()
+	var denied []netip.Prefix
+	for p := range ipexpr.Prefixes(deny...) {
+		if err := b.take(); err != nil {
+			return err
+		}
+		denied = append(denied, p)
+	}
+
+	var blocks []ipBlock
+	if opts.Default == DefaultAllow {
+		blocks = append(blocks, ipBlock{cidr: netip.MustParsePrefix("0.0.0.0/0"), except: denied})
+	} else if len(allow) > 0 {
+		seen := make(map[netip.Prefix]bool)
+		for _, r := range rules {
+			if r.Action != ipfilter.Allow {
+				continue
+			}
+			for p := range r.Expr.Prefixes() {
+				if err := b.take(); err != nil {
+					return err
+				}
+				if block, ok := newIPBlock(p, denied); ok && !seen[p] {
+					seen[p] = true
+					blocks = append(blocks, block)
+				}
+			}
+		}
+	}
+
+	policyType, direction, peer := "Ingress", "ingress", "from"
+	if opts.Destination {
+		policyType, direction, peer = "Egress", "egress", "to"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\n")
+	fmt.Fprintf(&sb, "metadata:\n  name: %s\n", name)
+	fmt.Fprintf(&sb, "spec:\n  podSelector: {}\n  policyTypes:\n  - %s\n", policyType)
+	if len(blocks) == 0 {
+		// selecting the pods without allowing anything isolates them
+		fmt.Fprintf(&sb, "  %s: []\n", direction)
+		return flush(w, &sb)
+	}
+
+	fmt.Fprintf(&sb, "  %s:\n  - %s:\n", direction, peer)
+	for _, b := range blocks {
+		fmt.Fprintf(&sb, "    - ipBlock:\n        cidr: %s\n", b.cidr)
+		if len(b.except) > 0 {
+			sb.WriteString("        except:\n")
+			for _, p := range b.except {
+				fmt.Fprintf(&sb, "        - %s\n", p)
+			}
+		}
+	}
+	return flush(w, &sb)
+}
+
+// ipBlock is a NetworkPolicy peer: the addresses of cidr not in except.
+type ipBlock struct {
+	cidr   netip.Prefix
+	except []netip.Prefix
+}
+
+// newIPBlock returns the block of p minus the denied prefixes, reporting false
+// if they cover p entirely. CIDR prefixes are either nested or disjoint, so
+// the denied prefixes within p are exactly its exceptions.
+func newIPBlock(p netip.Prefix, denied []netip.Prefix) (ipBlock, bool) {
+	b := ipBlock{cidr: p}
+	for _, d := range denied {
+		switch {
+		case d.Bits() <= p.Bits() && d.Contains(p.Addr()):
+			return ipBlock{}, false
+		case p.Contains(d.Addr()):
+			b.except = append(b.except, d)
+		}
+	}
+	return b, true
+}
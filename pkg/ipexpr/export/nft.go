@@ -0,0 +1,73 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// WriteNFT renders rules as an nftables table holding the sets of allowed and
+// denied addresses, and a filter chain checking them. The output can be
+// loaded with nft -f.
+func WriteNFT(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	name, err := opts.name()
+	if err != nil {
+		return err
+	}
+	allow, deny := resolve(rules)
+
+	hook, field := "input", "saddr"
+	if opts.Destination {
+		hook, field = "output", "daddr"
+	}
+
+	b := opts.elements()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "table ip %s {\n", name)
+	for _, set := range []struct {
+		name  string
+		exprs []*ipexpr.IPExpr
+	}{{"allow", allow}, {"deny", deny}} {
+		fmt.Fprintf(&sb, "\tset %s {\n", set.name)
+		sb.WriteString("\t\ttype ipv4_addr\n")
+		sb.WriteString("\t\tflags interval\n")
+		elems, err := nftElements(set.exprs, opts.Intervals, b)
+		if err != nil {
+			return err
+		}
+		if len(elems) > 0 {
+			fmt.Fprintf(&sb, "\t\telements = {\n\t\t\t%s\n\t\t}\n", strings.Join(elems, ",\n\t\t\t"))
+		}
+		sb.WriteString("\t}\n\n")
+	}
+
+	fmt.Fprintf(&sb, "\tchain filter {\n")
+	fmt.Fprintf(&sb, "\t\ttype filter hook %s priority filter; policy %s;\n", hook, verdict(opts.Default.action()))
+	fmt.Fprintf(&sb, "\t\tip %s @deny drop\n", field)
+	fmt.Fprintf(&sb, "\t\tip %s @allow accept\n", field)
+	sb.WriteString("\t}\n}\n")
+	return flush(w, &sb)
+}
+
+func nftElements(exprs []*ipexpr.IPExpr, intervals bool, b *budget) ([]string, error) {
+	var elems []string
+	if intervals {
+		for r := range ipexpr.Ranges(exprs...) {
+			if err := b.take(); err != nil {
+				return nil, err
+			}
+			elems = append(elems, r.String())
+		}
+		return elems, nil
+	}
+	for p := range ipexpr.Prefixes(exprs...) {
+		if err := b.take(); err != nil {
+			return nil, err
+		}
+		elems = append(elems, prefixString(p))
+	}
+	return elems, nil
+}
@@ -0,0 +1,36 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// WriteNginx renders rules as nginx allow and deny directives, to be included
+// in an http, server or location block. nginx checks them in order until one
+// matches, as the rules are, so they are kept in order, one directive per CIDR
+// prefix, and closed by the default action for all addresses.
+//
+// nginx matches client addresses only: Options.Destination is an error.
+func WriteNginx(w io.Writer, rules []ipfilter.Rule, opts Options) error {
+	if opts.Destination {
+		return fmt.Errorf("nginx matches client addresses only")
+	}
+
+	b := opts.elements()
+	var sb strings.Builder
+	for i, r := range rules {
+		fmt.Fprintf(&sb, "# %s\n", ruleComment(i, r))
+		for p := range r.Expr.Prefixes() {
+			if err := b.take(); err != nil {
+				return err
+			}
+			fmt.Fprintf(&sb, "%s %s;\n", r.Action, prefixString(p))
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "# default %s\n%s all;\n", opts.Default.action(), opts.Default.action())
+	return flush(w, &sb)
+}
@@ -0,0 +1,260 @@
+package ipexpr_test
+
+import (
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/internal/ip"
+	"github.com/azraelsec/ippy/internal/parser"
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+// refTermRE is the grammar of an octet term: *, a number or a range of
+// numbers, with spaces around tokens. Numbers have no leading zeros.
+var refTermRE = regexp.MustCompile(`^ *(?:(\*)|(0|[1-9][0-9]{0,2}) *(?:- *(0|[1-9][0-9]{0,2}))?) *$`)
+
+// refOctet returns the values an octet expression matches, one by one.
+func refOctet(s string) ([256]bool, bool) {
+	var set [256]bool
+	terms := strings.Split(s, ",")
+	if len(terms) > parser.MaxTerms {
+		return set, false
+	}
+	for _, term := range terms {
+		m := refTermRE.FindStringSubmatch(term)
+		if m == nil {
+			return set, false
+		}
+		lo, hi := 0, 255
+		if m[1] == "" {
+			lo, _ = strconv.Atoi(m[2])
+			hi = lo
+			if m[3] != "" {
+				hi, _ = strconv.Atoi(m[3])
+			}
+		}
+		if lo > 255 || hi > 255 {
+			return set, false
+		}
+		for v := lo; v <= hi; v++ {
+			set[v] = true
+		}
+	}
+	return set, true
+}
+
+// referenceMatch is the brute-force reference Parse is checked against: it
+// returns the membership test of pattern, made of the values of its octets or
+// of its intervals of addresses, and whether pattern is valid. Patterns
+// holding named ranges or attribute atoms are not known to it.
+func referenceMatch(pattern string) (match func(uint32) bool, valid, known bool) {
+	if strings.Contains(pattern, "|") {
+		var matches []func(uint32) bool
+		for part := range strings.SplitSeq(pattern, "|") {
+			m, valid, known := referenceMatch(part)
+			if !valid || !known {
+				return nil, valid, known
+			}
+			matches = append(matches, m)
+		}
+		return func(v uint32) bool {
+			for _, m := range matches {
+				if m(v) {
+					return true
+				}
+			}
+			return false
+		}, true, true
+	}
+	if rest, ok := strings.CutPrefix(strings.TrimLeft(pattern, " "), "!"); ok {
+		m, valid, known := referenceMatch(rest)
+		if !valid || !known {
+			return nil, valid, known
+		}
+		return func(v uint32) bool { return !m(v) }, true, true
+	}
+
+	if strings.Count(pattern, ".") > 3 || strings.ContainsAny(pattern, "@:") {
+		var spans [][2]uint32
+		for item := range strings.SplitSeq(pattern, ",") {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, "@") || strings.Contains(item, ":") {
+				return nil, false, false
+			}
+			first, last, ok := strings.Cut(item, "-")
+			if !ok {
+				last = first
+			}
+			lo, err1 := netip.ParseAddr(strings.TrimSpace(first))
+			hi, err2 := netip.ParseAddr(strings.TrimSpace(last))
+			if err1 != nil || err2 != nil || !lo.Is4() || !hi.Is4() || lo.Compare(hi) > 0 {
+				return nil, false, true
+			}
+			spans = append(spans, [2]uint32{addrUint32(lo), addrUint32(hi)})
+		}
+		return func(v uint32) bool {
+			for _, s := range spans {
+				if s[0] <= v && v <= s[1] {
+					return true
+				}
+			}
+			return false
+		}, true, true
+	}
+
+	parts := strings.Split(pattern, ".")
+	if len(parts) != 4 {
+		return nil, false, true
+	}
+	var sets [4][256]bool
+	for i, part := range parts {
+		var ok bool
+		if sets[i], ok = refOctet(part); !ok {
+			return nil, false, true
+		}
+	}
+	return func(v uint32) bool {
+		return sets[0][v>>24] && sets[1][byte(v>>16)] && sets[2][byte(v>>8)] && sets[3][byte(v)]
+	}, true, true
+}
+
+func addrUint32(a netip.Addr) uint32 {
+	b := a.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// maxFuzzRanges bounds the ranges of the expressions whose every range is
+// checked: octet sets of alternating values make billions of them.
+const maxFuzzRanges = 1 << 12
+
+func FuzzParse(f *testing.F) {
+	f.Add("192.168.1-3,5.*", uint32(0xc0a80501))
+	f.Add("10.0-50.*.1-254", uint32(0x0a320000))
+	f.Add("*.*.*.0,255", uint32(0xffffffff))
+	f.Add("1.2.3.4 - 5", uint32(0x01020305))
+	f.Add("10.0.0.200-10.0.1.50,10.0.2.1", uint32(0x0a0000c8))
+	f.Add("10.0.0.0-10.255.255.255 | 192.168.*.*", uint32(0xc0a80000))
+	f.Add("!10.0.0.0-10.0.1.255", uint32(0x0a000200))
+	f.Add("!@bogon | 127.0.0.1", uint32(0x7f000001))
+	f.Add("1-0.0.0.0", uint32(0))
+	f.Add("1 2.3.4.5", uint32(0))
+
+	f.Fuzz(func(t *testing.T, pattern string, addr uint32) {
+		match, valid, known := referenceMatch(pattern)
+		e, err := ipexpr.Parse(pattern)
+		if known && (err == nil) != valid {
+			t.Fatalf("Parse(%q) error = %v, reference valid = %v", pattern, err, valid)
+		}
+		if err != nil {
+			return
+		}
+
+		// addr, and the bounds of the first ranges and their neighbours
+		addrs := []uint32{addr}
+		var count uint64
+		n := 0
+		for r := range e.Ranges() {
+			if n++; n > maxFuzzRanges {
+				break
+			}
+			first, last := addrUint32(r.First), addrUint32(r.Last)
+			if first > last {
+				t.Fatalf("Ranges() of %q yielded reversed range %s", pattern, r)
+			}
+			count += uint64(last-first) + 1
+			if n <= 8 {
+				addrs = append(addrs, first, last, first-1, last+1)
+			}
+		}
+		if n <= maxFuzzRanges && count != e.Count() {
+			t.Fatalf("ranges of %q hold %d addresses, Count() = %d", pattern, count, e.Count())
+		}
+
+		want := make(map[uint32]bool)
+		for _, b := range []ipexpr.Backend{ipexpr.BackendBitset, ipexpr.BackendRangeTable} {
+			if err := e.SetBackend(b); err != nil {
+				// too many ranges for the range table
+				continue
+			}
+			for _, v := range addrs {
+				a := netip.AddrFrom4(u32Addr(v))
+				got := e.ContainsAddr(a)
+				if w, ok := want[v]; ok && got != w {
+					t.Fatalf("%s: ContainsAddr(%s) of %q = %v, another backend %v", b, a, pattern, got, w)
+				}
+				want[v] = got
+				if known && got != match(v) {
+					t.Fatalf("%s: ContainsAddr(%s) of %q = %v, reference %v", b, a, pattern, got, match(v))
+				}
+				if m, err := e.Matches(a.String()); err != nil || m != got {
+					t.Fatalf("%s: Matches(%s) of %q = %v, %v, ContainsAddr() = %v", b, a, pattern, m, err, got)
+				}
+				if c := e.Contains(net.IP(a.AsSlice())); c != got {
+					t.Fatalf("%s: Contains(%s) of %q = %v, ContainsAddr() = %v", b, a, pattern, c, got)
+				}
+			}
+		}
+
+		if n > maxFuzzRanges {
+			return
+		}
+		back, err := ipexpr.Parse(e.String())
+		if err != nil {
+			t.Fatalf("Parse(%q), the String() of %q, failed: %v", e, pattern, err)
+		}
+		if !back.Equal(e) {
+			t.Fatalf("String() of %q = %q, parsed as %s", pattern, e, back)
+		}
+	})
+}
+
+func FuzzMatches(f *testing.F) {
+	f.Add("192.168.1.1")
+	f.Add("10.0.0.200")
+	f.Add("001.002.003.004")
+	f.Add("1.2.3.4.5")
+	f.Add("1.2.3.256")
+	f.Add("10.300.0.1")
+	f.Add("1.2.3.")
+
+	// every pattern, with either backend
+	patterns := []string{"*.*.*.*", "10.0-50.*.1-254", "10.0.0.200-10.0.1.50,192.168.0.0-192.168.255.255"}
+	type matcher struct {
+		pattern string
+		backend ipexpr.Backend
+		expr    *ipexpr.IPExpr
+	}
+	var matchers []matcher
+	for _, p := range patterns {
+		for _, b := range []ipexpr.Backend{ipexpr.BackendBitset, ipexpr.BackendRangeTable} {
+			e, err := ipexpr.Parse(p)
+			if err != nil {
+				f.Fatalf("Parse(%q) failed: %v", p, err)
+			}
+			if err := e.SetBackend(b); err != nil {
+				f.Fatalf("SetBackend(%s) of %q failed: %v", b, p, err)
+			}
+			matchers = append(matchers, matcher{p, b, e})
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		parsed, perr := ip.Parse(s)
+		for _, m := range matchers {
+			got, err := m.expr.Matches(s)
+			if perr == nil {
+				if want := m.expr.Contains(parsed); err != nil || got != want {
+					t.Fatalf("%s: Matches(%q) of %q = %v, %v, Contains() = %v", m.backend, s, m.pattern, got, err, want)
+				}
+				continue
+			}
+			if got || err == nil {
+				t.Fatalf("%s: Matches(%q) of %q = %v, %v on an address ip.Parse rejects: %v", m.backend, s, m.pattern, got, err, perr)
+			}
+		}
+	})
+}
@@ -3,71 +3,377 @@
 // This package allows you to define complex IPv4 address patterns using a simple
 // expression syntax and efficiently match IP addresses against those patterns.
 // It supports ranges (1-10), wildcards (*), comma-separated values (1,3,5),
-// and combinations thereof in each octet of an IPv4 address.
+// and combinations thereof in each octet of an IPv4 address, as well as lists
+// of address ranges spanning octet boundaries (10.0.0.200-10.0.1.50).
 package ipexpr
 
 import (
 	"fmt"
 	"iter"
 	"net"
+	"net/netip"
 	"strings"
 
-	"github.com/azraelsec/ippy/internal/bitsvector"
 	"github.com/azraelsec/ippy/internal/ip"
 	"github.com/azraelsec/ippy/internal/parser"
+	"github.com/azraelsec/ippy/pkg/bitsvector"
 )
 
+// IPExpr is a compiled pattern. Its methods have pointer receivers, as they
+// use the backend compiled into the expression, except on purpose
+// MarshalText, MarshalJSON and Value: their value receivers encode IPExpr
+// values and non-addressable fields too.
 type IPExpr struct {
+	backend Backend
+	// inline holds the sorted bounds of up to inlineRanges ranges for the
+	// range table backend; larger tables are stored in table.
+	ninline uint8
+	inline  [2 * inlineRanges]uint32
+	table   []uint32
+
+	// octets holds the octet sets of the expression. Ranges of addresses
+	// spanning octet boundaries are not a product of octet sets: they are
+	// split into terms, disjoint products whose first one is held in
+	// octets and the others in rest.
 	octets [4]bitsvector.OctetBits
+	rest   []term
 }
 
-func (ie IPExpr) Matches(i string) (bool, error) {
-	ip, err := ip.Parse(i)
-	if err != nil {
-		return false, err
+// Matches reports whether the dotted-quad address s matches the expression.
+//
+// The address is parsed in a single pass without allocating, and validated
+// whole whatever the backend: malformed addresses, octets with leading zeros
+// included, are reported as errors. With the bitset backend each octet is
+// tested as soon as it is read; once one does not match, the rest of the
+// input is only validated.
+func (ie *IPExpr) Matches(s string) (bool, error) {
+	if ie.backend == BackendRangeTable || ie.rest != nil {
+		v, ok := parseUint32(s)
+		if !ok {
+			return false, fmt.Errorf("invalid ip: %s", s)
+		}
+		if ie.backend == BackendRangeTable {
+			return ie.searchTable(v), nil
+		}
+		return ie.testTerms(v), nil
 	}
 
-	for i, octet := range ip {
+	matched := true
+	octet, val, digits := 0, 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == '.' {
+			if digits == 0 || octet > 3 {
+				return false, fmt.Errorf("invalid ip: %s", s)
+			}
+			matched = matched && ie.octets[octet].Test(byte(val))
+			octet, val, digits = octet+1, 0, 0
+			continue
+		}
+
+		c := s[i]
+		// octets have no leading zeros, as in ip.Parse
+		if c < '0' || c > '9' || digits > 0 && val == 0 {
+			return false, fmt.Errorf("invalid ip: %s", s)
+		}
+		val = val*10 + int(c-'0')
+		digits++
+		if val > 255 {
+			return false, fmt.Errorf("invalid ip: %s", s)
+		}
+	}
+
+	if octet != 4 {
+		return false, fmt.Errorf("invalid ip: %s", s)
+	}
+	return matched, nil
+}
+
+// Contains reports whether an already parsed address matches the expression.
+// Addresses that are not IPv4 (or IPv4-mapped IPv6) never match.
+func (ie *IPExpr) Contains(addr ip.IPv4) bool {
+	addr = addr.To4()
+	if addr == nil {
+		return false
+	}
+	if ie.backend == BackendRangeTable {
+		return ie.searchTable(ipToUint32(addr))
+	}
+	if ie.rest != nil {
+		return ie.testTerms(ipToUint32(addr))
+	}
+
+	for i, octet := range addr {
 		if !ie.octets[i].Test(octet) {
-			return false, nil
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsAddr reports whether addr matches the expression. IPv4-mapped IPv6
+// addresses are unmapped; any other IPv6 address never matches.
+func (ie *IPExpr) ContainsAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return false
+	}
+	if ie.backend == BackendRangeTable {
+		return ie.searchTable(addrToUint32(addr))
+	}
+	if ie.rest != nil {
+		return ie.testTerms(addrToUint32(addr))
+	}
+
+	a := addr.As4()
+	return ie.octets[0].Test(a[0]) && ie.octets[1].Test(a[1]) &&
+		ie.octets[2].Test(a[2]) && ie.octets[3].Test(a[3])
+}
+
+// Octets returns the set of values matched by each octet. For expressions
+// made of several terms (see Terms), it is the set of values each octet takes
+// in some matched address, so the octet sets match more addresses than the
+// expression does.
+func (ie *IPExpr) Octets() [4]bitsvector.OctetBits {
+	octets := ie.octets
+	for _, t := range ie.rest {
+		for i := range octets {
+			octets[i] = octets[i].Union(t[i])
+		}
+	}
+	return octets
+}
+
+// Count returns the number of addresses matched by the expression.
+func (ie *IPExpr) Count() uint64 {
+	n := termCount(ie.octets)
+	for _, t := range ie.rest {
+		n += termCount(t)
+	}
+	return n
+}
+
+// Covers reports whether every address matched by o is also matched by the
+// expression. The empty expression is covered by any other.
+func (ie *IPExpr) Covers(o *IPExpr) bool {
+	if o.Count() == 0 {
+		return true
+	}
+	if ie.rest == nil && o.rest == nil {
+		for i := range ie.octets {
+			if ie.octets[i].Intersect(o.octets[i]) != o.octets[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// the terms of ie are disjoint: every term of o must be split among
+	// them without losing an address
+	for _, u := range o.terms() {
+		var n uint64
+		for _, t := range ie.terms() {
+			n += termCount(termIntersect(t, u))
+		}
+		if n != termCount(u) {
+			return false
+		}
+	}
+	return true
+}
+
+// Overlaps reports whether at least one address is matched by both
+// expressions.
+func (ie *IPExpr) Overlaps(o *IPExpr) bool {
+	return ie.Intersect(o).Count() > 0
+}
+
+// Equal reports whether both expressions match the same addresses.
+func (ie *IPExpr) Equal(o *IPExpr) bool {
+	return ie.Covers(o) && o.Covers(ie)
+}
+
+// Intersect returns an expression matching the addresses matched by both.
+func (ie *IPExpr) Intersect(o *IPExpr) *IPExpr {
+	if ie.rest == nil && o.rest == nil {
+		return &IPExpr{octets: termIntersect(ie.octets, o.octets)}
+	}
+
+	var terms []term
+	for _, t := range ie.terms() {
+		for _, u := range o.terms() {
+			terms = append(terms, termIntersect(t, u))
 		}
 	}
-	return true, nil
+	return fromTerms(terms)
 }
 
-func (ie IPExpr) Generate() iter.Seq2[int, ip.IPv4] {
-	i := 0
-	counter := [4]int{}
+// Generate yields the addresses matched by the expression in ascending order,
+// along with their index.
+func (ie *IPExpr) Generate() iter.Seq2[int, ip.IPv4] {
 	return func(yield func(int, ip.IPv4) bool) {
-		for counter[0] != 0 && counter[1] != 0 && counter[2] != 0 && counter[3] != 0 {
-			ip := net.IPv4(byte(counter[0]), byte(counter[1]), byte(counter[2]), byte(counter[3]))
-
-			for i := range 4 {
-				carry := false
-				for {
-					counter[3-i] = (counter[3-i] + 1) % 256
-					if counter[3-i] == 0 {
-						carry = true
-					}
-					if ie.octets[3-i].Test(byte(counter[3-i])) {
-						break
-					}
-				}
-				if !carry {
-					break
+		i := 0
+		for span := range mergeSpans([]*IPExpr{ie}) {
+			for v := uint64(span[0]); v <= uint64(span[1]); v++ {
+				if !yield(i, net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)).To4()) {
+					return
 				}
+				i++
 			}
+		}
+	}
+}
 
-			if !yield(i, ip) {
-				return
-			}
+// String returns the canonical form of the expression: every octet is
+// rendered as its sorted, merged intervals, or as * when it matches any value.
+// Octets matching no value are rendered as the reversed range 1-0.
+//
+// Expressions made of several terms are rendered as the comma separated list
+// of their maximal ranges, e.g. 10.0.0.200-10.0.1.50,10.0.2.1, unless they
+// have more ranges than terms, as negated patterns often do: they are then
+// rendered as their terms separated by |, e.g. 0-9,11-255.*.*.* | 10.*.*.0.
+func (ie *IPExpr) String() string {
+	if ie.rest == nil {
+		return termString(ie.octets)
+	}
 
-			i++
+	var ranges []string
+	for r := range ie.Ranges() {
+		if len(ranges) == 1+len(ie.rest) {
+			ranges = nil
+			break
 		}
+		ranges = append(ranges, r.String())
+	}
+	if ranges != nil {
+		return strings.Join(ranges, ",")
 	}
+
+	terms := make([]string, 0, 1+len(ie.rest))
+	for _, t := range ie.terms() {
+		terms = append(terms, termString(t))
+	}
+	return strings.Join(terms, " | ")
 }
 
+func termString(t term) string {
+	var sb strings.Builder
+	for i, o := range t {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		writeOctet(&sb, o)
+	}
+	return sb.String()
+}
+
+func writeOctet(sb *strings.Builder, o bitsvector.OctetBits) {
+	if o.Empty() {
+		sb.WriteString("1-0")
+		return
+	}
+	sb.WriteString(o.String())
+}
+
+// Parse parses a pattern, which is one of:
+//
+//   - four dot separated octet expressions, such as 10.0.1-3,5.*;
+//   - a comma separated list of addresses, ranges of addresses and named
+//     ranges, such as 10.0.0.200-10.0.1.50,10.0.2.1 or @private,@loopback,
+//     told apart from octet expressions by its number of dots, its named
+//     ranges or its attribute atoms. Address ranges are not limited to one
+//     octet; those spanning octet boundaries make expressions of several
+//     terms (see Terms). Named ranges are the categories of special-purpose
+//     addresses, such as @private (see Category), @cgnat, another name of
+//     @shared, and @bogon;
+//   - a pattern preceded by !, matching the addresses the pattern does not
+//     match, such as !@bogon;
+//   - patterns separated by |, matching the addresses any of them matches.
+//     ! applies to a single pattern: !@private | @loopback matches 127.0.0.1.
+//
+// Lists may also hold attribute atoms, written key:value such as asn:13335
+// or country:IT, which only ParseWithOptions resolves.
 func Parse(expr string) (*IPExpr, error) {
+	return ParseWithOptions(expr, ParseOptions{})
+}
+
+// Resolver resolves the attribute atoms of patterns into the addresses they
+// stand for, e.g. asn:13335 into the networks announced by AS13335.
+type Resolver interface {
+	Resolve(key, value string) (*IPExpr, error)
+}
+
+// ParseOptions configures ParseWithOptions. Its limits bound the patterns
+// accepted from untrusted sources, a zero limit being no limit; violations
+// are reported as *LimitError and *FeatureError values.
+type ParseOptions struct {
+	// Resolver resolves attribute atoms. Without one, patterns holding
+	// attribute atoms are rejected.
+	Resolver Resolver
+
+	// MaxLength bounds the length of patterns, in bytes.
+	MaxLength int
+	// MaxOctetTerms bounds the comma separated terms of every octet
+	// expression, such as 3 for 1,5-9,*. Octets never hold more than
+	// parser.MaxTerms.
+	MaxOctetTerms int
+	// MaxCount bounds the number of addresses patterns match.
+	MaxCount uint64
+	// Forbid is the features patterns may not use, e.g.
+	// FeatureWildcardFirstOctet|FeatureNegation.
+	Forbid Feature
+}
+
+// ParseWithOptions is Parse with options.
+func ParseWithOptions(expr string, opts ParseOptions) (*IPExpr, error) {
+	if opts.MaxLength > 0 && len(expr) > opts.MaxLength {
+		return nil, &LimitError{Limit: LimitLength, Value: uint64(len(expr)), Max: uint64(opts.MaxLength)}
+	}
+	e, err := parse(expr, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.checkFirstOctet(e, expr); err != nil {
+		return nil, err
+	}
+	if n := e.Count(); opts.MaxCount > 0 && n > opts.MaxCount {
+		return nil, &LimitError{Limit: LimitCount, Value: n, Max: opts.MaxCount}
+	}
+	return e, nil
+}
+
+func parse(expr string, opts ParseOptions) (*IPExpr, error) {
+	if strings.Contains(expr, "|") {
+		if err := opts.checkFeature(FeatureUnion, expr); err != nil {
+			return nil, err
+		}
+		var exprs []*IPExpr
+		for part := range strings.SplitSeq(expr, "|") {
+			e, err := parse(part, opts)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, e)
+		}
+		e := union(exprs)
+		_ = e.SetBackend(BackendAuto)
+		return e, nil
+	}
+	if rest, ok := strings.CutPrefix(strings.TrimLeft(expr, " "), "!"); ok {
+		if err := opts.checkFeature(FeatureNegation, expr); err != nil {
+			return nil, err
+		}
+		e, err := parse(rest, opts)
+		if err != nil {
+			return nil, err
+		}
+		e = e.complement()
+		_ = e.SetBackend(BackendAuto)
+		return e, nil
+	}
+	if strings.Count(expr, ".") > 3 || strings.ContainsAny(expr, "@:") {
+		return parseRangeList(expr, opts)
+	}
+
 	parts := strings.Split(expr, ".")
 	if len(parts) != 4 {
 		return nil, fmt.Errorf("invalid ip expression: %s", expr)
@@ -75,12 +381,16 @@ func Parse(expr string) (*IPExpr, error) {
 
 	ip := &IPExpr{}
 	for i, part := range parts {
+		if err := opts.checkOctetTerms(part); err != nil {
+			return nil, err
+		}
 		bv, err := parseOctet(part)
 		if err != nil {
 			return nil, err
 		}
 		ip.octets[i] = bv
 	}
+	_ = ip.SetBackend(BackendAuto)
 	return ip, nil
 }
 
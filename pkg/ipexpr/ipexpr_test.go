@@ -1,6 +1,7 @@
 package ipexpr_test
 
 import (
+	"fmt"
 	"net"
 	"testing"
 
@@ -303,6 +304,12 @@ func TestIPExpr_Matches(t *testing.T) {
 			ip:   "255.255.255.255",
 			want: true,
 		},
+		{
+			name: "edge case - 255 only matches itself",
+			expr: "192.168.1.255",
+			ip:   "192.168.1.1",
+			want: false,
+		},
 		{
 			name: "edge case - full range match",
 			expr: "0-255.0-255.0-255.0-255",
@@ -601,10 +608,18 @@ func TestIPExpr_Generate(t *testing.T) {
 				t.Fatalf("Parse() failed: %v", err)
 			}
 
+			n := 0
 			for i, iip := range ipExpr.Generate() {
+				if i >= len(tt.want) {
+					t.Fatalf("Generate(%s) yielded more than %d addresses", tt.expr, len(tt.want))
+				}
 				if !tt.want[i].Equal(iip) {
 					t.Errorf("Generate(%s)[%d] = %s, want %s", tt.expr, i, iip, tt.want[i])
 				}
+				n++
+			}
+			if n != len(tt.want) {
+				t.Errorf("Generate(%s) yielded %d addresses, want %d", tt.expr, n, len(tt.want))
 			}
 		})
 	}
@@ -638,6 +653,220 @@ func TestIPExpr_MatchesMethod(t *testing.T) {
 	}
 }
 
+func TestIPExpr_Contains(t *testing.T) {
+	ipExpr, err := ipexpr.Parse("10.0-50.*.1-254")
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		ip   net.IP
+		want bool
+	}{
+		{"4-byte match", net.IP{10, 20, 30, 40}, true},
+		{"16-byte match", net.IPv4(10, 0, 0, 1), true},
+		{"octet out of range", net.IPv4(10, 51, 0, 1), false},
+		{"excluded host", net.IPv4(10, 0, 0, 255), false},
+		{"ipv6", net.ParseIP("2001:db8::1"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ipExpr.Contains(tc.ip); got != tc.want {
+				t.Errorf("Contains(%s) = %v, want %v", tc.ip, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIPExpr_Count(t *testing.T) {
+	tests := []struct {
+		expr string
+		want uint64
+	}{
+		{"192.168.1.1", 1},
+		{"192.168.1.*", 256},
+		{"10.0-50.*.1-254", 51 * 256 * 254},
+		{"192.168.1.1,1,2-3", 3},
+		{"*.*.*.*", 1 << 32},
+		{"192.168.1.5-3", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			ipExpr, err := ipexpr.Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if got := ipExpr.Count(); got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPExpr_SetRelations(t *testing.T) {
+	tests := []struct {
+		a, b         string
+		covers       bool
+		coveredBy    bool
+		overlaps     bool
+		intersection uint64
+	}{
+		{"10.0.*.*", "10.0.66.*", true, false, true, 256},
+		{"10.0.66.*", "10.0.*.*", false, true, true, 256},
+		{"10.0.1-10.*", "10.0.5-20.1", false, false, true, 6},
+		{"10.0.0.*", "10.0.1.*", false, false, false, 0},
+		{"10.0.0.1,2", "10.0.0.2,1-1", true, true, true, 2},
+		{"10.0.0.*", "10.0.0.5-3", true, false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := ipexpr.Parse(tt.a)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			b, err := ipexpr.Parse(tt.b)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+
+			if got := a.Covers(b); got != tt.covers {
+				t.Errorf("Covers() = %v, want %v", got, tt.covers)
+			}
+			if got := b.Covers(a); got != tt.coveredBy {
+				t.Errorf("reverse Covers() = %v, want %v", got, tt.coveredBy)
+			}
+			if got := a.Overlaps(b); got != tt.overlaps {
+				t.Errorf("Overlaps() = %v, want %v", got, tt.overlaps)
+			}
+			if got := a.Equal(b); got != (tt.covers && tt.coveredBy) {
+				t.Errorf("Equal() = %v, want %v", got, tt.covers && tt.coveredBy)
+			}
+			if got := a.Intersect(b).Count(); got != tt.intersection {
+				t.Errorf("Intersect().Count() = %d, want %d", got, tt.intersection)
+			}
+		})
+	}
+}
+
+func TestIPExpr_String(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"192.168.1.1", "192.168.1.1"},
+		{"0-255.0-255.0-255.0-255", "*.*.*.*"},
+		{"192.168.1.1, 2, 3", "192.168.1.1-3"},
+		{"10.0.20-30,1,5-25.3", "10.0.1,5-30.3"},
+		{"192.168.1.5-3", "192.168.1.1-0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got := mustParse(t, tt.expr).String()
+			if got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if !mustParse(t, got).Equal(mustParse(t, tt.expr)) {
+				t.Errorf("String() = %q does not round-trip", got)
+			}
+		})
+	}
+}
+
+func TestIPExpr_MatchesErrors(t *testing.T) {
+	ipExpr, err := ipexpr.Parse("*.*.*.*")
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	tests := []struct {
+		ip      string
+		want    bool
+		wantErr bool
+	}{
+		{"1.2.3.4", true, false},
+		{"001.002.003.004", false, true},
+		{"0.0.0.0", true, false},
+		{"255.255.255.255", true, false},
+		{"", false, true},
+		{"1.2.3", false, true},
+		{"1.2.3.4.5", false, true},
+		{"1.2..4", false, true},
+		{".1.2.3", false, true},
+		{"1.2.3.", false, true},
+		{"1.2.3.256", false, true},
+		{"1.2.3.-1", false, true},
+		{"1.2.3.+1", false, true},
+		{"1.2.3.4 ", false, true},
+		{"1.2.3.0000000000000000000001", false, true},
+		{"1.2.3.00", false, true},
+		{"1.2.3.99999999999999999999", false, true},
+		{"::1", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got, err := ipExpr.Matches(tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Matches(%q) error = %v, wantErr %v", tt.ip, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+
+			// the fast path agrees with the reference parser
+			parsed, perr := ip.Parse(tt.ip)
+			if (perr != nil) != (err != nil) {
+				t.Errorf("ip.Parse(%q) error = %v, Matches error = %v", tt.ip, perr, err)
+			}
+			if perr == nil && !ipExpr.Contains(parsed) {
+				t.Errorf("Contains(%s) = false", parsed)
+			}
+		})
+	}
+}
+
+func TestIPExpr_MatchesValidatesInput(t *testing.T) {
+	for _, expr := range []string{"10.*.*.*", "10.0.0.200-10.0.1.50"} {
+		ipExpr, err := ipexpr.Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse() failed: %v", err)
+		}
+		for _, b := range []ipexpr.Backend{ipexpr.BackendBitset, ipexpr.BackendRangeTable} {
+			if err := ipExpr.SetBackend(b); err != nil {
+				t.Fatalf("SetBackend() failed: %v", err)
+			}
+
+			// the trailing garbage is an error even once the first octet fails
+			for _, s := range []string{"11.garbage", "11.0.0.256", "11.0.0.1.1"} {
+				if got, err := ipExpr.Matches(s); got || err == nil {
+					t.Errorf("%s: Matches(%q) of %s = %v, %v, want an error", b, s, expr, got, err)
+				}
+			}
+		}
+	}
+}
+
+func TestIPExpr_MatchesAllocs(t *testing.T) {
+	ipExpr, err := ipexpr.Parse("10-50.20-200.1,5,10-20,50-100,150-200,250.1-254")
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = ipExpr.Matches("25.100.75.100")
+		_, _ = ipExpr.Matches("25.100.76.100")
+	})
+	if allocs != 0 {
+		t.Errorf("Matches() allocates %v times per run, want 0", allocs)
+	}
+}
+
 // Benchmark tests
 func BenchmarkParse_Simple(b *testing.B) {
 	expr := "192.168.1.1"
@@ -665,6 +894,7 @@ func BenchmarkIPExpr_Matches_Simple(b *testing.B) {
 		b.Fatalf("Parse failed: %v", err)
 	}
 
+	b.ReportAllocs()
 	for b.Loop() {
 		_, _ = ipExpr.Matches("192.168.1.100")
 	}
@@ -676,7 +906,86 @@ func BenchmarkIPExpr_Matches_Complex(b *testing.B) {
 		b.Fatalf("Parse failed: %v", err)
 	}
 
+	b.ReportAllocs()
 	for b.Loop() {
 		_, _ = ipExpr.Matches("25.100.75.100")
 	}
 }
+
+// BenchmarkIPExpr_Matches_EarlyMiss misses on the first octet: the others
+// are still validated, but no longer tested.
+func BenchmarkIPExpr_Matches_EarlyMiss(b *testing.B) {
+	ipExpr, err := ipexpr.Parse("10-50.20-200.1,5,10-20,50-100,150-200,250.1-254")
+	if err != nil {
+		b.Fatalf("Parse failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		_, _ = ipExpr.Matches("192.168.1.1")
+	}
+}
+
+// BenchmarkIPExpr_ParseAndContains is the allocating parse-then-test path
+// Matches used to take, kept as a baseline.
+func BenchmarkIPExpr_ParseAndContains(b *testing.B) {
+	ipExpr, err := ipexpr.Parse("10-50.20-200.1,5,10-20,50-100,150-200,250.1-254")
+	if err != nil {
+		b.Fatalf("Parse failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		addr, _ := ip.Parse("25.100.75.100")
+		_ = ipExpr.Contains(addr)
+	}
+}
+
+// mapResolver resolves attribute atoms from a map of key:value to pattern.
+type mapResolver map[string]string
+
+func (m mapResolver) Resolve(key, value string) (*ipexpr.IPExpr, error) {
+	pattern, ok := m[key+":"+value]
+	if !ok {
+		return nil, fmt.Errorf("unknown %s %s", key, value)
+	}
+	return ipexpr.Parse(pattern)
+}
+
+func TestParseWithOptions_Resolver(t *testing.T) {
+	opts := ipexpr.ParseOptions{Resolver: mapResolver{
+		"country:IT": "2.16-23.*.*",
+		"asn:13335":  "1.1.1.0-1.1.1.255,104.16.0.0-104.23.255.255",
+	}}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"country:IT", "2.16-23.*.*"},
+		{"country:IT,10.0.0.0-10.255.255.255", "2.16-23.*.* | 10.*.*.*"},
+		{"asn:13335, @loopback", "1.1.1.* | 104.16-23.*.* | 127.*.*.*"},
+		{"country:IT | 192.168.*.*", "2.16-23.*.* | 192.168.*.*"},
+		{"!country:IT", "0-1.*.*.* | 2.0-15.*.* | 2.24-255.*.* | 3-255.*.*.*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ipexpr.ParseWithOptions(tt.expr, opts)
+			if err != nil {
+				t.Fatalf("ParseWithOptions() failed: %v", err)
+			}
+			if want := mustParse(t, tt.want); !got.Equal(want) {
+				t.Errorf("ParseWithOptions() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"country:FR", "country:", ":IT", "country:IT:x"} {
+		if _, err := ipexpr.ParseWithOptions(expr, opts); err == nil {
+			t.Errorf("ParseWithOptions(%q) expected error but got none", expr)
+		}
+	}
+	if _, err := ipexpr.Parse("country:IT"); err == nil {
+		t.Errorf("Parse(%q) expected error without a resolver", "country:IT")
+	}
+}
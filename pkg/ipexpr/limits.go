@@ -0,0 +1,133 @@
+package ipexpr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+)
+
+// Feature is a set of pattern features that ParseOptions may forbid, to
+// accept patterns from untrusted sources.
+type Feature int
+
+const (
+	// FeatureWildcardFirstOctet is patterns matching addresses of every
+	// first octet, such as *.0.0.1, 0-255.0.0.1, 0.0.0.0-255.255.255.255 or
+	// !1.2.3.4, however they are written.
+	FeatureWildcardFirstOctet Feature = 1 << iota
+	// FeatureNamedRanges is named ranges, such as @private.
+	FeatureNamedRanges
+	// FeatureAttributes is attribute atoms, such as country:IT.
+	FeatureAttributes
+	// FeatureUnion is patterns separated by |.
+	FeatureUnion
+	// FeatureNegation is patterns preceded by !.
+	FeatureNegation
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureWildcardFirstOctet:
+		return "wildcard first octets"
+	case FeatureNamedRanges:
+		return "named ranges"
+	case FeatureAttributes:
+		return "attribute atoms"
+	case FeatureUnion:
+		return "unions"
+	case FeatureNegation:
+		return "negation"
+	default:
+		return fmt.Sprintf("Feature(%d)", int(f))
+	}
+}
+
+// FeatureError reports a pattern using a feature ParseOptions forbids.
+type FeatureError struct {
+	Feature Feature
+	// Pattern is the part of the pattern using the feature.
+	Pattern string
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("%s are not allowed: %s", e.Feature, e.Pattern)
+}
+
+// Limit is a bound ParseOptions puts on patterns.
+type Limit int
+
+const (
+	// LimitLength bounds the length of patterns (ParseOptions.MaxLength).
+	LimitLength Limit = iota
+	// LimitOctetTerms bounds the terms of octet expressions
+	// (ParseOptions.MaxOctetTerms).
+	LimitOctetTerms
+	// LimitCount bounds the addresses patterns match (ParseOptions.MaxCount).
+	LimitCount
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitLength:
+		return "length"
+	case LimitOctetTerms:
+		return "terms per octet"
+	case LimitCount:
+		return "address count"
+	default:
+		return fmt.Sprintf("Limit(%d)", int(l))
+	}
+}
+
+// LimitError reports a pattern exceeding a bound of ParseOptions.
+type LimitError struct {
+	Limit Limit
+	// Value is the length, number of terms or address count of the pattern.
+	Value uint64
+	// Max is the bound it exceeds.
+	Max uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("pattern %s %d exceeds the limit of %d", e.Limit, e.Value, e.Max)
+}
+
+// checkFeature returns a FeatureError if opts forbid the feature f, used by
+// pattern.
+func (opts ParseOptions) checkFeature(f Feature, pattern string) error {
+	if opts.Forbid&f != 0 {
+		return &FeatureError{Feature: f, Pattern: strings.TrimSpace(pattern)}
+	}
+	return nil
+}
+
+// checkOctetTerms checks the number of terms of an octet expression before
+// it is parsed.
+func (opts ParseOptions) checkOctetTerms(part string) error {
+	if opts.MaxOctetTerms <= 0 {
+		return nil
+	}
+	if n := strings.Count(part, ",") + 1; n > opts.MaxOctetTerms {
+		return &LimitError{Limit: LimitOctetTerms, Value: uint64(n), Max: uint64(opts.MaxOctetTerms)}
+	}
+	return nil
+}
+
+// checkFirstOctet checks the first octets of the addresses a parsed pattern
+// matches, over all of its terms.
+func (opts ParseOptions) checkFirstOctet(e *IPExpr, pattern string) error {
+	if opts.Forbid&FeatureWildcardFirstOctet == 0 {
+		return nil
+	}
+	var first bitsvector.OctetBits
+	for _, t := range e.terms() {
+		if termCount(t) != 0 {
+			first = first.Union(t[0])
+		}
+	}
+	if first == bitsvector.AllSet {
+		return opts.checkFeature(FeatureWildcardFirstOctet, pattern)
+	}
+	return nil
+}
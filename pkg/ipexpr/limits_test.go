@@ -0,0 +1,86 @@
+package ipexpr_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestParseWithOptions_Limits(t *testing.T) {
+	tests := []struct {
+		expr  string
+		opts  ipexpr.ParseOptions
+		limit ipexpr.Limit
+		value uint64
+	}{
+		{"10.0.0.1", ipexpr.ParseOptions{MaxLength: 7}, ipexpr.LimitLength, 8},
+		{strings.Repeat("1", 1<<20), ipexpr.ParseOptions{MaxLength: 1024}, ipexpr.LimitLength, 1 << 20},
+		{"10.0.1,2,3,4.*", ipexpr.ParseOptions{MaxOctetTerms: 3}, ipexpr.LimitOctetTerms, 4},
+		{"10.0." + strings.Repeat("1,", 1000) + "1.*", ipexpr.ParseOptions{MaxOctetTerms: 8}, ipexpr.LimitOctetTerms, 1001},
+		{"10.0.*.*", ipexpr.ParseOptions{MaxCount: 256}, ipexpr.LimitCount, 1 << 16},
+		{"10.0.0.0-10.0.1.255", ipexpr.ParseOptions{MaxCount: 256}, ipexpr.LimitCount, 512},
+		{"!10.*.*.*", ipexpr.ParseOptions{MaxCount: 1 << 24}, ipexpr.LimitCount, 1<<32 - 1<<24},
+		{"10.0.0.* | 10.0.1.*", ipexpr.ParseOptions{MaxCount: 256}, ipexpr.LimitCount, 512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr[:min(len(tt.expr), 32)], func(t *testing.T) {
+			_, err := ipexpr.ParseWithOptions(tt.expr, tt.opts)
+			var le *ipexpr.LimitError
+			if !errors.As(err, &le) {
+				t.Fatalf("ParseWithOptions() error = %v, want a *LimitError", err)
+			}
+			if le.Limit != tt.limit || le.Value != tt.value {
+				t.Errorf("ParseWithOptions() error = %s %d, want %s %d", le.Limit, le.Value, tt.limit, tt.value)
+			}
+		})
+	}
+
+	// patterns within the limits parse as usual
+	opts := ipexpr.ParseOptions{MaxLength: 32, MaxOctetTerms: 3, MaxCount: 512}
+	for _, expr := range []string{"10.0.0.1", "10.0.1,2.*", "10.0.0.0-10.0.1.255", "10.0.0.1-3,5,7"} {
+		if _, err := ipexpr.ParseWithOptions(expr, opts); err != nil {
+			t.Errorf("ParseWithOptions(%q) failed: %v", expr, err)
+		}
+	}
+}
+
+func TestParseWithOptions_Forbid(t *testing.T) {
+	tests := []struct {
+		expr    string
+		feature ipexpr.Feature
+	}{
+		{"*.0.0.1", ipexpr.FeatureWildcardFirstOctet},
+		{"0-255.0.0.1", ipexpr.FeatureWildcardFirstOctet},
+		{"0-100,101-255.0.0.1", ipexpr.FeatureWildcardFirstOctet},
+		{"10.0.0.1 | *.*.*.*", ipexpr.FeatureWildcardFirstOctet},
+		{"0.0.0.0-255.255.255.255", ipexpr.FeatureWildcardFirstOctet},
+		{"0-127.*.*.* | 128-255.0.0.1", ipexpr.FeatureWildcardFirstOctet},
+		{"!1.2.3.4", ipexpr.FeatureWildcardFirstOctet},
+		{"@bogon | !@bogon", ipexpr.FeatureWildcardFirstOctet},
+		{"@private", ipexpr.FeatureNamedRanges},
+		{"10.0.0.1,@loopback", ipexpr.FeatureNamedRanges},
+		{"country:IT", ipexpr.FeatureAttributes},
+		{"10.0.0.1 | 10.0.0.2", ipexpr.FeatureUnion},
+		{"!10.*.*.*", ipexpr.FeatureNegation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ipexpr.ParseWithOptions(tt.expr, ipexpr.ParseOptions{Forbid: tt.feature})
+			var fe *ipexpr.FeatureError
+			if !errors.As(err, &fe) {
+				t.Fatalf("ParseWithOptions() error = %v, want a *FeatureError", err)
+			}
+			if fe.Feature != tt.feature {
+				t.Errorf("ParseWithOptions() error feature = %s, want %s", fe.Feature, tt.feature)
+			}
+		})
+	}
+
+	for _, expr := range []string{"10.*.*.*", "1-255.0.0.0", "0.0.0.0-254.255.255.255", "!0.*.*.*"} {
+		if _, err := ipexpr.ParseWithOptions(expr, ipexpr.ParseOptions{Forbid: ipexpr.FeatureWildcardFirstOctet}); err != nil {
+			t.Errorf("ParseWithOptions(%q) failed: %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package ipexpr
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// ConflictPolicy decides which entry of a Map wins when the patterns of
+// several entries match an address.
+type ConflictPolicy int
+
+const (
+	// ConflictFirstWins picks the first matching entry, in the order the
+	// entries were given.
+	ConflictFirstWins ConflictPolicy = iota
+	// ConflictMostSpecific picks the matching entry whose pattern matches
+	// the fewest addresses, so 10.1.2.* wins over 10.*.*.*. Ties go to the
+	// first entry.
+	ConflictMostSpecific
+	// ConflictPriority picks the matching entry of highest Priority. Ties
+	// go to the first entry.
+	ConflictPriority
+)
+
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictFirstWins:
+		return "first-wins"
+	case ConflictMostSpecific:
+		return "most-specific"
+	case ConflictPriority:
+		return "priority"
+	default:
+		return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+	}
+}
+
+// MapEntry associates the addresses matched by Expr with Value.
+type MapEntry[V any] struct {
+	Expr  *IPExpr
+	Value V
+	// Priority ranks the entry under ConflictPriority, the highest first.
+	Priority int
+}
+
+// MapOptions configures NewMap.
+type MapOptions struct {
+	Policy ConflictPolicy
+	// Table configures the index the entries are compiled into.
+	Table TableOptions
+}
+
+// Map associates values with patterns, such as the datacenter or the team
+// owning address ranges. The entries are ranked by the conflict policy and
+// compiled into a Table, so a lookup costs the same however many entries
+// the map holds.
+type Map[V any] struct {
+	policy  ConflictPolicy
+	entries []MapEntry[V]
+	table   *Table
+	// overlaps holds, for every entry, the later ones sharing addresses with
+	// it, in ascending order.
+	overlaps [][]int
+}
+
+// NewMap compiles entries into a Map. Besides the Table, it indexes the
+// entries sharing addresses for LookupAll by sweeping the terms of all the
+// entries in address order: only the terms whose lowest and highest
+// addresses interleave are intersected, so the time this takes grows with
+// the number of terms and of those interleaving ones, in the worst case
+// quadratically when every entry spans most of the address space.
+func NewMap[V any](entries []MapEntry[V], opts MapOptions) (*Map[V], error) {
+	if opts.Policy < ConflictFirstWins || opts.Policy > ConflictPriority {
+		return nil, fmt.Errorf("unknown conflict policy %s", opts.Policy)
+	}
+	for i, e := range entries {
+		if e.Expr == nil {
+			return nil, fmt.Errorf("entry %d has no expression", i)
+		}
+	}
+
+	ranked := slices.Clone(entries)
+	switch opts.Policy {
+	case ConflictMostSpecific:
+		slices.SortStableFunc(ranked, func(a, b MapEntry[V]) int { return cmp.Compare(a.Expr.Count(), b.Expr.Count()) })
+	case ConflictPriority:
+		slices.SortStableFunc(ranked, func(a, b MapEntry[V]) int { return cmp.Compare(b.Priority, a.Priority) })
+	}
+
+	exprs := make([]*IPExpr, len(ranked))
+	for i, e := range ranked {
+		exprs[i] = e.Expr
+	}
+	t, err := NewTable(exprs, opts.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Map[V]{policy: opts.Policy, entries: ranked, table: t, overlaps: overlapIndex(exprs)}, nil
+}
+
+// overlapIndex returns, for every expression, the later ones sharing
+// addresses with it. Its terms are swept in the order of their lowest
+// address, each being intersected with the terms whose highest address is
+// not below it yet.
+func overlapIndex(exprs []*IPExpr) [][]int {
+	type bounded struct {
+		index       int
+		t           term
+		first, last uint32
+	}
+	var bs []bounded
+	for i, e := range exprs {
+		for _, t := range e.terms() {
+			if first, last, ok := termBounds(t); ok {
+				bs = append(bs, bounded{i, t, first, last})
+			}
+		}
+	}
+	slices.SortFunc(bs, func(a, b bounded) int { return cmp.Compare(a.first, b.first) })
+
+	overlaps := make([][]int, len(exprs))
+	seen := make(map[[2]int]bool)
+	var open []bounded
+	for _, b := range bs {
+		open = slices.DeleteFunc(open, func(o bounded) bool { return o.last < b.first })
+		for _, o := range open {
+			pair := [2]int{min(o.index, b.index), max(o.index, b.index)}
+			if o.index == b.index || seen[pair] || termCount(termIntersect(o.t, b.t)) == 0 {
+				continue
+			}
+			seen[pair] = true
+			overlaps[pair[0]] = append(overlaps[pair[0]], pair[1])
+		}
+		open = append(open, b)
+	}
+	for _, o := range overlaps {
+		slices.Sort(o)
+	}
+	return overlaps
+}
+
+// Lookup returns the value of the entry winning addr, false if no entry
+// matches it. IPv4-mapped IPv6 addresses are unmapped; any other IPv6
+// address never matches.
+func (m *Map[V]) Lookup(addr netip.Addr) (V, bool) {
+	e, ok := m.LookupEntry(addr)
+	return e.Value, ok
+}
+
+// LookupEntry is Lookup returning the whole winning entry.
+func (m *Map[V]) LookupEntry(addr netip.Addr) (MapEntry[V], bool) {
+	i, ok := m.table.Lookup(addr)
+	if !ok {
+		return MapEntry[V]{}, false
+	}
+	return m.entries[i], true
+}
+
+// LookupString is Lookup for a dotted-quad address, parsed without
+// allocating.
+func (m *Map[V]) LookupString(s string) (V, bool, error) {
+	i, ok, err := m.table.LookupString(s)
+	if err != nil || !ok {
+		var zero V
+		return zero, false, err
+	}
+	return m.entries[i].Value, true, nil
+}
+
+// LookupAll returns the values of every entry matching addr, the winning one
+// first and the others in the order of the conflict policy. Only the entries
+// sharing addresses with the winning one are tested: an entry matching addr
+// shares at least addr with it.
+func (m *Map[V]) LookupAll(addr netip.Addr) []V {
+	i, ok := m.table.Lookup(addr)
+	if !ok {
+		return nil
+	}
+	values := []V{m.entries[i].Value}
+	for _, j := range m.overlaps[i] {
+		if m.entries[j].Expr.ContainsAddr(addr) {
+			values = append(values, m.entries[j].Value)
+		}
+	}
+	return values
+}
+
+// Len returns the number of entries of the map.
+func (m *Map[V]) Len() int {
+	return len(m.entries)
+}
+
+// Policy returns the conflict policy of the map.
+func (m *Map[V]) Policy() ConflictPolicy {
+	return m.policy
+}
@@ -0,0 +1,192 @@
+package ipexpr_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+type site struct {
+	dc, team string
+}
+
+func mustMap(t testing.TB, policy ipexpr.ConflictPolicy, entries ...ipexpr.MapEntry[site]) *ipexpr.Map[site] {
+	t.Helper()
+	m, err := ipexpr.NewMap(entries, ipexpr.MapOptions{Policy: policy})
+	if err != nil {
+		t.Fatalf("NewMap() failed: %v", err)
+	}
+	return m
+}
+
+func TestMap_Lookup(t *testing.T) {
+	entries := []ipexpr.MapEntry[site]{
+		{Expr: mustParse(t, "10.*.*.*"), Value: site{"fra", "infra"}, Priority: 1},
+		{Expr: mustParse(t, "10.1.*.*"), Value: site{"fra", "payments"}, Priority: 3},
+		{Expr: mustParse(t, "10.1.2.*"), Value: site{"fra", "search"}, Priority: 2},
+		{Expr: mustParse(t, "10.1.2.0-10.1.3.255"), Value: site{"fra", "ml"}, Priority: 2},
+		{Expr: mustParse(t, "192.168.*.1"), Value: site{"lab", "gateways"}},
+	}
+
+	tests := []struct {
+		addr string
+		want map[ipexpr.ConflictPolicy]string
+	}{
+		{"10.9.9.9", map[ipexpr.ConflictPolicy]string{ipexpr.ConflictFirstWins: "infra", ipexpr.ConflictMostSpecific: "infra", ipexpr.ConflictPriority: "infra"}},
+		{"10.1.9.9", map[ipexpr.ConflictPolicy]string{ipexpr.ConflictFirstWins: "infra", ipexpr.ConflictMostSpecific: "payments", ipexpr.ConflictPriority: "payments"}},
+		{"10.1.2.3", map[ipexpr.ConflictPolicy]string{ipexpr.ConflictFirstWins: "infra", ipexpr.ConflictMostSpecific: "search", ipexpr.ConflictPriority: "payments"}},
+		{"10.1.3.3", map[ipexpr.ConflictPolicy]string{ipexpr.ConflictFirstWins: "infra", ipexpr.ConflictMostSpecific: "ml", ipexpr.ConflictPriority: "payments"}},
+		{"192.168.7.1", map[ipexpr.ConflictPolicy]string{ipexpr.ConflictFirstWins: "gateways", ipexpr.ConflictMostSpecific: "gateways", ipexpr.ConflictPriority: "gateways"}},
+		{"192.168.7.2", nil},
+		{"2001:db8::1", nil},
+	}
+
+	for _, policy := range []ipexpr.ConflictPolicy{ipexpr.ConflictFirstWins, ipexpr.ConflictMostSpecific, ipexpr.ConflictPriority} {
+		m := mustMap(t, policy, entries...)
+		for _, tt := range tests {
+			t.Run(policy.String()+"/"+tt.addr, func(t *testing.T) {
+				got, ok := m.Lookup(netip.MustParseAddr(tt.addr))
+				want, wantOK := tt.want[policy]
+				if ok != wantOK || got.team != want {
+					t.Errorf("Lookup() = %v, %v, want %s, %v", got, ok, want, wantOK)
+				}
+				if _, ok, err := m.LookupString(tt.addr); err == nil && ok != wantOK {
+					t.Errorf("LookupString() = %v, want %v", ok, wantOK)
+				}
+			})
+		}
+	}
+}
+
+func TestMap_LookupAll(t *testing.T) {
+	m := mustMap(t, ipexpr.ConflictMostSpecific,
+		ipexpr.MapEntry[site]{Expr: mustParse(t, "10.*.*.*"), Value: site{"fra", "infra"}},
+		ipexpr.MapEntry[site]{Expr: mustParse(t, "10.1.2.*"), Value: site{"fra", "search"}},
+		ipexpr.MapEntry[site]{Expr: mustParse(t, "*.*.*.1"), Value: site{"", "gateways"}},
+		ipexpr.MapEntry[site]{Expr: mustParse(t, "10.1.*.*"), Value: site{"fra", "payments"}},
+	)
+
+	tests := []struct {
+		addr string
+		want []string
+	}{
+		{"10.1.2.1", []string{"search", "payments", "infra", "gateways"}},
+		{"10.1.2.2", []string{"search", "payments", "infra"}},
+		{"10.2.0.1", []string{"infra", "gateways"}},
+		{"8.8.8.1", []string{"gateways"}},
+		{"8.8.8.8", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			var got []string
+			for _, v := range m.LookupAll(netip.MustParseAddr(tt.addr)) {
+				got = append(got, v.team)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("LookupAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMap_Random compares lookups against a scan of the entries ranked by
+// priority.
+func TestMap_Random(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(47, 47))
+	var entries []ipexpr.MapEntry[int]
+	for i := range 40 {
+		e := mustParse(t, randomExpr(rnd))
+		entries = append(entries, ipexpr.MapEntry[int]{Expr: e, Value: i, Priority: rnd.IntN(5)})
+	}
+	m, err := ipexpr.NewMap(entries, ipexpr.MapOptions{Policy: ipexpr.ConflictPriority})
+	if err != nil {
+		t.Fatalf("NewMap() failed: %v", err)
+	}
+
+	ranked := slices.Clone(entries)
+	slices.SortStableFunc(ranked, func(a, b ipexpr.MapEntry[int]) int { return b.Priority - a.Priority })
+	for range 5000 {
+		addr := netip.AddrFrom4([4]byte{byte(rnd.IntN(4)), byte(rnd.IntN(8)), byte(rnd.IntN(256)), byte(rnd.IntN(256))})
+		var want []int
+		for _, e := range ranked {
+			if e.Expr.ContainsAddr(addr) {
+				want = append(want, e.Value)
+			}
+		}
+		got := m.LookupAll(addr)
+		if !slices.Equal(got, want) {
+			t.Fatalf("LookupAll(%s) = %v, want %v", addr, got, want)
+		}
+		v, ok := m.Lookup(addr)
+		if ok != (len(want) > 0) || ok && v != want[0] {
+			t.Fatalf("Lookup(%s) = %v, %v, want %v", addr, v, ok, want)
+		}
+	}
+}
+
+func TestMap_LookupAllMany(t *testing.T) {
+	// disjoint /24s under a /8: indexing the overlaps does not test every
+	// pair of entries
+	var entries []ipexpr.MapEntry[int]
+	for i := range 20000 {
+		e := mustParse(t, fmt.Sprintf("10.%d.%d.*", i/256, i%256))
+		entries = append(entries, ipexpr.MapEntry[int]{Expr: e, Value: i})
+	}
+	entries = append(entries, ipexpr.MapEntry[int]{Expr: mustParse(t, "10.*.*.*"), Value: -1})
+	m, err := ipexpr.NewMap(entries, ipexpr.MapOptions{Policy: ipexpr.ConflictMostSpecific})
+	if err != nil {
+		t.Fatalf("NewMap() failed: %v", err)
+	}
+
+	for addr, want := range map[string][]int{
+		"10.0.0.1":    {0, -1},
+		"10.78.31.9":  {78*256 + 31, -1},
+		"10.200.0.1":  {-1},
+		"192.168.0.1": nil,
+	} {
+		if got := m.LookupAll(netip.MustParseAddr(addr)); !slices.Equal(got, want) {
+			t.Errorf("LookupAll(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestMap_Errors(t *testing.T) {
+	if _, err := ipexpr.NewMap([]ipexpr.MapEntry[int]{{Value: 1}}, ipexpr.MapOptions{}); err == nil {
+		t.Errorf("NewMap() accepted an entry without expression")
+	}
+	if _, err := ipexpr.NewMap([]ipexpr.MapEntry[int]{}, ipexpr.MapOptions{Policy: 7}); err == nil {
+		t.Errorf("NewMap() accepted an unknown policy")
+	}
+
+	m, err := ipexpr.NewMap([]ipexpr.MapEntry[int]{}, ipexpr.MapOptions{})
+	if err != nil {
+		t.Fatalf("NewMap() failed: %v", err)
+	}
+	if _, _, err := m.LookupString("10.0.0"); err == nil {
+		t.Errorf("LookupString() accepted an invalid address")
+	}
+	if m.Len() != 0 || m.LookupAll(netip.MustParseAddr("10.0.0.1")) != nil {
+		t.Errorf("empty map matches")
+	}
+}
+
+func BenchmarkMap_Lookup(b *testing.B) {
+	var entries []ipexpr.MapEntry[int]
+	for i, e := range tableRuleSet(b, 1000) {
+		entries = append(entries, ipexpr.MapEntry[int]{Expr: e, Value: i})
+	}
+	m, err := ipexpr.NewMap(entries, ipexpr.MapOptions{Policy: ipexpr.ConflictMostSpecific})
+	if err != nil {
+		b.Fatalf("NewMap() failed: %v", err)
+	}
+	addr := netip.MustParseAddr("10.200.3.4")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		_, _ = m.Lookup(addr)
+	}
+}
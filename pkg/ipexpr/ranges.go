@@ -0,0 +1,275 @@
+package ipexpr
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"net/netip"
+	"slices"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+)
+
+// Range is an inclusive range of contiguous IPv4 addresses.
+type Range struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+func (r Range) String() string {
+	if r.First == r.Last {
+		return r.First.String()
+	}
+	return r.First.String() + "-" + r.Last.String()
+}
+
+// Count returns the number of addresses in the range.
+func (r Range) Count() uint64 {
+	return uint64(addrToUint32(r.Last)) - uint64(addrToUint32(r.First)) + 1
+}
+
+// Prefixes returns the minimal list of CIDR prefixes covering the range.
+func (r Range) Prefixes() []netip.Prefix {
+	var out []netip.Prefix
+	lo, hi := uint64(addrToUint32(r.First)), uint64(addrToUint32(r.Last))
+	for lo <= hi {
+		// largest aligned block starting at lo that does not overflow hi
+		size := uint64(1) << 32
+		if lo != 0 {
+			size = lo & -lo
+		}
+		for lo+size-1 > hi {
+			size >>= 1
+		}
+		out = append(out, netip.PrefixFrom(uint32ToAddr(uint32(lo)), 32-bits.TrailingZeros64(size)))
+		lo += size
+	}
+	return out
+}
+
+// FromRanges returns the expression matching the union of ranges, which may
+// overlap. Ranges that are not aligned on octet boundaries make expressions
+// of several terms, as they do in patterns.
+func FromRanges(ranges ...Range) (*IPExpr, error) {
+	spans := make([][2]uint32, 0, len(ranges))
+	for _, r := range ranges {
+		if !r.First.Is4() || !r.Last.Is4() {
+			return nil, fmt.Errorf("range %s is not IPv4", r)
+		}
+		if r.First.Compare(r.Last) > 0 {
+			return nil, fmt.Errorf("invalid address range %s: start is after end", r)
+		}
+		spans = append(spans, [2]uint32{addrToUint32(r.First), addrToUint32(r.Last)})
+	}
+
+	e := fromSpans(spans)
+	_ = e.SetBackend(BackendAuto)
+	return e, nil
+}
+
+// Ranges returns the addresses matched by the expression as maximal ranges,
+// in ascending order.
+func (ie *IPExpr) Ranges() iter.Seq[Range] {
+	return Ranges(ie)
+}
+
+// Prefixes returns the addresses matched by the expression as CIDR prefixes,
+// in ascending order.
+func (ie *IPExpr) Prefixes() iter.Seq[netip.Prefix] {
+	return Prefixes(ie)
+}
+
+// Ranges returns the union of the addresses matched by the expressions as
+// maximal ranges, in ascending order. Expressions may overlap.
+//
+// Addresses are never enumerated one by one: every expression only yields
+// one span per combination of its leading octet values.
+func Ranges(exprs ...*IPExpr) iter.Seq[Range] {
+	return func(yield func(Range) bool) {
+		var pending [2]uint32
+		started := false
+		for span := range mergeSpans(exprs) {
+			if started && uint64(span[0]) <= uint64(pending[1])+1 {
+				pending[1] = max(pending[1], span[1])
+				continue
+			}
+			if started && !yield(newRange(pending)) {
+				return
+			}
+			pending, started = span, true
+		}
+		if started {
+			yield(newRange(pending))
+		}
+	}
+}
+
+// Prefixes returns the union of the addresses matched by the expressions as
+// CIDR prefixes, in ascending order.
+func Prefixes(exprs ...*IPExpr) iter.Seq[netip.Prefix] {
+	return func(yield func(netip.Prefix) bool) {
+		for r := range Ranges(exprs...) {
+			for _, p := range r.Prefixes() {
+				if !yield(p) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// spans yields the contiguous spans of addresses matched by the expression in
+// ascending order. Adjacent spans are not merged.
+func (ie *IPExpr) spans(yield func([2]uint32) bool) {
+	if ie.rest != nil {
+		mergeSpans(ie.Terms())(yield)
+		return
+	}
+	if ie.Count() == 0 {
+		return
+	}
+
+	// octets after the last partial one are full and collapse into the span
+	last := 3
+	for last >= 0 && ie.octets[last] == bitsvector.AllSet {
+		last--
+	}
+	if last < 0 {
+		yield([2]uint32{0, math.MaxUint32})
+		return
+	}
+
+	shift := uint(8 * (3 - last))
+	its := ie.octets[last].Intervals()
+
+	var walk func(k int, prefix uint32) bool
+	walk = func(k int, prefix uint32) bool {
+		if k == last {
+			for _, it := range its {
+				lo := (prefix<<8 | uint32(it[0])) << shift
+				hi := (prefix<<8|uint32(it[1]))<<shift | (1<<shift - 1)
+				if !yield([2]uint32{lo, hi}) {
+					return false
+				}
+			}
+			return true
+		}
+		for v := range ie.octets[k].All() {
+			if !walk(k+1, prefix<<8|uint32(v)) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(0, 0)
+}
+
+// mergeSpans merges the sorted spans of several expressions into a single
+// stream sorted by first address. An expression is only pulled from once the
+// stream reaches its first address, so that merging many disjoint ones, such
+// as the terms of a long list of ranges, takes time linear in their spans.
+func mergeSpans(exprs []*IPExpr) iter.Seq[[2]uint32] {
+	return func(yield func([2]uint32) bool) {
+		if len(exprs) == 1 {
+			exprs[0].spans(yield)
+			return
+		}
+
+		type pending struct {
+			expr  *IPExpr
+			first uint32
+		}
+		var ps []pending
+		for _, e := range exprs {
+			if first, ok := e.first(); ok {
+				ps = append(ps, pending{e, first})
+			}
+		}
+		slices.SortStableFunc(ps, func(a, b pending) int { return cmp.Compare(a.first, b.first) })
+
+		var cs cursors
+		defer func() {
+			for _, c := range cs {
+				c.stop()
+			}
+		}()
+
+		for len(ps) > 0 || len(cs) > 0 {
+			for len(ps) > 0 && (len(cs) == 0 || ps[0].first <= cs[0].cur[0]) {
+				next, stop := iter.Pull(ps[0].expr.spans)
+				ps = ps[1:]
+				if v, ok := next(); ok {
+					heap.Push(&cs, &cursor{next: next, stop: stop, cur: v})
+				} else {
+					stop()
+				}
+			}
+
+			c := cs[0]
+			if !yield(c.cur) {
+				return
+			}
+			if v, ok := c.next(); ok {
+				c.cur = v
+				heap.Fix(&cs, 0)
+			} else {
+				c.stop()
+				heap.Pop(&cs)
+			}
+		}
+	}
+}
+
+// cursor is the next span of an expression being merged.
+type cursor struct {
+	next func() ([2]uint32, bool)
+	stop func()
+	cur  [2]uint32
+}
+
+// cursors is a heap of cursors ordered by the first address of their span.
+type cursors []*cursor
+
+func (h cursors) Len() int           { return len(h) }
+func (h cursors) Less(i, j int) bool { return h[i].cur[0] < h[j].cur[0] }
+func (h cursors) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *cursors) Push(x any)        { *h = append(*h, x.(*cursor)) }
+
+func (h *cursors) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// first returns the lowest address matched by the expression, unless it
+// matches none.
+func (ie *IPExpr) first() (uint32, bool) {
+	var lowest uint32
+	found := false
+	for _, t := range ie.terms() {
+		if v, _, ok := termBounds(t); ok && (!found || v < lowest) {
+			lowest, found = v, true
+		}
+	}
+	return lowest, found
+}
+
+func newRange(span [2]uint32) Range {
+	return Range{First: uint32ToAddr(span[0]), Last: uint32ToAddr(span[1])}
+}
+
+func addrToUint32(a netip.Addr) uint32 {
+	b := a.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToAddr(v uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return netip.AddrFrom4(b)
+}
@@ -0,0 +1,142 @@
+package ipexpr_test
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestIPExpr_Ranges(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"192.168.1.1", []string{"192.168.1.1"}},
+		{"192.168.1.*", []string{"192.168.1.0-192.168.1.255"}},
+		{"10.0-1.*.*", []string{"10.0.0.0-10.1.255.255"}},
+		{"10.0,255.*.*", []string{"10.0.0.0-10.0.255.255", "10.255.0.0-10.255.255.255"}},
+		{"10-11.0,255.*.*", []string{
+			"10.0.0.0-10.0.255.255",
+			"10.255.0.0-11.0.255.255",
+			"11.255.0.0-11.255.255.255",
+		}},
+		{"192.168.1,2.1-3,10", []string{
+			"192.168.1.1-192.168.1.3",
+			"192.168.1.10",
+			"192.168.2.1-192.168.2.3",
+			"192.168.2.10",
+		}},
+		{"*.*.*.*", []string{"0.0.0.0-255.255.255.255"}},
+		{"192.168.1.5-3", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			var got []string
+			for r := range mustParse(t, tt.expr).Ranges() {
+				got = append(got, r.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Ranges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRanges_Union(t *testing.T) {
+	exprs := []*ipexpr.IPExpr{
+		mustParse(t, "10.0.1.128-255"),
+		mustParse(t, "10.0.0.*"),
+		mustParse(t, "10.0.1.0-200"),
+		mustParse(t, "10.0.3.*"),
+	}
+
+	var got []string
+	for r := range ipexpr.Ranges(exprs...) {
+		got = append(got, r.String())
+	}
+	want := []string{"10.0.0.0-10.0.1.255", "10.0.3.0-10.0.3.255"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Ranges() = %v, want %v", got, want)
+	}
+}
+
+func TestIPExpr_Prefixes(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"10.*.*.*", []string{"10.0.0.0/8"}},
+		{"172.16-31.*.*", []string{"172.16.0.0/12"}},
+		{"192.168.1.1-254", []string{
+			"192.168.1.1/32", "192.168.1.2/31", "192.168.1.4/30", "192.168.1.8/29",
+			"192.168.1.16/28", "192.168.1.32/27", "192.168.1.64/26", "192.168.1.128/26",
+			"192.168.1.192/27", "192.168.1.224/28", "192.168.1.240/29", "192.168.1.248/30",
+			"192.168.1.252/31", "192.168.1.254/32",
+		}},
+		{"*.*.*.*", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", []string{"255.255.255.254/32"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			var got []string
+			for p := range mustParse(t, tt.expr).Prefixes() {
+				got = append(got, p.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Prefixes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRange_Count(t *testing.T) {
+	r := ipexpr.Range{
+		First: netip.MustParseAddr("0.0.0.0"),
+		Last:  netip.MustParseAddr("255.255.255.255"),
+	}
+	if got := r.Count(); got != 1<<32 {
+		t.Errorf("Count() = %d, want %d", got, uint64(1)<<32)
+	}
+}
+
+func TestFromRanges(t *testing.T) {
+	tests := []struct {
+		ranges []string
+		want   string
+	}{
+		{[]string{"10.0.0.0-10.255.255.255"}, "10.*.*.*"},
+		{[]string{"10.0.0.200-10.0.1.50", "10.0.1.0-10.0.1.255"}, "10.0.0.200-10.0.1.255"},
+		{[]string{"192.168.1.0-192.168.1.255", "10.0.0.0-10.0.0.255"}, "10.0.0.* | 192.168.1.*"},
+		{nil, "1-0.1-0.1-0.1-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			var ranges []ipexpr.Range
+			for _, s := range tt.ranges {
+				first, last, _ := strings.Cut(s, "-")
+				ranges = append(ranges, ipexpr.Range{First: netip.MustParseAddr(first), Last: netip.MustParseAddr(last)})
+			}
+			got, err := ipexpr.FromRanges(ranges...)
+			if err != nil {
+				t.Fatalf("FromRanges() failed: %v", err)
+			}
+			if want := mustParse(t, tt.want); !got.Equal(want) {
+				t.Errorf("FromRanges() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	for _, r := range []ipexpr.Range{
+		{First: netip.MustParseAddr("10.0.0.2"), Last: netip.MustParseAddr("10.0.0.1")},
+		{First: netip.MustParseAddr("::1"), Last: netip.MustParseAddr("::2")},
+	} {
+		if _, err := ipexpr.FromRanges(r); err == nil {
+			t.Errorf("FromRanges(%s) expected error but got none", r)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package ipexpr
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+// Category is a kind of special-purpose addresses. Every category is a named
+// range, usable in patterns as @ followed by its name, e.g. @private, and
+// matched by the expression returned by its Expr method.
+type Category string
+
+const (
+	// ThisNetwork is 0.0.0.0/8, addresses of this host on this network
+	// (RFC 791, RFC 1122).
+	ThisNetwork Category = "this-network"
+	// Private is the private-use space of RFC 1918.
+	Private Category = "private"
+	// Shared is the shared address space of RFC 6598, used by carrier-grade
+	// NAT. It is also named @cgnat in patterns.
+	Shared Category = "shared"
+	// Loopback is 127.0.0.0/8 (RFC 1122).
+	Loopback Category = "loopback"
+	// LinkLocal is 169.254.0.0/16 (RFC 3927).
+	LinkLocal Category = "link-local"
+	// Protocol is 192.0.0.0/24, reserved for IETF protocol assignments
+	// (RFC 6890).
+	Protocol Category = "protocol"
+	// Documentation is the TEST-NET-1, -2 and -3 blocks of RFC 5737.
+	Documentation Category = "documentation"
+	// Anycast is the globally reachable anycast services of AS112
+	// (RFC 7534, RFC 7535) and AMT (RFC 7450).
+	Anycast Category = "anycast"
+	// Benchmarking is 198.18.0.0/15 (RFC 2544).
+	Benchmarking Category = "benchmarking"
+	// Multicast is 224.0.0.0/4 (RFC 5771).
+	Multicast Category = "multicast"
+	// Reserved is 240.0.0.0/4, reserved for future use (RFC 1112).
+	Reserved Category = "reserved"
+	// Broadcast is the limited broadcast address 255.255.255.255
+	// (RFC 919, RFC 8190).
+	Broadcast Category = "broadcast"
+
+	// Bogon is not the category of a block but the union of the ranges
+	// that must never be seen on the public Internet, as listed by Team
+	// Cymru: every category but Anycast and Broadcast, which 240.0.0.0/4
+	// covers.
+	Bogon Category = "bogon"
+)
+
+// Categories lists the categories of special-purpose blocks, in address
+// order of their first block.
+var Categories = []Category{
+	ThisNetwork, Private, Shared, Loopback, LinkLocal, Protocol, Documentation,
+	Anycast, Benchmarking, Multicast, Reserved, Broadcast,
+}
+
+// SpecialBlock is an entry of the IANA IPv4 Special-Purpose Address Registry
+// (RFC 6890), or of the IANA IPv4 Multicast Address Space Registry for
+// 224.0.0.0/4. The boolean attributes are the ones of the registry: whether
+// an address of the block is valid as the source or destination of a packet,
+// whether routers may forward such packets, whether it is globally reachable
+// and whether it is reserved by a protocol specification.
+type SpecialBlock struct {
+	Prefix   netip.Prefix
+	Name     string
+	Category Category
+	// RFC references the specifications defining the block, e.g. "RFC 1918".
+	RFC      []string
+	Registry string
+
+	Source             bool
+	Destination        bool
+	Forwardable        bool
+	GloballyReachable  bool
+	ReservedByProtocol bool
+}
+
+const (
+	specialRegistry   = "iana-ipv4-special-registry"
+	multicastRegistry = "multicast-addresses"
+)
+
+// specialBlocks is the registry, sorted by prefix. Entries nested in another
+// one, such as 0.0.0.0/32 in 0.0.0.0/8, follow it.
+var specialBlocks = []SpecialBlock{
+	{netip.MustParsePrefix("0.0.0.0/8"), "This network", ThisNetwork, []string{"RFC 791"}, specialRegistry, true, false, false, false, true},
+	{netip.MustParsePrefix("0.0.0.0/32"), "This host on this network", ThisNetwork, []string{"RFC 1122"}, specialRegistry, true, false, false, false, true},
+	{netip.MustParsePrefix("10.0.0.0/8"), "Private-Use", Private, []string{"RFC 1918"}, specialRegistry, true, true, true, false, false},
+	{netip.MustParsePrefix("100.64.0.0/10"), "Shared Address Space", Shared, []string{"RFC 6598"}, specialRegistry, true, true, true, false, false},
+	{netip.MustParsePrefix("127.0.0.0/8"), "Loopback", Loopback, []string{"RFC 1122"}, specialRegistry, false, false, false, false, true},
+	{netip.MustParsePrefix("169.254.0.0/16"), "Link Local", LinkLocal, []string{"RFC 3927"}, specialRegistry, true, true, false, false, true},
+	{netip.MustParsePrefix("172.16.0.0/12"), "Private-Use", Private, []string{"RFC 1918"}, specialRegistry, true, true, true, false, false},
+	{netip.MustParsePrefix("192.0.0.0/24"), "IETF Protocol Assignments", Protocol, []string{"RFC 6890"}, specialRegistry, false, false, false, false, false},
+	{netip.MustParsePrefix("192.0.0.0/29"), "IPv4 Service Continuity Prefix", Protocol, []string{"RFC 7335"}, specialRegistry, true, true, true, false, false},
+	{netip.MustParsePrefix("192.0.0.8/32"), "IPv4 dummy address", Protocol, []string{"RFC 7600"}, specialRegistry, true, false, false, false, false},
+	{netip.MustParsePrefix("192.0.0.9/32"), "Port Control Protocol Anycast", Protocol, []string{"RFC 7723"}, specialRegistry, true, true, true, true, false},
+	{netip.MustParsePrefix("192.0.0.10/32"), "Traversal Using Relays around NAT Anycast", Protocol, []string{"RFC 8155"}, specialRegistry, true, true, true, true, false},
+	{netip.MustParsePrefix("192.0.0.170/31"), "NAT64/DNS64 Discovery", Protocol, []string{"RFC 8880", "RFC 7050"}, specialRegistry, false, true, false, false, true},
+	{netip.MustParsePrefix("192.0.2.0/24"), "Documentation (TEST-NET-1)", Documentation, []string{"RFC 5737"}, specialRegistry, false, false, false, false, false},
+	{netip.MustParsePrefix("192.31.196.0/24"), "AS112-v4", Anycast, []string{"RFC 7535"}, specialRegistry, true, true, true, true, false},
+	{netip.MustParsePrefix("192.52.193.0/24"), "AMT", Anycast, []string{"RFC 7450"}, specialRegistry, true, true, true, true, false},
+	{netip.MustParsePrefix("192.168.0.0/16"), "Private-Use", Private, []string{"RFC 1918"}, specialRegistry, true, true, true, false, false},
+	{netip.MustParsePrefix("192.175.48.0/24"), "Direct Delegation AS112 Service", Anycast, []string{"RFC 7534"}, specialRegistry, true, true, true, true, false},
+	{netip.MustParsePrefix("198.18.0.0/15"), "Benchmarking", Benchmarking, []string{"RFC 2544"}, specialRegistry, true, true, true, false, false},
+	{netip.MustParsePrefix("198.51.100.0/24"), "Documentation (TEST-NET-2)", Documentation, []string{"RFC 5737"}, specialRegistry, false, false, false, false, false},
+	{netip.MustParsePrefix("203.0.113.0/24"), "Documentation (TEST-NET-3)", Documentation, []string{"RFC 5737"}, specialRegistry, false, false, false, false, false},
+	{netip.MustParsePrefix("224.0.0.0/4"), "Multicast", Multicast, []string{"RFC 5771"}, multicastRegistry, false, true, true, false, false},
+	{netip.MustParsePrefix("240.0.0.0/4"), "Reserved", Reserved, []string{"RFC 1112"}, specialRegistry, false, false, false, false, true},
+	{netip.MustParsePrefix("255.255.255.255/32"), "Limited Broadcast", Broadcast, []string{"RFC 8190", "RFC 919"}, specialRegistry, false, true, false, false, true},
+}
+
+// SpecialBlocks returns the entries of the special-purpose registry, sorted
+// by prefix.
+func SpecialBlocks() []SpecialBlock {
+	blocks := slices.Clone(specialBlocks)
+	for i := range blocks {
+		blocks[i].RFC = slices.Clone(blocks[i].RFC)
+	}
+	return blocks
+}
+
+// namedRanges maps the names usable after @ in patterns to their expression.
+var namedRanges = sync.OnceValue(func() map[string]*IPExpr {
+	spans := make(map[Category][][2]uint32)
+	for _, b := range specialBlocks {
+		first := addrToUint32(b.Prefix.Addr())
+		spans[b.Category] = append(spans[b.Category], [2]uint32{first, first | uint32(uint64(1)<<(32-b.Prefix.Bits())-1)})
+	}
+
+	named := make(map[string]*IPExpr)
+	var bogon [][2]uint32
+	for _, c := range Categories {
+		named[string(c)] = fromSpans(spans[c])
+		if c != Anycast && c != Broadcast {
+			bogon = append(bogon, spans[c]...)
+		}
+	}
+	named[string(Bogon)] = fromSpans(bogon)
+	named["cgnat"] = named[string(Shared)]
+	for _, e := range named {
+		_ = e.SetBackend(BackendAuto)
+	}
+	return named
+})
+
+// Expr returns an expression matching the addresses of the category.
+func (c Category) Expr() *IPExpr {
+	e, ok := namedRanges()[string(c)]
+	if !ok {
+		return &IPExpr{}
+	}
+	cp := *e
+	return &cp
+}
+
+// namedRange returns the expression of @name.
+func namedRange(name string) (*IPExpr, error) {
+	e, ok := namedRanges()[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown named range @%s", name)
+	}
+	cp := *e
+	return &cp, nil
+}
@@ -0,0 +1,218 @@
+package ipexpr_test
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestParse_NamedRanges(t *testing.T) {
+	tests := []struct {
+		expr  string
+		in    []string
+		out   []string
+		count uint64
+	}{
+		{"@private", []string{"10.1.2.3", "172.16.0.1", "172.31.255.255", "192.168.1.1"}, []string{"172.32.0.0", "11.0.0.0", "192.169.0.0"}, 1<<24 + 1<<20 + 1<<16},
+		{"@loopback", []string{"127.0.0.1", "127.255.255.255"}, []string{"128.0.0.0"}, 1 << 24},
+		{"@multicast", []string{"224.0.0.1", "239.255.255.255"}, []string{"240.0.0.0", "223.255.255.255"}, 1 << 28},
+		{"@cgnat", []string{"100.64.0.0", "100.127.255.255"}, []string{"100.128.0.0", "100.63.255.255"}, 1 << 22},
+		{"@documentation", []string{"192.0.2.1", "198.51.100.7", "203.0.113.255"}, []string{"192.0.3.0"}, 3 << 8},
+		{"@broadcast", []string{"255.255.255.255"}, []string{"255.255.255.254"}, 1},
+		{"@bogon", []string{"0.1.2.3", "10.0.0.1", "100.64.0.1", "169.254.1.1", "192.0.0.8", "198.18.0.1", "240.0.0.1", "255.255.255.255"}, []string{"8.8.8.8", "1.1.1.1", "192.31.196.1", "192.175.48.1"}, 0},
+		{"@private, @loopback", []string{"10.0.0.1", "127.0.0.1"}, []string{"8.8.8.8"}, 1<<24 + 1<<20 + 1<<16 + 1<<24},
+		{"@loopback,10.0.0.200-10.0.1.50", []string{"127.0.0.1", "10.0.1.50"}, []string{"10.0.1.51"}, 1<<24 + 107},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e := mustParse(t, tt.expr)
+			for _, s := range tt.in {
+				if ok, err := e.Matches(s); err != nil || !ok {
+					t.Errorf("Matches(%s) = %v, %v, want true", s, ok, err)
+				}
+			}
+			for _, s := range tt.out {
+				if ok, err := e.Matches(s); err != nil || ok {
+					t.Errorf("Matches(%s) = %v, %v, want false", s, ok, err)
+				}
+			}
+			if tt.count != 0 && e.Count() != tt.count {
+				t.Errorf("Count() = %d, want %d", e.Count(), tt.count)
+			}
+			if !mustParse(t, e.String()).Equal(e) {
+				t.Errorf("Parse(String()) differs from the expression")
+			}
+		})
+	}
+}
+
+func TestParse_UnionAndNegation(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+		in   []string
+		out  []string
+	}{
+		{"10.0.0.1 | 10.0.0.2", "10.0.0.1-2", []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.3"}},
+		{"10.*.*.1|192.168.*.1", "10.*.*.1 | 192.168.*.1", []string{"10.9.9.1", "192.168.4.1"}, []string{"10.9.9.2", "192.169.0.1"}},
+		{"10.0.0.* | 10.0.0.128-10.0.1.5", "10.0.0.0-10.0.1.5", []string{"10.0.0.0", "10.0.1.5"}, []string{"10.0.1.6"}},
+		{"!10.*.*.*", "0-9,11-255.*.*.*", []string{"9.255.255.255", "11.0.0.0"}, []string{"10.1.2.3"}},
+		{"!!10.*.*.*", "10.*.*.*", []string{"10.1.2.3"}, []string{"11.0.0.0"}},
+		{"!10.*.*.1", "0-9,11-255.*.*.* | 10.*.*.0,2-255", []string{"11.0.0.1", "10.0.0.2"}, []string{"10.5.5.1"}},
+		{" ! @bogon", "", []string{"8.8.8.8", "192.31.196.1", "192.175.48.1"}, []string{"10.0.0.1", "127.0.0.1", "255.255.255.255", "224.0.0.1", "0.0.0.0"}},
+		{"!*.*.*.*", "1-0.1-0.1-0.1-0", nil, []string{"0.0.0.0", "1.2.3.4"}},
+		// ! applies to one side of |
+		{"!@private | @loopback", "", []string{"127.0.0.1", "8.8.8.8"}, []string{"10.0.0.1"}},
+		{"!@private | !@loopback", "*.*.*.*", []string{"10.0.0.1", "127.0.0.1"}, nil},
+		{"@loopback | !@private", "", []string{"127.0.0.1", "8.8.8.8"}, []string{"10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e := mustParse(t, tt.expr)
+			if tt.want != "" && e.String() != tt.want {
+				t.Errorf("String() = %s, want %s", e.String(), tt.want)
+			}
+			for _, s := range tt.in {
+				if ok, err := e.Matches(s); err != nil || !ok {
+					t.Errorf("Matches(%s) = %v, %v, want true", s, ok, err)
+				}
+			}
+			for _, s := range tt.out {
+				if ok, err := e.Matches(s); err != nil || ok {
+					t.Errorf("Matches(%s) = %v, %v, want false", s, ok, err)
+				}
+			}
+			if !mustParse(t, e.String()).Equal(e) {
+				t.Errorf("Parse(String()) differs from the expression")
+			}
+		})
+	}
+}
+
+func TestParse_NegationIsComplement(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(45, 45))
+	for range 50 {
+		s, spans := randomRangeList(rnd)
+		e := mustParse(t, "!"+s)
+		if got, want := e.Count(), uint64(1<<32)-mustParse(t, s).Count(); got != want {
+			t.Fatalf("!%s: Count() = %d, want %d", s, got, want)
+		}
+		for range 200 {
+			v := uint32(10<<24) + rnd.Uint32N(1<<11)
+			addr := u32Addr(v)
+			if got, want := e.ContainsAddr(netip.AddrFrom4(addr)), !inSpans(spans, v); got != want {
+				t.Fatalf("!%s: ContainsAddr(%v) = %v, want %v", s, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestParse_NamedRangeErrors(t *testing.T) {
+	for _, expr := range []string{"@unknown", "@", "@private,", "!", "10.0.0.1 |", "!@nope", "@private-@loopback"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ipexpr.Parse(expr); err == nil {
+				t.Errorf("Parse() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestCategory_Expr(t *testing.T) {
+	blocks := ipexpr.SpecialBlocks()
+	for _, c := range ipexpr.Categories {
+		t.Run(string(c), func(t *testing.T) {
+			e := c.Expr()
+			if !e.Equal(mustParse(t, "@"+string(c))) {
+				t.Errorf("Expr() differs from @%s", c)
+			}
+
+			// every block of the category is covered, and every address of
+			// the expression is in a block of the category
+			var count uint64
+			for _, b := range blocks {
+				if b.Category != c {
+					continue
+				}
+				first, last := b.Prefix.Addr(), lastAddr(b.Prefix)
+				if !e.ContainsAddr(first) || !e.ContainsAddr(last) {
+					t.Errorf("Expr() does not contain %s", b.Prefix)
+				}
+				if !slices.ContainsFunc(blocks, func(o ipexpr.SpecialBlock) bool {
+					return o.Category == c && o.Prefix != b.Prefix && o.Prefix.Overlaps(b.Prefix) && o.Prefix.Bits() < b.Prefix.Bits()
+				}) {
+					count += 1 << (32 - b.Prefix.Bits())
+				}
+			}
+			if e.Count() != count {
+				t.Errorf("Count() = %d, want %d", e.Count(), count)
+			}
+		})
+	}
+
+	if !ipexpr.Bogon.Expr().Equal(mustParse(t, "@bogon")) {
+		t.Errorf("Bogon.Expr() differs from @bogon")
+	}
+	if ipexpr.Category("nope").Expr().Count() != 0 {
+		t.Errorf("unknown category matches addresses")
+	}
+
+	// expressions are copies
+	e := ipexpr.Private.Expr()
+	_ = e.SetBackend(ipexpr.BackendRangeTable)
+	if ipexpr.Private.Expr().Backend() == ipexpr.BackendRangeTable {
+		t.Errorf("Expr() returns a shared expression")
+	}
+}
+
+func TestSpecialBlocks(t *testing.T) {
+	blocks := ipexpr.SpecialBlocks()
+	if !slices.IsSortedFunc(blocks, func(a, b ipexpr.SpecialBlock) int { return a.Prefix.Addr().Compare(b.Prefix.Addr()) }) {
+		t.Errorf("blocks are not sorted")
+	}
+
+	find := func(prefix string) ipexpr.SpecialBlock {
+		t.Helper()
+		i := slices.IndexFunc(blocks, func(b ipexpr.SpecialBlock) bool { return b.Prefix.String() == prefix })
+		if i < 0 {
+			t.Fatalf("no block %s", prefix)
+		}
+		return blocks[i]
+	}
+
+	b := find("100.64.0.0/10")
+	if b.Category != ipexpr.Shared || !slices.Equal(b.RFC, []string{"RFC 6598"}) || b.GloballyReachable || !b.Forwardable {
+		t.Errorf("100.64.0.0/10 = %+v", b)
+	}
+	b = find("127.0.0.0/8")
+	if b.Source || b.Destination || !b.ReservedByProtocol {
+		t.Errorf("127.0.0.0/8 = %+v", b)
+	}
+	b = find("192.0.0.9/32")
+	if b.Category != ipexpr.Protocol || !b.GloballyReachable {
+		t.Errorf("192.0.0.9/32 = %+v", b)
+	}
+	b = find("224.0.0.0/4")
+	if b.Registry != "multicast-addresses" || b.Category != ipexpr.Multicast {
+		t.Errorf("224.0.0.0/4 = %+v", b)
+	}
+	if find("10.0.0.0/8").Registry != "iana-ipv4-special-registry" {
+		t.Errorf("10.0.0.0/8 is not from the special-purpose registry")
+	}
+
+	// returned blocks are copies
+	blocks[0].RFC[0] = "RFC 0"
+	if ipexpr.SpecialBlocks()[0].RFC[0] == "RFC 0" {
+		t.Errorf("SpecialBlocks() returns shared slices")
+	}
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	a := p.Masked().Addr().As4()
+	v := uint32(a[0])<<24 | uint32(a[1])<<16 | uint32(a[2])<<8 | uint32(a[3])
+	return netip.AddrFrom4(u32Addr(v | uint32(uint64(1)<<(32-p.Bits())-1)))
+}
@@ -0,0 +1,169 @@
+package ipexpr
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+)
+
+// Scan parses a pattern stored as a string, implementing sql.Scanner. NULL
+// is an error; nullable columns can be scanned into a sql.Null[IPExpr].
+func (ie *IPExpr) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return ie.UnmarshalText([]byte(src))
+	case []byte:
+		return ie.UnmarshalText(src)
+	case nil:
+		return fmt.Errorf("cannot scan NULL into IPExpr")
+	default:
+		return fmt.Errorf("cannot scan %T into IPExpr", src)
+	}
+}
+
+// Value stores the expression in its canonical form, implementing
+// driver.Valuer.
+func (ie IPExpr) Value() (driver.Value, error) {
+	return ie.String(), nil
+}
+
+// sqlMaxRanges is the largest number of ranges SQLInet spells out; beyond it
+// the predicate tests the octets of the address instead.
+const sqlMaxRanges = 16
+
+// SQLInet returns a PostgreSQL predicate matching the addresses of an inet
+// column that the expression matches, e.g. for 10.0.0.1-5,10
+//
+//	family(addr) = 4 AND (addr BETWEEN '10.0.0.1' AND '10.0.0.5' OR addr = '10.0.0.10')
+//
+// Expressions made of a few ranges are tested as CIDRs (addr <<= '10.0.0.0/15')
+// or ranges, which can use an index on the column. Others are tested octet by
+// octet, extracting the octets of the address. Range tests assume the column
+// holds host addresses, without netmask.
+//
+// The column is inserted verbatim and must be quoted by the caller if needed;
+// every other part of the predicate is generated from numbers.
+func (ie *IPExpr) SQLInet(column string) string {
+	if ie.Count() == 0 {
+		return "1 = 0"
+	}
+
+	var ranges []Range
+	for r := range ie.Ranges() {
+		if len(ranges) == sqlMaxRanges {
+			ranges = nil
+			break
+		}
+		ranges = append(ranges, r)
+	}
+
+	family := "family(" + column + ") = 4"
+	if ranges == nil {
+		var operands [4]string
+		for i := range operands {
+			operands[i] = sqlInetOctet(column, i)
+		}
+		return family + " AND " + sqlTerms(ie, operands)
+	}
+	if len(ranges) == 1 && ranges[0].Count() == 1<<32 {
+		return family
+	}
+
+	var alts []string
+	for _, r := range ranges {
+		switch p := r.Prefixes(); {
+		case r.Count() == 1:
+			alts = append(alts, fmt.Sprintf("%s = '%s'", column, r.First))
+		case len(p) == 1:
+			alts = append(alts, fmt.Sprintf("%s <<= '%s'", column, p[0]))
+		default:
+			alts = append(alts, fmt.Sprintf("%s BETWEEN '%s' AND '%s'", column, r.First, r.Last))
+		}
+	}
+	return family + " AND " + sqlOr(alts)
+}
+
+// SQLOctets returns a standard SQL predicate matching the rows whose four
+// integer columns, holding the octets of an address, are matched by the
+// expression, e.g. for 10.0-1.*.1,5-9
+//
+//	a = 10 AND b IN (0, 1) AND (d = 1 OR d BETWEEN 5 AND 9)
+//
+// Expressions made of several terms OR the tests of their terms. Columns are
+// inserted verbatim and must be quoted by the caller if needed.
+func (ie *IPExpr) SQLOctets(columns [4]string) string {
+	if ie.Count() == 0 {
+		return "1 = 0"
+	}
+	return sqlTerms(ie, columns)
+}
+
+// sqlTerms tests the octets of every term of a non-empty expression, ORing
+// the terms.
+func sqlTerms(ie *IPExpr, operands [4]string) string {
+	var alts []string
+	for _, t := range ie.terms() {
+		var conds []string
+		for i, o := range t {
+			if c := sqlOctet(operands[i], o); c != "" {
+				conds = append(conds, c)
+			}
+		}
+		if conds == nil {
+			return "1 = 1"
+		}
+		if len(conds) > 1 && ie.rest != nil {
+			alts = append(alts, "("+strings.Join(conds, " AND ")+")")
+		} else {
+			alts = append(alts, strings.Join(conds, " AND "))
+		}
+	}
+	return sqlOr(alts)
+}
+
+// sqlOctet returns the predicate matching the values of o, or "" when o holds
+// every value. Single values are grouped into an IN list.
+func sqlOctet(operand string, o bitsvector.OctetBits) string {
+	if o == bitsvector.AllSet {
+		return ""
+	}
+
+	var values, alts []string
+	for _, it := range o.Intervals() {
+		switch {
+		case it[0] == it[1]:
+			values = append(values, strconv.Itoa(int(it[0])))
+		case it[1] == it[0]+1:
+			values = append(values, strconv.Itoa(int(it[0])), strconv.Itoa(int(it[1])))
+		default:
+			alts = append(alts, fmt.Sprintf("%s BETWEEN %d AND %d", operand, it[0], it[1]))
+		}
+	}
+	switch len(values) {
+	case 0:
+	case 1:
+		alts = append([]string{operand + " = " + values[0]}, alts...)
+	default:
+		alts = append([]string{operand + " IN (" + strings.Join(values, ", ") + ")"}, alts...)
+	}
+	return sqlOr(alts)
+}
+
+// sqlInetOctet extracts the i-th octet of an inet column.
+func sqlInetOctet(column string, i int) string {
+	addr := "(" + column + " - '0.0.0.0'::inet)"
+	if i < 3 {
+		addr = fmt.Sprintf("(%s >> %d)", addr, 8*(3-i))
+	}
+	return "(" + addr + " & 255)"
+}
+
+func sqlOr(alts []string) string {
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return "(" + strings.Join(alts, " OR ") + ")"
+}
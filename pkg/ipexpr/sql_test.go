@@ -0,0 +1,102 @@
+package ipexpr_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestIPExpr_Scan(t *testing.T) {
+	for _, src := range []any{"10.0.1,2.*", []byte("10.0.1,2.*")} {
+		var e ipexpr.IPExpr
+		if err := e.Scan(src); err != nil {
+			t.Fatalf("Scan(%v) failed: %v", src, err)
+		}
+		if e.String() != "10.0.1-2.*" {
+			t.Errorf("Scan(%v) = %s, want 10.0.1-2.*", src, e.String())
+		}
+	}
+
+	for _, src := range []any{nil, 42, "10.0.0"} {
+		var e ipexpr.IPExpr
+		if err := e.Scan(src); err == nil {
+			t.Errorf("Scan(%v) expected error but got none", src)
+		}
+	}
+
+	var n sql.Null[ipexpr.IPExpr]
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("sql.Null.Scan(nil) = %v, valid %v, want no error and not valid", err, n.Valid)
+	}
+	if err := n.Scan("10.*.*.*"); err != nil || !n.Valid || n.V.String() != "10.*.*.*" {
+		t.Errorf("sql.Null.Scan(10.*.*.*) = %s, %v, valid %v", n.V.String(), err, n.Valid)
+	}
+}
+
+func TestIPExpr_Value(t *testing.T) {
+	var v driver.Valuer = mustParse(t, "10.0.1,2.*")
+	got, err := v.Value()
+	if err != nil {
+		t.Fatalf("Value() failed: %v", err)
+	}
+	if got != "10.0.1-2.*" {
+		t.Errorf("Value() = %v, want 10.0.1-2.*", got)
+	}
+}
+
+func TestIPExpr_SQLInet(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"*.*.*.*", "family(addr) = 4"},
+		{"1.2.3.5-4", "1 = 0"},
+		{"10.0.0.1", "family(addr) = 4 AND addr = '10.0.0.1'"},
+		{"10.*.*.*", "family(addr) = 4 AND addr <<= '10.0.0.0/8'"},
+		{"172.16-31.*.*", "family(addr) = 4 AND addr <<= '172.16.0.0/12'"},
+		{
+			"10.0.0.1-5,10",
+			"family(addr) = 4 AND (addr BETWEEN '10.0.0.1' AND '10.0.0.5' OR addr = '10.0.0.10')",
+		},
+		{
+			"10.0,2.*.*",
+			"family(addr) = 4 AND (addr <<= '10.0.0.0/16' OR addr <<= '10.2.0.0/16')",
+		},
+		{
+			"10.*.*.1,5-9",
+			"family(addr) = 4 AND (((addr - '0.0.0.0'::inet) >> 24) & 255) = 10 AND " +
+				"(((addr - '0.0.0.0'::inet) & 255) = 1 OR ((addr - '0.0.0.0'::inet) & 255) BETWEEN 5 AND 9)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := mustParse(t, tt.expr).SQLInet("addr"); got != tt.want {
+				t.Errorf("SQLInet() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPExpr_SQLOctets(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"*.*.*.*", "1 = 1"},
+		{"1.2.3.5-4", "1 = 0"},
+		{"10.0.0.1", "a = 10 AND b = 0 AND c = 0 AND d = 1"},
+		{"10.0-1.*.1,5-9", "a = 10 AND b IN (0, 1) AND (d = 1 OR d BETWEEN 5 AND 9)"},
+		{"*.*.1,3,7.0-100,200-255", "c IN (1, 3, 7) AND (d BETWEEN 0 AND 100 OR d BETWEEN 200 AND 255)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := mustParse(t, tt.expr).SQLOctets([4]string{"a", "b", "c", "d"}); got != tt.want {
+				t.Errorf("SQLOctets() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package ipexpr
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+)
+
+// Layout selects the strides of a Table, trading memory and build time for
+// lookup time.
+type Layout int
+
+const (
+	// Layout16_8_8 indexes the first 16 bits of the address in a root array
+	// of 65536 entries, then each remaining octet in chunks of 256 entries:
+	// a lookup takes at most three memory accesses. The root takes 256 KiB.
+	Layout16_8_8 Layout = iota
+	// LayoutDIR24_8 indexes the first 24 bits of the address in a root array
+	// of 2^24 entries, then the last octet in chunks of 256 entries: a lookup
+	// takes at most two memory accesses. The root alone takes 64 MiB and is
+	// expanded from a 16-8-8 table, which makes the build slower.
+	LayoutDIR24_8
+)
+
+func (l Layout) String() string {
+	switch l {
+	case Layout16_8_8:
+		return "16-8-8"
+	case LayoutDIR24_8:
+		return "DIR-24-8"
+	default:
+		return fmt.Sprintf("Layout(%d)", int(l))
+	}
+}
+
+// TableOptions configures NewTable.
+type TableOptions struct {
+	Layout Layout
+	// MaxMemory bounds the size of the table, in bytes. Building a table
+	// that does not fit fails. Zero means no limit.
+	MaxMemory int
+}
+
+// Table maps addresses to the index of the first of a list of expressions
+// matching them, with a constant number of memory accesses per lookup.
+//
+// Every entry of the table is either a leaf, holding the rule ID plus one
+// (zero when no expression matches), or a pointer to a chunk of 256 entries
+// indexed by the next octet. Identical chunks are stored once, so rules
+// sharing their trailing octets, such as *.*.*.1, take a single chunk.
+type Table struct {
+	layout Layout
+	n      int
+	root   []uint32
+	// mid holds the chunks indexed by the third octet in the 16-8-8 layout
+	mid []uint32
+	// leaf holds the chunks indexed by the last octet
+	leaf []uint32
+}
+
+const (
+	// tablePtr marks the entries pointing to a chunk; the other bits hold
+	// the chunk index.
+	tablePtr = 1 << 31
+	// maxTableRules keeps rule IDs clear of tablePtr.
+	maxTableRules = tablePtr - 1
+)
+
+type chunk [256]uint32
+
+// NewTable compiles exprs into a Table. Lookups return the index in exprs of
+// the first expression matching the address, as the linear scan
+//
+//	for i, e := range exprs {
+//		if e.ContainsAddr(addr) {
+//			return i, true
+//		}
+//	}
+//
+// would.
+func NewTable(exprs []*IPExpr, opts TableOptions) (*Table, error) {
+	if len(exprs) > maxTableRules {
+		return nil, fmt.Errorf("too many expressions: %d, at most %d", len(exprs), maxTableRules)
+	}
+	if opts.Layout != Layout16_8_8 && opts.Layout != LayoutDIR24_8 {
+		return nil, fmt.Errorf("unknown layout %s", opts.Layout)
+	}
+	if opts.Layout == LayoutDIR24_8 && opts.MaxMemory > 0 && opts.MaxMemory < 4<<24 {
+		return nil, fmt.Errorf("%s root takes %d bytes, over the memory budget of %d", opts.Layout, 4<<24, opts.MaxMemory)
+	}
+
+	b := newTableBuilder()
+	// painting the expressions from the last lets the earlier ones overwrite
+	// the addresses they share
+	for i := len(exprs) - 1; i >= 0; i-- {
+		b.paint(exprs[i], uint32(i)+1)
+		if opts.MaxMemory > 0 && b.size() > opts.MaxMemory {
+			// replaced chunks are only dropped by a compaction
+			b.compact()
+			if b.size() > opts.MaxMemory {
+				return nil, fmt.Errorf("table takes more than %d bytes, over the memory budget", opts.MaxMemory)
+			}
+		}
+	}
+	b.compact()
+
+	t := &Table{layout: opts.Layout, n: len(exprs), root: b.root, mid: b.mid, leaf: b.leaf}
+	if opts.Layout == LayoutDIR24_8 {
+		t.expand()
+	}
+	if opts.MaxMemory > 0 && t.MemoryUsage() > opts.MaxMemory {
+		return nil, fmt.Errorf("table takes %d bytes, over the memory budget of %d", t.MemoryUsage(), opts.MaxMemory)
+	}
+	return t, nil
+}
+
+// Lookup returns the index of the first expression matching addr, false if
+// none does. IPv4-mapped IPv6 addresses are unmapped; any other IPv6 address
+// never matches.
+func (t *Table) Lookup(addr netip.Addr) (int, bool) {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return 0, false
+	}
+	return t.lookup(addrToUint32(addr))
+}
+
+// LookupString is Lookup for a dotted-quad address, parsed without
+// allocating.
+func (t *Table) LookupString(s string) (int, bool, error) {
+	v, ok := parseUint32(s)
+	if !ok {
+		return 0, false, fmt.Errorf("invalid ip: %s", s)
+	}
+	id, ok := t.lookup(v)
+	return id, ok, nil
+}
+
+func (t *Table) lookup(v uint32) (int, bool) {
+	var e uint32
+	if t.layout == LayoutDIR24_8 {
+		e = t.root[v>>8]
+	} else {
+		e = t.root[v>>16]
+		if e&tablePtr != 0 {
+			e = t.mid[(e&^tablePtr)<<8|v>>8&0xff]
+		}
+	}
+	if e&tablePtr != 0 {
+		e = t.leaf[(e&^tablePtr)<<8|v&0xff]
+	}
+	if e == 0 {
+		return 0, false
+	}
+	return int(e - 1), true
+}
+
+// Len returns the number of expressions the table was built from.
+func (t *Table) Len() int {
+	return t.n
+}
+
+// Layout returns the strides of the table.
+func (t *Table) Layout() Layout {
+	return t.layout
+}
+
+// MemoryUsage returns the size of the table, in bytes.
+func (t *Table) MemoryUsage() int {
+	return 4 * (len(t.root) + len(t.mid) + len(t.leaf))
+}
+
+// expand turns a 16-8-8 table into a DIR-24-8 one: every root entry is
+// replaced with the 256 entries it stands for.
+func (t *Table) expand() {
+	root := make([]uint32, 1<<24)
+	for k, e := range t.root {
+		dst := root[k<<8 : (k+1)<<8]
+		if e&tablePtr == 0 {
+			for i := range dst {
+				dst[i] = e
+			}
+			continue
+		}
+		idx := e &^ tablePtr
+		copy(dst, t.mid[idx<<8:(idx+1)<<8])
+	}
+	t.root, t.mid = root, nil
+}
+
+// tableBuilder paints expressions onto a 16-8-8 table. Chunks are immutable
+// and interned: painting copies the chunks it changes, and an expression
+// changes every distinct chunk only once, however many root entries share it.
+type tableBuilder struct {
+	root      []uint32
+	mid, leaf []uint32
+	midIDs    map[chunk]uint32
+	leafIDs   map[chunk]uint32
+}
+
+func newTableBuilder() *tableBuilder {
+	return &tableBuilder{
+		root:    make([]uint32, 1<<16),
+		midIDs:  make(map[chunk]uint32),
+		leafIDs: make(map[chunk]uint32),
+	}
+}
+
+// paint sets every address matched by e to the leaf value id.
+func (b *tableBuilder) paint(e *IPExpr, id uint32) {
+	for _, t := range e.terms() {
+		b.paintTerm(t, id)
+	}
+}
+
+func (b *tableBuilder) paintTerm(o term, id uint32) {
+	if termCount(o) == 0 {
+		return
+	}
+
+	full := o[2] == bitsvector.AllSet && o[3] == bitsvector.AllSet
+	// root entries before and after painting, and the same for the entries
+	// of the chunks indexed by the third octet
+	painted := make(map[uint32]uint32)
+	paintedMid := make(map[uint32]uint32)
+	for a := range o[0].All() {
+		for c := range o[1].All() {
+			k := uint32(a)<<8 | uint32(c)
+			if full {
+				b.root[k] = id
+				continue
+			}
+			old := b.root[k]
+			nw, ok := painted[old]
+			if !ok {
+				nw = b.paintMid(old, o[2], o[3], id, paintedMid)
+				painted[old] = nw
+			}
+			b.root[k] = nw
+		}
+	}
+}
+
+func (b *tableBuilder) paintMid(e uint32, third, last bitsvector.OctetBits, id uint32, painted map[uint32]uint32) uint32 {
+	c := b.load(b.mid, e)
+	for x := range third.All() {
+		old := c[x]
+		nw, ok := painted[old]
+		if !ok {
+			nw = b.paintLeaf(old, last, id)
+			painted[old] = nw
+		}
+		c[x] = nw
+	}
+	return b.intern(&b.mid, b.midIDs, &c)
+}
+
+func (b *tableBuilder) paintLeaf(e uint32, last bitsvector.OctetBits, id uint32) uint32 {
+	if last == bitsvector.AllSet {
+		return id
+	}
+	c := b.load(b.leaf, e)
+	for x := range last.All() {
+		c[x] = id
+	}
+	return b.intern(&b.leaf, b.leafIDs, &c)
+}
+
+// load returns the chunk e points to, or a chunk filled with e if it is a
+// leaf.
+func (b *tableBuilder) load(chunks []uint32, e uint32) chunk {
+	var c chunk
+	if e&tablePtr != 0 {
+		idx := e &^ tablePtr
+		copy(c[:], chunks[idx<<8:(idx+1)<<8])
+		return c
+	}
+	for i := range c {
+		c[i] = e
+	}
+	return c
+}
+
+// intern returns the entry standing for c: the leaf when c holds a single
+// leaf value, a pointer to the stored copy of c otherwise.
+func (b *tableBuilder) intern(chunks *[]uint32, ids map[chunk]uint32, c *chunk) uint32 {
+	if c[0]&tablePtr == 0 {
+		uniform := true
+		for _, e := range c {
+			if e != c[0] {
+				uniform = false
+				break
+			}
+		}
+		if uniform {
+			return c[0]
+		}
+	}
+
+	if e, ok := ids[*c]; ok {
+		return e
+	}
+	e := tablePtr | uint32(len(*chunks)>>8)
+	*chunks = append(*chunks, c[:]...)
+	ids[*c] = e
+	return e
+}
+
+// compact drops the chunks no longer reachable from the root.
+func (b *tableBuilder) compact() {
+	mid, leaf := b.mid, b.leaf
+	b.mid, b.leaf = nil, nil
+	clear(b.midIDs)
+	clear(b.leafIDs)
+
+	moved := make(map[uint32]uint32)
+	movedLeaf := make(map[uint32]uint32)
+	for k, e := range b.root {
+		if e&tablePtr == 0 {
+			continue
+		}
+		nw, ok := moved[e]
+		if !ok {
+			c := b.load(mid, e)
+			for x, le := range c {
+				if le&tablePtr == 0 {
+					continue
+				}
+				nl, ok := movedLeaf[le]
+				if !ok {
+					lc := b.load(leaf, le)
+					nl = b.intern(&b.leaf, b.leafIDs, &lc)
+					movedLeaf[le] = nl
+				}
+				c[x] = nl
+			}
+			nw = b.intern(&b.mid, b.midIDs, &c)
+			moved[e] = nw
+		}
+		b.root[k] = nw
+	}
+}
+
+func (b *tableBuilder) size() int {
+	return 4 * (len(b.root) + len(b.mid) + len(b.leaf))
+}
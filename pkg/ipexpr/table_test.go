@@ -0,0 +1,234 @@
+package ipexpr_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func linearLookup(exprs []*ipexpr.IPExpr, addr netip.Addr) (int, bool) {
+	for i, e := range exprs {
+		if e.ContainsAddr(addr) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func mustTable(t testing.TB, exprs []*ipexpr.IPExpr, opts ipexpr.TableOptions) *ipexpr.Table {
+	t.Helper()
+	tbl, err := ipexpr.NewTable(exprs, opts)
+	if err != nil {
+		t.Fatalf("NewTable() failed: %v", err)
+	}
+	return tbl
+}
+
+func TestTable_Lookup(t *testing.T) {
+	exprs := []*ipexpr.IPExpr{
+		mustParse(t, "10.0.0.1"),
+		mustParse(t, "10.0.0.*"),
+		mustParse(t, "10.*.*.1-10"),
+		mustParse(t, "10.0-127.*.*"),
+		mustParse(t, "192.168.1,3.1,3,5"),
+		mustParse(t, "192.168.1-5.*"),
+		mustParse(t, "1-0.*.*.*"),
+		mustParse(t, "*.*.*.255"),
+	}
+
+	tests := []struct {
+		addr   string
+		want   int
+		wantOK bool
+	}{
+		{"10.0.0.1", 0, true},
+		{"10.0.0.2", 1, true},
+		{"10.200.3.5", 2, true},
+		{"10.0.1.1", 2, true},
+		{"10.0.1.11", 3, true},
+		{"10.200.3.11", 0, false},
+		{"192.168.3.5", 4, true},
+		{"192.168.3.6", 5, true},
+		{"192.168.6.6", 0, false},
+		{"192.168.6.255", 7, true},
+		{"10.0.0.255", 1, true},
+		{"8.8.8.8", 0, false},
+		{"::ffff:10.0.0.1", 0, true},
+		{"2001:db8::1", 0, false},
+	}
+
+	for _, layout := range []ipexpr.Layout{ipexpr.Layout16_8_8, ipexpr.LayoutDIR24_8} {
+		tbl := mustTable(t, exprs, ipexpr.TableOptions{Layout: layout})
+		for _, tt := range tests {
+			t.Run(layout.String()+"/"+tt.addr, func(t *testing.T) {
+				got, ok := tbl.Lookup(netip.MustParseAddr(tt.addr))
+				if got != tt.want || ok != tt.wantOK {
+					t.Errorf("Lookup(%s) = %d, %v, want %d, %v", tt.addr, got, ok, tt.want, tt.wantOK)
+				}
+			})
+		}
+	}
+}
+
+func TestTable_AgreesWithLinearScan(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(3, 4))
+	var exprs []*ipexpr.IPExpr
+	for range 300 {
+		exprs = append(exprs, mustParse(t, randomExpr(rnd)))
+	}
+	tbl := mustTable(t, exprs, ipexpr.TableOptions{})
+
+	check := func(addr netip.Addr) {
+		got, ok := tbl.Lookup(addr)
+		want, wantOK := linearLookup(exprs, addr)
+		if got != want || ok != wantOK {
+			t.Fatalf("Lookup(%s) = %d, %v, want %d, %v", addr, got, ok, want, wantOK)
+		}
+	}
+	for range 200000 {
+		check(netip.AddrFrom4([4]byte{byte(rnd.IntN(4)), byte(rnd.IntN(256)), byte(rnd.IntN(256)), byte(rnd.IntN(256))}))
+	}
+	for x := range 256 {
+		for y := range 256 {
+			check(netip.AddrFrom4([4]byte{1, 2, byte(x), byte(y)}))
+		}
+	}
+}
+
+// randomExpr returns patterns crowding the first four /8s, so that they
+// overlap.
+func randomExpr(rnd *rand.Rand) string {
+	octet := func(n int) string {
+		switch rnd.IntN(4) {
+		case 0:
+			return "*"
+		case 1:
+			lo := rnd.IntN(n)
+			return fmt.Sprintf("%d-%d", lo, lo+rnd.IntN(n-lo))
+		case 2:
+			return fmt.Sprintf("%d,%d", rnd.IntN(n), rnd.IntN(n))
+		default:
+			return fmt.Sprint(rnd.IntN(n))
+		}
+	}
+	return fmt.Sprintf("%s.%s.%s.%s", octet(4), octet(8), octet(256), octet(256))
+}
+
+func TestTable_LookupString(t *testing.T) {
+	tbl := mustTable(t, []*ipexpr.IPExpr{mustParse(t, "10.*.*.*")}, ipexpr.TableOptions{})
+
+	if id, ok, err := tbl.LookupString("10.1.2.3"); id != 0 || !ok || err != nil {
+		t.Errorf("LookupString(10.1.2.3) = %d, %v, %v, want 0, true, nil", id, ok, err)
+	}
+	if _, ok, err := tbl.LookupString("11.1.2.3"); ok || err != nil {
+		t.Errorf("LookupString(11.1.2.3) = %v, %v, want false, nil", ok, err)
+	}
+	if _, _, err := tbl.LookupString("10.1.2"); err == nil {
+		t.Errorf("LookupString(10.1.2) expected error but got none")
+	}
+}
+
+func TestTable_SharesChunks(t *testing.T) {
+	var exprs []*ipexpr.IPExpr
+	for i := range 200 {
+		exprs = append(exprs, mustParse(t, fmt.Sprintf("*.*.%d.1,3", i)))
+	}
+	tbl := mustTable(t, exprs, ipexpr.TableOptions{})
+
+	// the 64Ki root entries share one chunk for the third octet, pointing to
+	// one chunk for the last octet per rule
+	if got, want := tbl.MemoryUsage(), 4*(1<<16+201*256); got != want {
+		t.Errorf("MemoryUsage() = %d, want %d", got, want)
+	}
+	if tbl.Len() != 200 {
+		t.Errorf("Len() = %d, want 200", tbl.Len())
+	}
+}
+
+func TestTable_MemoryBudget(t *testing.T) {
+	var exprs []*ipexpr.IPExpr
+	for i := range 100 {
+		exprs = append(exprs, mustParse(t, fmt.Sprintf("10.%d.*.%d", i, i)))
+	}
+
+	if _, err := ipexpr.NewTable(exprs, ipexpr.TableOptions{MaxMemory: 300 << 10}); err == nil {
+		t.Errorf("NewTable() over the memory budget expected error but got none")
+	}
+	tbl := mustTable(t, exprs, ipexpr.TableOptions{MaxMemory: 1 << 20})
+	if tbl.MemoryUsage() > 1<<20 {
+		t.Errorf("MemoryUsage() = %d, over the budget", tbl.MemoryUsage())
+	}
+
+	if _, err := ipexpr.NewTable(exprs, ipexpr.TableOptions{Layout: ipexpr.LayoutDIR24_8, MaxMemory: 1 << 20}); err == nil {
+		t.Errorf("NewTable(DIR-24-8) over the memory budget expected error but got none")
+	}
+	if _, err := ipexpr.NewTable(exprs, ipexpr.TableOptions{Layout: ipexpr.Layout(9)}); err == nil {
+		t.Errorf("NewTable() with unknown layout expected error but got none")
+	}
+}
+
+// tableRuleSet builds n host-list and subnet patterns spread over 10.0.0.0/8.
+func tableRuleSet(b *testing.B, n int) []*ipexpr.IPExpr {
+	b.Helper()
+	exprs := make([]*ipexpr.IPExpr, 0, n)
+	for i := range n {
+		var s string
+		if i%2 == 0 {
+			s = fmt.Sprintf("10.%d.%d.%d,%d,%d-%d", i%256, i/256%256, i%100, i%100+2, i%100+10, i%100+20)
+		} else {
+			s = fmt.Sprintf("10.%d.%d-%d.*", i%256, i/256%200, i/256%200+5)
+		}
+		e, err := ipexpr.Parse(s)
+		if err != nil {
+			b.Fatalf("Parse(%q) failed: %v", s, err)
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs
+}
+
+var tableAddrs = []string{"10.3.7.250", "10.200.100.30", "10.77.99.3", "11.0.0.1"}
+
+func BenchmarkTable_Build(b *testing.B) {
+	exprs := tableRuleSet(b, 20000)
+	for _, layout := range []ipexpr.Layout{ipexpr.Layout16_8_8, ipexpr.LayoutDIR24_8} {
+		b.Run(layout.String(), func(b *testing.B) {
+			for b.Loop() {
+				mustTable(b, exprs, ipexpr.TableOptions{Layout: layout})
+			}
+		})
+	}
+}
+
+func BenchmarkTable_Lookup(b *testing.B) {
+	exprs := tableRuleSet(b, 20000)
+	for _, layout := range []ipexpr.Layout{ipexpr.Layout16_8_8, ipexpr.LayoutDIR24_8} {
+		b.Run(layout.String(), func(b *testing.B) {
+			tbl := mustTable(b, exprs, ipexpr.TableOptions{Layout: layout})
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				if _, _, err := tbl.LookupString(tableAddrs[i%len(tableAddrs)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTable_LinearMatches(b *testing.B) {
+	exprs := tableRuleSet(b, 20000)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		addr := tableAddrs[i%len(tableAddrs)]
+		for _, e := range exprs {
+			if ok, err := e.Matches(addr); err != nil {
+				b.Fatal(err)
+			} else if ok {
+				break
+			}
+		}
+	}
+}
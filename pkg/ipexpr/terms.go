@@ -0,0 +1,304 @@
+package ipexpr
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/azraelsec/ippy/pkg/bitsvector"
+)
+
+// term is a product of octet sets: the addresses whose every octet is in the
+// matching set.
+type term = [4]bitsvector.OctetBits
+
+func termCount(t term) uint64 {
+	n := uint64(1)
+	for _, o := range t {
+		n *= uint64(o.Count())
+	}
+	return n
+}
+
+func termIntersect(t, u term) term {
+	for i := range t {
+		t[i] = t[i].Intersect(u[i])
+	}
+	return t
+}
+
+// termBounds returns the lowest and the highest address of a term, unless it
+// is empty.
+func termBounds(t term) (first, last uint32, ok bool) {
+	for _, o := range t {
+		lo, ok := o.Min()
+		if !ok {
+			return 0, 0, false
+		}
+		hi, _ := o.Max()
+		first, last = first<<8|uint32(lo), last<<8|uint32(hi)
+	}
+	return first, last, true
+}
+
+// termsOverlap reports whether two of ts share an address. It sorts the
+// terms by their lowest address and only intersects those whose bounds
+// overlap, as overlapIndex does.
+func termsOverlap(ts []term) bool {
+	type bounded struct {
+		t           term
+		first, last uint32
+	}
+	bs := make([]bounded, 0, len(ts))
+	for _, t := range ts {
+		if first, last, ok := termBounds(t); ok {
+			bs = append(bs, bounded{t, first, last})
+		}
+	}
+	slices.SortFunc(bs, func(a, b bounded) int { return cmp.Compare(a.first, b.first) })
+
+	var open []bounded
+	for _, b := range bs {
+		open = slices.DeleteFunc(open, func(o bounded) bool { return o.last < b.first })
+		for _, o := range open {
+			if termCount(termIntersect(o.t, b.t)) != 0 {
+				return true
+			}
+		}
+		open = append(open, b)
+	}
+	return false
+}
+
+func termTest(t term, v uint32) bool {
+	return t[0].Test(byte(v>>24)) && t[1].Test(byte(v>>16)) &&
+		t[2].Test(byte(v>>8)) && t[3].Test(byte(v))
+}
+
+// terms returns the products the expression is the union of: its octet sets,
+// followed by the other terms of multi-term expressions.
+func (ie *IPExpr) terms() []term {
+	return append([]term{ie.octets}, ie.rest...)
+}
+
+// Terms returns the expression as a union of disjoint products of octet
+// sets, each being an expression of its own. Only the patterns holding
+// ranges of addresses that span octet boundaries, such as
+// 10.0.0.200-10.0.1.50, named ranges, unions and negations are made of
+// several terms; any other expression is its single term.
+func (ie *IPExpr) Terms() []*IPExpr {
+	if ie.rest == nil {
+		return []*IPExpr{ie}
+	}
+	exprs := make([]*IPExpr, 0, 1+len(ie.rest))
+	for _, t := range ie.terms() {
+		e := &IPExpr{octets: t}
+		_ = e.SetBackend(BackendAuto)
+		exprs = append(exprs, e)
+	}
+	return exprs
+}
+
+// testTerms reports whether one of the terms of the expression matches v.
+func (ie *IPExpr) testTerms(v uint32) bool {
+	if termTest(ie.octets, v) {
+		return true
+	}
+	for _, t := range ie.rest {
+		if termTest(t, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTerms returns the union of disjoint terms, dropping the empty ones. A
+// union that is a product, such as 10.0.0.* and 10.0.2.*, which is
+// 10.0.0,2.*, is turned into a single term: the union of disjoint terms is a
+// product exactly when it holds as many addresses as the product of the
+// values its octets take.
+func fromTerms(terms []term) *IPExpr {
+	var kept []term
+	var proj term
+	var count uint64
+	for _, t := range terms {
+		n := termCount(t)
+		if n == 0 {
+			continue
+		}
+		kept = append(kept, t)
+		count += n
+		for i := range proj {
+			proj[i] = proj[i].Union(t[i])
+		}
+	}
+
+	switch {
+	case len(kept) == 0:
+		return &IPExpr{}
+	case termCount(proj) == count:
+		return &IPExpr{octets: proj}
+	default:
+		return &IPExpr{octets: kept[0], rest: kept[1:]}
+	}
+}
+
+// union returns the union of exprs, keeping its terms disjoint: every
+// expression only adds the addresses the previous ones do not match.
+func union(exprs []*IPExpr) *IPExpr {
+	acc := &IPExpr{}
+	for _, e := range exprs {
+		terms := acc.terms()
+		for _, p := range e.subtract(acc) {
+			terms = append(terms, p.octets)
+		}
+		acc = fromTerms(terms)
+	}
+	return acc
+}
+
+// complement returns the addresses the expression does not match.
+func (ie *IPExpr) complement() *IPExpr {
+	all := &IPExpr{octets: term{bitsvector.AllSet, bitsvector.AllSet, bitsvector.AllSet, bitsvector.AllSet}}
+	var terms []term
+	for _, p := range all.subtract(ie) {
+		terms = append(terms, p.octets)
+	}
+	return fromTerms(terms)
+}
+
+// parseRangeList parses a comma separated list of addresses, ranges of
+// addresses, named ranges and attribute atoms, such as
+// 10.0.0.200-10.0.1.50,10.0.2.1,@private,asn:13335.
+func parseRangeList(expr string, opts ParseOptions) (*IPExpr, error) {
+	var spans [][2]uint32
+	for item := range strings.SplitSeq(expr, ",") {
+		item = strings.TrimSpace(item)
+		var e *IPExpr
+		var err error
+		if name, ok := strings.CutPrefix(item, "@"); ok {
+			if err = opts.checkFeature(FeatureNamedRanges, item); err == nil {
+				e, err = namedRange(name)
+			}
+		} else if key, value, ok := strings.Cut(item, ":"); ok {
+			if err = opts.checkFeature(FeatureAttributes, item); err == nil {
+				e, err = resolve(opts.Resolver, strings.TrimSpace(key), strings.TrimSpace(value))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			for r := range e.Ranges() {
+				spans = append(spans, [2]uint32{addrToUint32(r.First), addrToUint32(r.Last)})
+			}
+			continue
+		}
+
+		first, last, ok := strings.Cut(item, "-")
+		if !ok {
+			last = first
+		}
+		lo, err := parseAddr4(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("invalid address range %s: %w", item, err)
+		}
+		hi, err := parseAddr4(strings.TrimSpace(last))
+		if err != nil {
+			return nil, fmt.Errorf("invalid address range %s: %w", item, err)
+		}
+		if lo.Compare(hi) > 0 {
+			return nil, fmt.Errorf("invalid address range %s: start is after end", item)
+		}
+		spans = append(spans, [2]uint32{addrToUint32(lo), addrToUint32(hi)})
+	}
+
+	e := fromSpans(spans)
+	_ = e.SetBackend(BackendAuto)
+	return e, nil
+}
+
+func resolve(r Resolver, key, value string) (*IPExpr, error) {
+	if r == nil {
+		return nil, fmt.Errorf("attribute %s:%s needs a resolver", key, value)
+	}
+	e, err := r.Resolve(key, value)
+	if err != nil {
+		return nil, fmt.Errorf("attribute %s:%s: %w", key, value, err)
+	}
+	return e, nil
+}
+
+// fromSpans returns the expression matching the union of spans of addresses.
+func fromSpans(spans [][2]uint32) *IPExpr {
+	slices.SortFunc(spans, func(a, b [2]uint32) int { return cmp.Compare(a[0], b[0]) })
+
+	var terms []term
+	for i := 0; i < len(spans); {
+		lo, hi := spans[i][0], spans[i][1]
+		for i++; i < len(spans) && uint64(spans[i][0]) <= uint64(hi)+1; i++ {
+			hi = max(hi, spans[i][1])
+		}
+		terms = append(terms, rangeTerms(lo, hi)...)
+	}
+	return fromTerms(terms)
+}
+
+// rangeTerms returns disjoint terms holding the addresses from lo to hi,
+// splitting the range where its bounds are not aligned on octet boundaries:
+// a partial block of the first address, the full blocks in between, and a
+// partial block of the last one, the partial blocks being split recursively.
+// A range takes seven terms at most.
+func rangeTerms(lo, hi uint32) []term {
+	var terms []term
+	single := func(v byte) bitsvector.OctetBits {
+		return bitsvector.New([]bitsvector.Interval{{v, v}})
+	}
+
+	// split adds the range from lo to hi, whose octets before i are fixed
+	var split func(t term, i int, lo, hi [4]byte)
+	split = func(t term, i int, lo, hi [4]byte) {
+		for i < 4 && lo[i] == hi[i] {
+			t[i] = single(lo[i])
+			i++
+		}
+		if i == 4 {
+			terms = append(terms, t)
+			return
+		}
+
+		loAligned, hiAligned := true, true
+		for j := i + 1; j < 4; j++ {
+			loAligned = loAligned && lo[j] == 0
+			hiAligned = hiAligned && hi[j] == 255
+		}
+
+		from, to := int(lo[i]), int(hi[i])
+		if !loAligned {
+			u := t
+			u[i] = single(lo[i])
+			split(u, i+1, lo, [4]byte{255, 255, 255, 255})
+			from++
+		}
+		if !hiAligned {
+			to--
+		}
+		if from <= to {
+			u := t
+			u[i] = bitsvector.New([]bitsvector.Interval{{byte(from), byte(to)}})
+			for j := i + 1; j < 4; j++ {
+				u[j] = bitsvector.AllSet
+			}
+			terms = append(terms, u)
+		}
+		if !hiAligned {
+			u := t
+			u[i] = single(hi[i])
+			split(u, i+1, [4]byte{}, hi)
+		}
+	}
+
+	split(term{}, 0, uint32ToAddr(lo).As4(), uint32ToAddr(hi).As4())
+	return terms
+}
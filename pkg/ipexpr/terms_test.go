@@ -0,0 +1,300 @@
+package ipexpr_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+func TestParse_AddressRanges(t *testing.T) {
+	tests := []struct {
+		expr  string
+		want  string
+		count uint64
+		terms int
+	}{
+		{"10.0.0.200-10.0.1.50", "10.0.0.200-10.0.1.50", 107, 2},
+		{"10.0.0.5-10.0.3.17", "10.0.0.5-10.0.3.17", 781, 3},
+		{"10.0.0.200-10.0.1.50,10.0.2.1", "10.0.0.200-10.0.1.50,10.0.2.1", 108, 3},
+		{"10.0.2.1, 10.0.0.200 - 10.0.1.50", "10.0.0.200-10.0.1.50,10.0.2.1", 108, 3},
+		{"1.2.3.4-9.8.7.6", "1.2.3.4-9.8.7.6", 134611971, 7},
+		// overlapping and adjacent ranges are merged
+		{"10.0.0.1-10.0.0.100,10.0.0.50-10.0.1.10,10.0.1.11-10.0.1.20", "10.0.0.1-10.0.1.20", 276, 2},
+		// unions that are products of octet sets are a single term
+		{"10.0.0.0-10.0.255.255", "10.0.*.*", 65536, 1},
+		{"10.0.0.0-10.0.0.255,10.0.2.0-10.0.2.255", "10.0.0,2.*", 512, 1},
+		{"10.0.0.1,10.0.5.1", "10.0.0,5.1", 2, 1},
+		{"0.0.0.0-255.255.255.255", "*.*.*.*", 1 << 32, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e := mustParse(t, tt.expr)
+			if got := e.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+			if got := e.Count(); got != tt.count {
+				t.Errorf("Count() = %d, want %d", got, tt.count)
+			}
+			if got := len(e.Terms()); got != tt.terms {
+				t.Errorf("len(Terms()) = %d, want %d", got, tt.terms)
+			}
+			if !mustParse(t, e.String()).Equal(e) {
+				t.Errorf("Parse(String()) differs from the expression")
+			}
+		})
+	}
+}
+
+func TestParse_AddressRangeErrors(t *testing.T) {
+	for _, expr := range []string{
+		"10.0.1.50-10.0.0.200",
+		"10.0.0.1-10.0.1",
+		"10.0.0.1-10.0.0.256",
+		"10.0.0.1-10.0.0.*",
+		"10.0.0.1-5,10.0.0.9",
+		"10.0.0.1,,10.0.0.9",
+		"10.0.0.1-10.0.0.5-10.0.0.9",
+		"010.0.0.1-10.0.0.9",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ipexpr.Parse(expr); err == nil {
+				t.Errorf("Parse() expected error but got none")
+			}
+		})
+	}
+}
+
+// randomRangeList returns a list of up to three ranges within 10.0.0.0/22,
+// and its spans.
+func randomRangeList(rnd *rand.Rand) (string, [][2]uint32) {
+	var s string
+	var spans [][2]uint32
+	for i := range 1 + rnd.IntN(3) {
+		lo := uint32(10<<24) + rnd.Uint32N(1<<10)
+		hi := min(lo+rnd.Uint32N(600), 10<<24+1<<10-1)
+		if i > 0 {
+			s += ","
+		}
+		s += fmt.Sprintf("%s-%s", netip.AddrFrom4(u32Addr(lo)), netip.AddrFrom4(u32Addr(hi)))
+		spans = append(spans, [2]uint32{lo, hi})
+	}
+	return s, spans
+}
+
+func inSpans(spans [][2]uint32, v uint32) bool {
+	for _, s := range spans {
+		if s[0] <= v && v <= s[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAddressRanges_Membership(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(5, 6))
+	for range 200 {
+		s, spans := randomRangeList(rnd)
+		e := mustParse(t, s)
+
+		for _, b := range []ipexpr.Backend{ipexpr.BackendBitset, ipexpr.BackendRangeTable} {
+			if err := e.SetBackend(b); err != nil {
+				t.Fatalf("SetBackend(%s) failed: %v", b, err)
+			}
+
+			var count uint64
+			// the /22 and its surroundings
+			for v := uint32(10<<24) - 8; v < 10<<24+1<<10+8; v++ {
+				want := inSpans(spans, v)
+				if want {
+					count++
+				}
+				addr := netip.AddrFrom4(u32Addr(v))
+				got, err := e.Matches(addr.String())
+				if err != nil {
+					t.Fatalf("Matches(%s) failed: %v", addr, err)
+				}
+				if got != want || e.ContainsAddr(addr) != want || e.Contains(net.IP(addr.AsSlice())) != want {
+					t.Fatalf("%s (%s): %s matched = %v, want %v", s, b, addr, got, want)
+				}
+			}
+			if e.Count() != count {
+				t.Fatalf("%s: Count() = %d, want %d", s, e.Count(), count)
+			}
+		}
+	}
+}
+
+func TestAddressRanges_Generate(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(7, 8))
+	for range 50 {
+		s, spans := randomRangeList(rnd)
+		e := mustParse(t, s)
+
+		var want []uint32
+		for v := uint32(10 << 24); v < 10<<24+1<<10; v++ {
+			if inSpans(spans, v) {
+				want = append(want, v)
+			}
+		}
+
+		n := 0
+		for i, got := range e.Generate() {
+			if i != n || i >= len(want) {
+				t.Fatalf("%s: Generate() yielded index %d after %d addresses, want %d addresses", s, i, n, len(want))
+			}
+			if w := net.IP(netip.AddrFrom4(u32Addr(want[i])).AsSlice()); !got.Equal(w) {
+				t.Fatalf("%s: Generate()[%d] = %s, want %s", s, i, got, w)
+			}
+			n++
+		}
+		if n != len(want) {
+			t.Fatalf("%s: Generate() yielded %d addresses, want %d", s, n, len(want))
+		}
+	}
+}
+
+func TestAddressRanges_SetOperations(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(9, 10))
+	exprs := []string{"10.0.0-3.*", "10.0.1.*", "10.0.0-3.0-127", "10.0.0-3.1,200-255", "10.0.2.5"}
+	for range 10 {
+		s, _ := randomRangeList(rnd)
+		exprs = append(exprs, s)
+	}
+
+	// brute force over the /22 every expression lies in
+	set := func(e *ipexpr.IPExpr) []bool {
+		in := make([]bool, 1<<10)
+		for v := range in {
+			in[v] = e.ContainsAddr(netip.AddrFrom4(u32Addr(10<<24 + uint32(v))))
+		}
+		return in
+	}
+
+	for _, sa := range exprs {
+		for _, sb := range exprs {
+			a, b := mustParse(t, sa), mustParse(t, sb)
+			ina, inb := set(a), set(b)
+
+			covers, overlaps := true, false
+			var both, onlyA, onlyB uint64
+			for v := range ina {
+				covers = covers && (!inb[v] || ina[v])
+				overlaps = overlaps || ina[v] && inb[v]
+				switch {
+				case ina[v] && inb[v]:
+					both++
+				case ina[v]:
+					onlyA++
+				case inb[v]:
+					onlyB++
+				}
+			}
+
+			if got := a.Covers(b); got != covers {
+				t.Errorf("%s Covers %s = %v, want %v", sa, sb, got, covers)
+			}
+			if got := a.Overlaps(b); got != overlaps {
+				t.Errorf("%s Overlaps %s = %v, want %v", sa, sb, got, overlaps)
+			}
+			inter := a.Intersect(b)
+			if got := inter.Count(); got != both {
+				t.Errorf("%s Intersect %s = %s of %d addresses, want %d", sa, sb, inter, got, both)
+			}
+			for v, in := range set(inter) {
+				if in != (ina[v] && inb[v]) {
+					t.Fatalf("%s Intersect %s = %s, wrong on %s", sa, sb, inter, netip.AddrFrom4(u32Addr(10<<24+uint32(v))))
+				}
+			}
+
+			d := ipexpr.Diff(a, b)
+			if d.AddedCount != onlyB || d.RemovedCount != onlyA {
+				t.Errorf("Diff(%s, %s) = +%d -%d, want +%d -%d", sa, sb, d.AddedCount, d.RemovedCount, onlyB, onlyA)
+			}
+		}
+	}
+}
+
+func TestAddressRanges_MarshalBinary(t *testing.T) {
+	e := mustParse(t, "10.0.0.200-10.0.1.50,10.0.2.1")
+	data, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	if want := ipexpr.ExprBinarySize + 2*ipexpr.ExprTermSize; len(data) != want {
+		t.Errorf("len(MarshalBinary()) = %d, want %d", len(data), want)
+	}
+	if n, err := ipexpr.ExprBinaryLen(data); err != nil || n != len(data) {
+		t.Errorf("ExprBinaryLen() = %d, %v, want %d", n, err, len(data))
+	}
+
+	var got ipexpr.IPExpr
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() failed: %v", err)
+	}
+	if got.String() != e.String() {
+		t.Errorf("UnmarshalBinary() = %s, want %s", got.String(), e.String())
+	}
+}
+
+func TestAddressRanges_MarshalBinaryLarge(t *testing.T) {
+	// ranges spanning octet boundaries, two terms each: more terms than a
+	// uint16 counts, decoded in linear time
+	const n = 34000
+	var ranges []ipexpr.Range
+	for i := range uint32(n) {
+		v := 0x0a000000 + i*512 + 255
+		ranges = append(ranges, ipexpr.Range{First: netip.AddrFrom4(u32Addr(v)), Last: netip.AddrFrom4(u32Addr(v + 2))})
+	}
+	e, err := ipexpr.FromRanges(ranges...)
+	if err != nil {
+		t.Fatalf("FromRanges() failed: %v", err)
+	}
+	if n := len(e.Terms()); n <= 0xffff {
+		t.Fatalf("expression of %d terms, want more than %d", n, 0xffff)
+	}
+
+	data, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	var got ipexpr.IPExpr
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() failed: %v", err)
+	}
+	if got.String() != e.String() || got.Count() != 3*n {
+		t.Errorf("UnmarshalBinary() = %d addresses, want %d", got.Count(), 3*n)
+	}
+}
+
+func TestAddressRanges_Table(t *testing.T) {
+	exprs := []*ipexpr.IPExpr{
+		mustParse(t, "10.0.0.200-10.0.1.50"),
+		mustParse(t, "10.0.0.*"),
+		mustParse(t, "10.0.1.40-10.0.3.2,10.0.0.100"),
+	}
+	tbl := mustTable(t, exprs, ipexpr.TableOptions{})
+	for v := uint32(10 << 24); v < 10<<24+1<<10; v++ {
+		addr := netip.AddrFrom4(u32Addr(v))
+		got, ok := tbl.Lookup(addr)
+		want, wantOK := linearLookup(exprs, addr)
+		if got != want || ok != wantOK {
+			t.Fatalf("Lookup(%s) = %d, %v, want %d, %v", addr, got, ok, want, wantOK)
+		}
+	}
+}
+
+func TestAddressRanges_SQL(t *testing.T) {
+	e := mustParse(t, "10.0.0.200-10.0.1.50")
+	want := "(a = 10 AND b = 0 AND c = 0 AND d BETWEEN 200 AND 255) OR (a = 10 AND b = 0 AND c = 1 AND d BETWEEN 0 AND 50)"
+	if got := e.SQLOctets([4]string{"a", "b", "c", "d"}); got != "("+want+")" {
+		t.Errorf("SQLOctets() = %s, want (%s)", got, want)
+	}
+	if got := e.SQLInet("addr"); got != "family(addr) = 4 AND addr BETWEEN '10.0.0.200' AND '10.0.1.50'" {
+		t.Errorf("SQLInet() = %s", got)
+	}
+}
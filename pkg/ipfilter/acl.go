@@ -0,0 +1,120 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+)
+
+// Mode selects how an ACL picks a rule when several of them match.
+type Mode int
+
+const (
+	// FirstMatch applies the first matching rule in list order.
+	FirstMatch Mode = iota
+	// MostSpecific applies the matching rule covering the fewest addresses,
+	// earlier rules winning ties.
+	MostSpecific
+)
+
+func (m Mode) String() string {
+	switch m {
+	case FirstMatch:
+		return "first-match"
+	case MostSpecific:
+		return "most-specific"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// ACL is an ordered, firewall-style list of rules with a default policy.
+type ACL struct {
+	rules []Rule
+	// counts holds the number of addresses of every rule, compared by
+	// MostSpecific on every evaluation.
+	counts []uint64
+	def    Action
+	mode   Mode
+}
+
+// Decision describes the outcome of an ACL evaluation.
+type Decision struct {
+	Action Action
+	// Index is the position of the rule that fired, -1 when the default
+	// policy was applied.
+	Index int
+	// Rule is the rule that fired, nil when the default policy was applied.
+	Rule   *Rule
+	Reason string
+}
+
+// NewACL builds an ACL evaluating rules in mode, applying def when none of
+// them matches. Rules without an expression, unknown actions and unknown
+// modes are errors.
+func NewACL(rules []Rule, def Action, mode Mode) (*ACL, error) {
+	if def != Allow && def != Deny {
+		return nil, fmt.Errorf("unknown default action %s", def)
+	}
+	if mode != FirstMatch && mode != MostSpecific {
+		return nil, fmt.Errorf("unknown mode %s", mode)
+	}
+	counts := make([]uint64, len(rules))
+	for i, r := range rules {
+		if r.Expr == nil {
+			return nil, fmt.Errorf("rule #%d has no expression", i+1)
+		}
+		if r.Action != Allow && r.Action != Deny {
+			return nil, fmt.Errorf("rule #%d has unknown action %s", i+1, r.Action)
+		}
+		counts[i] = r.Expr.Count()
+	}
+	return &ACL{rules: rules, counts: counts, def: def, mode: mode}, nil
+}
+
+func (a *ACL) Rules() []Rule {
+	return a.rules
+}
+
+func (a *ACL) Evaluate(ip net.IP) Decision {
+	if ip.To4() == nil {
+		return Decision{Action: Deny, Index: -1, Reason: "not an IPv4 address"}
+	}
+
+	best := -1
+	for i := range a.rules {
+		if !a.rules[i].Expr.Contains(ip) {
+			continue
+		}
+		if a.mode == FirstMatch {
+			best = i
+			break
+		}
+		if best < 0 || a.counts[i] < a.counts[best] {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return Decision{
+			Action: a.def,
+			Index:  -1,
+			Reason: fmt.Sprintf("no rule matched, default %s", a.def),
+		}
+	}
+
+	r := &a.rules[best]
+	reason := fmt.Sprintf("rule #%d %s %s", best+1, r.Action, r.Pattern)
+	if r.Line > 0 {
+		reason += fmt.Sprintf(" (line %d)", r.Line)
+	}
+	if a.mode == MostSpecific {
+		reason += fmt.Sprintf(" is the most specific match (%d addresses)", a.counts[best])
+	} else {
+		reason += " is the first match"
+	}
+	return Decision{Action: r.Action, Index: best, Rule: r, Reason: reason}
+}
+
+func (a *ACL) Allowed(ip net.IP) bool {
+	return a.Evaluate(ip).Action == Allow
+}
@@ -0,0 +1,109 @@
+package ipfilter_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func mustReadRules(t *testing.T, s string) []ipfilter.Rule {
+	t.Helper()
+	rules, err := ipfilter.ReadRules(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("ReadRules() failed: %v", err)
+	}
+	return rules
+}
+
+func mustACL(t *testing.T, rules []ipfilter.Rule, def ipfilter.Action, mode ipfilter.Mode) *ipfilter.ACL {
+	t.Helper()
+	acl, err := ipfilter.NewACL(rules, def, mode)
+	if err != nil {
+		t.Fatalf("NewACL() failed: %v", err)
+	}
+	return acl
+}
+
+func TestACL_Evaluate(t *testing.T) {
+	// the deny rule is shadowed by the broader allow rule under first-match
+	rules := `allow 10.0.*.*
+deny 10.0.66.*
+deny 10.0.66.1
+allow 10.0.66.1,2
+`
+	tests := []struct {
+		name      string
+		mode      ipfilter.Mode
+		def       ipfilter.Action
+		ip        net.IP
+		want      ipfilter.Action
+		wantIndex int
+	}{
+		{"first-match shadowed deny", ipfilter.FirstMatch, ipfilter.Deny, net.IPv4(10, 0, 66, 5), ipfilter.Allow, 0},
+		{"first-match broad allow", ipfilter.FirstMatch, ipfilter.Deny, net.IPv4(10, 0, 1, 1), ipfilter.Allow, 0},
+		{"first-match default deny", ipfilter.FirstMatch, ipfilter.Deny, net.IPv4(192, 168, 1, 1), ipfilter.Deny, -1},
+		{"first-match default allow", ipfilter.FirstMatch, ipfilter.Allow, net.IPv4(192, 168, 1, 1), ipfilter.Allow, -1},
+		{"most-specific deny wins", ipfilter.MostSpecific, ipfilter.Deny, net.IPv4(10, 0, 66, 5), ipfilter.Deny, 1},
+		{"most-specific single host", ipfilter.MostSpecific, ipfilter.Deny, net.IPv4(10, 0, 66, 1), ipfilter.Deny, 2},
+		{"most-specific narrower allow", ipfilter.MostSpecific, ipfilter.Deny, net.IPv4(10, 0, 66, 2), ipfilter.Allow, 3},
+		{"most-specific broad allow", ipfilter.MostSpecific, ipfilter.Deny, net.IPv4(10, 0, 1, 1), ipfilter.Allow, 0},
+		{"ipv6 is denied", ipfilter.FirstMatch, ipfilter.Allow, net.ParseIP("::1"), ipfilter.Deny, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl := mustACL(t, mustReadRules(t, rules), tt.def, tt.mode)
+
+			d := acl.Evaluate(tt.ip)
+			if d.Action != tt.want || d.Index != tt.wantIndex {
+				t.Errorf("Evaluate(%s) = {%s #%d}, want {%s #%d}", tt.ip, d.Action, d.Index, tt.want, tt.wantIndex)
+			}
+			if (d.Rule == nil) != (tt.wantIndex < 0) {
+				t.Errorf("Evaluate(%s).Rule = %v, want rule #%d", tt.ip, d.Rule, tt.wantIndex)
+			}
+			if d.Reason == "" {
+				t.Errorf("Evaluate(%s).Reason is empty", tt.ip)
+			}
+			if acl.Allowed(tt.ip) != (tt.want == ipfilter.Allow) {
+				t.Errorf("Allowed(%s) disagrees with Evaluate", tt.ip)
+			}
+		})
+	}
+}
+
+func TestACL_Reason(t *testing.T) {
+	acl := mustACL(t, mustReadRules(t, "allow 10.0.*.*\ndeny 10.0.66.*\n"), ipfilter.Deny, ipfilter.MostSpecific)
+
+	want := "rule #2 deny 10.0.66.* (line 2) is the most specific match (256 addresses)"
+	if got := acl.Evaluate(net.IPv4(10, 0, 66, 1)).Reason; got != want {
+		t.Errorf("Reason = %q, want %q", got, want)
+	}
+
+	want = "no rule matched, default deny"
+	if got := acl.Evaluate(net.IPv4(10, 1, 0, 1)).Reason; got != want {
+		t.Errorf("Reason = %q, want %q", got, want)
+	}
+}
+
+func TestNewACL_Errors(t *testing.T) {
+	rules := mustReadRules(t, "allow 10.0.*.*\n")
+	tests := map[string]struct {
+		rules []ipfilter.Rule
+		def   ipfilter.Action
+		mode  ipfilter.Mode
+	}{
+		"nil expression": {[]ipfilter.Rule{{Action: ipfilter.Allow, Pattern: "10.0.*.*"}}, ipfilter.Deny, ipfilter.FirstMatch},
+		"rule action":    {[]ipfilter.Rule{{Action: ipfilter.Action(2), Pattern: "10.0.*.*", Expr: rules[0].Expr}}, ipfilter.Deny, ipfilter.FirstMatch},
+		"default action": {rules, ipfilter.Action(2), ipfilter.FirstMatch},
+		"mode":           {rules, ipfilter.Deny, ipfilter.Mode(2)},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ipfilter.NewACL(tt.rules, tt.def, tt.mode); err == nil {
+				t.Errorf("NewACL() expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package ipfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+// Rule bundles hold a compiled ACL, so that it can be loaded without parsing
+// its patterns. A bundle is a 16 byte header followed by the rules:
+//
+//	magic   "IPFA"
+//	version uint16
+//	mode    uint8
+//	default uint8, the default action
+//	count   uint32, the number of rules
+//	crc     uint32, CRC-32C of the rules
+//
+// Each rule is its action (uint8), its line (uint32), the length of its
+// pattern (uint16), the pattern and the binary encoding of its expression,
+// whose length is read from its own header. Integers are little-endian.
+// Version 2 holds expressions of version 2, whose number of terms is a
+// uint32.
+const (
+	bundleMagic      = "IPFA"
+	bundleVersion    = 2
+	bundleHeaderSize = 16
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// MarshalBinary encodes the ACL as a rule bundle.
+func (a *ACL) MarshalBinary() ([]byte, error) {
+	b := make([]byte, bundleHeaderSize)
+	copy(b, bundleMagic)
+	binary.LittleEndian.PutUint16(b[4:], bundleVersion)
+	b[6] = byte(a.mode)
+	b[7] = byte(a.def)
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(a.rules)))
+
+	for i, r := range a.rules {
+		if len(r.Pattern) > 0xffff {
+			return nil, fmt.Errorf("rule #%d: pattern longer than %d bytes", i+1, 0xffff)
+		}
+		b = append(b, byte(r.Action))
+		b = binary.LittleEndian.AppendUint32(b, uint32(r.Line))
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(r.Pattern)))
+		b = append(b, r.Pattern...)
+
+		var err error
+		if b, err = r.Expr.AppendBinary(b); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(b[12:], crc32.Checksum(b[bundleHeaderSize:], castagnoli))
+	return b, nil
+}
+
+// UnmarshalBinary decodes a rule bundle encoded by MarshalBinary.
+func (a *ACL) UnmarshalBinary(data []byte) error {
+	if len(data) < bundleHeaderSize {
+		return fmt.Errorf("invalid rule bundle: %d bytes, shorter than the header", len(data))
+	}
+	if string(data[:4]) != bundleMagic {
+		return fmt.Errorf("invalid rule bundle: bad magic %q", data[:4])
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != bundleVersion {
+		return fmt.Errorf("unsupported rule bundle version %d", v)
+	}
+	if crc32.Checksum(data[bundleHeaderSize:], castagnoli) != binary.LittleEndian.Uint32(data[12:]) {
+		return fmt.Errorf("invalid rule bundle: checksum mismatch")
+	}
+
+	mode, def := Mode(data[6]), Action(data[7])
+	if mode != FirstMatch && mode != MostSpecific {
+		return fmt.Errorf("invalid rule bundle: unknown mode %s", mode)
+	}
+	if def != Allow && def != Deny {
+		return fmt.Errorf("invalid rule bundle: unknown default action %s", def)
+	}
+
+	count := binary.LittleEndian.Uint32(data[8:])
+	// every rule takes at least its fixed fields and expression
+	if uint64(count)*(7+ipexpr.ExprBinarySize) > uint64(len(data)) {
+		return fmt.Errorf("invalid rule bundle: %d rules do not fit in %d bytes", count, len(data))
+	}
+
+	rules := make([]Rule, 0, count)
+	rest := data[bundleHeaderSize:]
+	for i := range int(count) {
+		if len(rest) < 7 {
+			return fmt.Errorf("invalid rule bundle: rule #%d truncated", i+1)
+		}
+		r := Rule{Action: Action(rest[0]), Line: int(binary.LittleEndian.Uint32(rest[1:]))}
+		if r.Action != Allow && r.Action != Deny {
+			return fmt.Errorf("invalid rule bundle: rule #%d: unknown action %s", i+1, r.Action)
+		}
+		n := int(binary.LittleEndian.Uint16(rest[5:]))
+		rest = rest[7:]
+		if len(rest) < n+ipexpr.ExprBinarySize {
+			return fmt.Errorf("invalid rule bundle: rule #%d truncated", i+1)
+		}
+		r.Pattern = string(rest[:n])
+		rest = rest[n:]
+		size, err := ipexpr.ExprBinaryLen(rest)
+		if err != nil || len(rest) < size {
+			return fmt.Errorf("invalid rule bundle: rule #%d truncated", i+1)
+		}
+		r.Expr = &ipexpr.IPExpr{}
+		if err := r.Expr.UnmarshalBinary(rest[:size]); err != nil {
+			return fmt.Errorf("invalid rule bundle: rule #%d: %w", i+1, err)
+		}
+		rest = rest[size:]
+		rules = append(rules, r)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("invalid rule bundle: %d trailing bytes", len(rest))
+	}
+
+	acl, err := NewACL(rules, def, mode)
+	if err != nil {
+		return fmt.Errorf("invalid rule bundle: %w", err)
+	}
+	*a = *acl
+	return nil
+}
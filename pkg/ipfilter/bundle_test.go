@@ -0,0 +1,80 @@
+package ipfilter_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func TestACL_MarshalBinary(t *testing.T) {
+	rules := mustReadRules(t, `
+deny 10.0.66.*      # quarantined
+allow 10.0.*.*
+deny *.*.*.1-10
+allow 192.168.1,3.*
+allow 172.16.0.200-172.16.1.50
+`)
+	acl := mustACL(t, rules, ipfilter.Deny, ipfilter.MostSpecific)
+
+	data, err := acl.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	var got ipfilter.ACL
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() failed: %v", err)
+	}
+
+	if len(got.Rules()) != len(rules) {
+		t.Fatalf("len(Rules()) = %d, want %d", len(got.Rules()), len(rules))
+	}
+	for i, r := range got.Rules() {
+		w := rules[i]
+		if r.Action != w.Action || r.Pattern != w.Pattern || r.Line != w.Line || !r.Expr.Equal(w.Expr) {
+			t.Errorf("rule #%d = %s %s (line %d), want %s %s (line %d)", i+1, r.Action, r.Pattern, r.Line, w.Action, w.Pattern, w.Line)
+		}
+	}
+	for _, ip := range []string{"10.0.66.5", "10.0.1.1", "10.0.1.200", "192.168.3.4", "8.8.8.8", "172.16.0.250", "172.16.1.60"} {
+		want, d := acl.Evaluate(net.ParseIP(ip)), got.Evaluate(net.ParseIP(ip))
+		if d.Action != want.Action || d.Reason != want.Reason {
+			t.Errorf("Evaluate(%s) = %s (%s), want %s (%s)", ip, d.Action, d.Reason, want.Action, want.Reason)
+		}
+	}
+}
+
+func TestACL_UnmarshalBinaryErrors(t *testing.T) {
+	acl := mustACL(t, mustReadRules(t, "deny 10.0.66.*\nallow 10.*.*.*\n"), ipfilter.Deny, ipfilter.FirstMatch)
+	data, err := acl.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+
+	corrupt := func(i int, b byte) []byte {
+		d := append([]byte(nil), data...)
+		d[i] = b
+		return d
+	}
+	tests := map[string][]byte{
+		"empty":     nil,
+		"truncated": data[:len(data)-10],
+		"trailing":  append(append([]byte(nil), data...), 0),
+		"magic":     corrupt(0, 'X'),
+		"version":   corrupt(4, 3),
+		"mode":      corrupt(6, 9),
+		"default":   corrupt(7, 9),
+		"count":     corrupt(8, 200),
+		"checksum":  corrupt(20, 'x'),
+	}
+	for name, d := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got ipfilter.ACL
+			if err := got.UnmarshalBinary(d); err == nil {
+				t.Errorf("UnmarshalBinary() expected error but got none")
+			} else if !strings.Contains(err.Error(), "rule bundle") {
+				t.Errorf("UnmarshalBinary() error = %v, want a rule bundle error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Package ipfilter provides IPv4 access control built on top of ippy patterns.
+//
+// Allow and deny lists are compiled once into a Rules value, which can then be
+// enforced on HTTP handlers through Middleware or on raw TCP services.
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+// Matcher decides whether a client address is allowed to reach a service.
+type Matcher interface {
+	Allowed(ip net.IP) bool
+}
+
+// Rules is an allow/deny rule set. Deny patterns always take precedence; when
+// no allow pattern is configured every address that is not denied is allowed.
+type Rules struct {
+	allow []*ipexpr.IPExpr
+	deny  []*ipexpr.IPExpr
+}
+
+func NewRules(allow, deny []string) (*Rules, error) {
+	r := &Rules{}
+
+	var err error
+	if r.allow, err = compile(allow); err != nil {
+		return nil, fmt.Errorf("invalid allow rule: %w", err)
+	}
+	if r.deny, err = compile(deny); err != nil {
+		return nil, fmt.Errorf("invalid deny rule: %w", err)
+	}
+	return r, nil
+}
+
+func (r *Rules) Allowed(ip net.IP) bool {
+	if ip.To4() == nil {
+		return false
+	}
+
+	for _, e := range r.deny {
+		if e.Contains(ip) {
+			return false
+		}
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	for _, e := range r.allow {
+		if e.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func compile(patterns []string) ([]*ipexpr.IPExpr, error) {
+	exprs := make([]*ipexpr.IPExpr, 0, len(patterns))
+	for _, p := range patterns {
+		e, err := ipexpr.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, nil
+}
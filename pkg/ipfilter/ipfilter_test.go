@@ -0,0 +1,85 @@
+package ipfilter_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func TestNewRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+	}{
+		{name: "invalid allow", allow: []string{"10.0.0.256"}},
+		{name: "invalid deny", deny: []string{"10.0.*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ipfilter.NewRules(tt.allow, tt.deny); err == nil {
+				t.Errorf("NewRules() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestRules_Allowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		ip    net.IP
+		want  bool
+	}{
+		{
+			name: "empty rules allow everything",
+			ip:   net.IPv4(1, 2, 3, 4),
+			want: true,
+		},
+		{
+			name:  "allowed by pattern",
+			allow: []string{"10.0.*.*"},
+			ip:    net.IPv4(10, 0, 1, 1),
+			want:  true,
+		},
+		{
+			name:  "not in allow list",
+			allow: []string{"10.0.*.*"},
+			ip:    net.IPv4(10, 1, 1, 1),
+			want:  false,
+		},
+		{
+			name:  "deny wins over allow",
+			allow: []string{"10.0.*.*"},
+			deny:  []string{"10.0.66.*"},
+			ip:    net.IPv4(10, 0, 66, 1),
+			want:  false,
+		},
+		{
+			name: "deny only",
+			deny: []string{"10.0.66.*"},
+			ip:   net.IPv4(10, 0, 67, 1),
+			want: true,
+		},
+		{
+			name: "ipv6 is never allowed",
+			ip:   net.ParseIP("::1"),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ipfilter.NewRules(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("NewRules() failed: %v", err)
+			}
+			if got := rules.Allowed(tt.ip); got != tt.want {
+				t.Errorf("Allowed(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
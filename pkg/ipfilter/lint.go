@@ -0,0 +1,125 @@
+package ipfilter
+
+import "fmt"
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Finding kinds reported by Lint.
+const (
+	KindEmpty     = "empty"
+	KindDuplicate = "duplicate"
+	KindShadowed  = "shadowed"
+	KindRedundant = "redundant"
+	KindConflict  = "conflict"
+)
+
+// Finding is a problem detected in a rule list.
+type Finding struct {
+	Severity Severity
+	Kind     string
+	// Rule is the index of the offending rule and Line its source line.
+	Rule int
+	Line int
+	// Other is the index of the earlier rule involved, -1 if none.
+	Other   int
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", f.Line, f.Severity, f.Message)
+	}
+	return fmt.Sprintf("rule #%d: %s: %s", f.Rule+1, f.Severity, f.Message)
+}
+
+// Lint analyzes a rule list evaluated in first-match order and reports:
+//
+//   - empty patterns, which match no address (e.g. reversed ranges);
+//   - duplicates of an earlier rule;
+//   - rules fully covered by an earlier one, which are redundant when both
+//     share the action and shadowed (never applied) otherwise;
+//   - partial overlaps with an earlier rule of the opposite action.
+//
+// Each rule is reported at most once for duplication or coverage, against
+// the first earlier rule involved.
+func Lint(rules []Rule) []Finding {
+	var findings []Finding
+	report := func(sev Severity, kind string, i, j int, format string, args ...any) {
+		findings = append(findings, Finding{
+			Severity: sev,
+			Kind:     kind,
+			Rule:     i,
+			Line:     rules[i].Line,
+			Other:    j,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for i, r := range rules {
+		if r.Expr.Count() == 0 {
+			report(Error, KindEmpty, i, -1, "%s %s matches no address", r.Action, r.Pattern)
+			continue
+		}
+
+		covered := false
+		for j, prev := range rules[:i] {
+			if prev.Expr.Count() == 0 {
+				continue
+			}
+
+			switch {
+			case prev.Expr.Equal(r.Expr) && prev.Action == r.Action:
+				report(Warning, KindDuplicate, i, j, "%s %s duplicates %s", r.Action, r.Pattern, describe(j, prev))
+			case prev.Expr.Equal(r.Expr):
+				report(Error, KindDuplicate, i, j, "%s %s duplicates %s with the opposite action and never applies",
+					r.Action, r.Pattern, describe(j, prev))
+			case prev.Expr.Covers(r.Expr) && prev.Action == r.Action:
+				report(Warning, KindRedundant, i, j, "%s %s is redundant, already covered by %s", r.Action, r.Pattern, describe(j, prev))
+			case prev.Expr.Covers(r.Expr):
+				report(Error, KindShadowed, i, j, "%s %s is shadowed by %s and never applies", r.Action, r.Pattern, describe(j, prev))
+			default:
+				continue
+			}
+			covered = true
+			break
+		}
+		if covered {
+			continue
+		}
+
+		for j, prev := range rules[:i] {
+			if prev.Action == r.Action || !prev.Expr.Overlaps(r.Expr) {
+				continue
+			}
+			report(Info, KindConflict, i, j, "%s %s conflicts with %s on %d of its %d addresses",
+				r.Action, r.Pattern, describe(j, prev), prev.Expr.Intersect(r.Expr).Count(), r.Expr.Count())
+		}
+	}
+	return findings
+}
+
+func describe(i int, r Rule) string {
+	if r.Line > 0 {
+		return fmt.Sprintf("%s %s (line %d)", r.Action, r.Pattern, r.Line)
+	}
+	return fmt.Sprintf("%s %s (rule #%d)", r.Action, r.Pattern, i+1)
+}
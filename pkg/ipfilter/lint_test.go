@@ -0,0 +1,72 @@
+package ipfilter_test
+
+import (
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func TestLint(t *testing.T) {
+	rules := mustReadRules(t, `deny 10.0.66.*
+allow 10.0.*.*
+allow 10.0.1.*
+deny 10.0.66.1-10
+allow 192.168.1.10-1
+allow 10.0.*.*
+deny 172.16.1.*
+allow 172.16.1.*
+allow 172.16-17.0-1.*
+`)
+
+	want := []struct {
+		severity ipfilter.Severity
+		kind     string
+		rule     int
+		line     int
+		other    int
+	}{
+		{ipfilter.Info, ipfilter.KindConflict, 1, 2, 0},
+		{ipfilter.Warning, ipfilter.KindRedundant, 2, 3, 1},
+		{ipfilter.Warning, ipfilter.KindRedundant, 3, 4, 0},
+		{ipfilter.Error, ipfilter.KindEmpty, 4, 5, -1},
+		{ipfilter.Warning, ipfilter.KindDuplicate, 5, 6, 1},
+		{ipfilter.Error, ipfilter.KindDuplicate, 7, 8, 6},
+		{ipfilter.Info, ipfilter.KindConflict, 8, 9, 6},
+	}
+
+	got := ipfilter.Lint(rules)
+	if len(got) != len(want) {
+		for _, f := range got {
+			t.Log(f)
+		}
+		t.Fatalf("Lint() returned %d findings, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		f := got[i]
+		if f.Severity != w.severity || f.Kind != w.kind || f.Rule != w.rule || f.Line != w.line || f.Other != w.other {
+			t.Errorf("finding %d = %+v, want %+v", i, f, w)
+		}
+	}
+}
+
+func TestLint_Shadowed(t *testing.T) {
+	rules := mustReadRules(t, "allow 10.0.*.*\ndeny 10.0.66.*\n")
+
+	got := ipfilter.Lint(rules)
+	if len(got) != 1 {
+		t.Fatalf("Lint() returned %d findings, want 1", len(got))
+	}
+
+	want := "line 2: error: deny 10.0.66.* is shadowed by allow 10.0.*.* (line 1) and never applies"
+	if got[0].Kind != ipfilter.KindShadowed || got[0].String() != want {
+		t.Errorf("finding = %q, want %q", got[0], want)
+	}
+}
+
+func TestLint_Clean(t *testing.T) {
+	rules := mustReadRules(t, "allow 10.0.*.*\nallow 192.168.1.*\ndeny 172.16.*.*\n")
+
+	if got := ipfilter.Lint(rules); len(got) != 0 {
+		t.Errorf("Lint() = %v, want no findings", got)
+	}
+}
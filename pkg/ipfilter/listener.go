@@ -0,0 +1,71 @@
+package ipfilter
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// Listener wraps a net.Listener and only hands out connections whose remote
+// address is allowed by a Matcher. Rejected connections are closed right
+// after being accepted.
+type Listener struct {
+	net.Listener
+
+	matcher  Matcher
+	accepted atomic.Uint64
+	rejected atomic.Uint64
+
+	// OnReject, when set, is called with every rejected connection before it
+	// is closed. It must be set before Accept is first called.
+	OnReject func(net.Conn)
+}
+
+func NewListener(l net.Listener, m Matcher) *Listener {
+	return &Listener{Listener: l, matcher: m}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.matcher.Allowed(remoteIP(conn.RemoteAddr())) {
+			l.accepted.Add(1)
+			return conn, nil
+		}
+
+		l.rejected.Add(1)
+		if l.OnReject != nil {
+			l.OnReject(conn)
+		}
+		_ = conn.Close()
+	}
+}
+
+// Accepted returns the number of connections handed out so far.
+func (l *Listener) Accepted() uint64 {
+	return l.accepted.Load()
+}
+
+// Rejected returns the number of connections closed because their remote
+// address was not allowed.
+func (l *Listener) Rejected() uint64 {
+	return l.rejected.Load()
+}
+
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	case nil:
+		return nil
+	default:
+		return parseHost(a.String())
+	}
+}
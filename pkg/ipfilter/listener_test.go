@@ -0,0 +1,128 @@
+package ipfilter_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+	closed bool
+}
+
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *addrConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// sliceListener hands out the given connections and then fails.
+type sliceListener struct {
+	conns []*addrConn
+}
+
+var errExhausted = errors.New("no more connections")
+
+func (l *sliceListener) Accept() (net.Conn, error) {
+	if len(l.conns) == 0 {
+		return nil, errExhausted
+	}
+	c := l.conns[0]
+	l.conns = l.conns[1:]
+	return c, nil
+}
+
+func (l *sliceListener) Close() error   { return nil }
+func (l *sliceListener) Addr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func TestListener_Accept(t *testing.T) {
+	rules, err := ipfilter.NewRules([]string{"10.0.*.*"}, []string{"10.0.66.*"})
+	if err != nil {
+		t.Fatalf("NewRules() failed: %v", err)
+	}
+
+	conns := []*addrConn{
+		{remote: &net.TCPAddr{IP: net.IPv4(10, 0, 66, 1), Port: 1000}},
+		{remote: &net.TCPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 1001}},
+		{remote: &net.TCPAddr{IP: net.IPv4(10, 0, 1, 1), Port: 1002}},
+		{remote: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1003}},
+		{remote: &net.TCPAddr{IP: net.IPv4(10, 0, 2, 1), Port: 1004}},
+	}
+	inner := &sliceListener{conns: append([]*addrConn{}, conns...)}
+
+	var logged []net.Addr
+	l := ipfilter.NewListener(inner, rules)
+	l.OnReject = func(c net.Conn) { logged = append(logged, c.RemoteAddr()) }
+
+	var got []net.Conn
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, errExhausted) {
+				t.Fatalf("Accept() unexpected error: %v", err)
+			}
+			break
+		}
+		got = append(got, c)
+	}
+
+	if len(got) != 2 || got[0] != conns[2] || got[1] != conns[4] {
+		t.Fatalf("Accept() returned %v, want connections 2 and 4", got)
+	}
+	for _, i := range []int{0, 1, 3} {
+		if !conns[i].closed {
+			t.Errorf("rejected connection %d was not closed", i)
+		}
+	}
+	for _, i := range []int{2, 4} {
+		if conns[i].closed {
+			t.Errorf("accepted connection %d was closed", i)
+		}
+	}
+	if len(logged) != 3 {
+		t.Errorf("OnReject called %d times, want 3", len(logged))
+	}
+	if l.Accepted() != 2 {
+		t.Errorf("Accepted() = %d, want 2", l.Accepted())
+	}
+	if l.Rejected() != 3 {
+		t.Errorf("Rejected() = %d, want 3", l.Rejected())
+	}
+}
+
+func TestListener_TCP(t *testing.T) {
+	rules, err := ipfilter.NewRules(nil, []string{"127.*.*.*"})
+	if err != nil {
+		t.Fatalf("NewRules() failed: %v", err)
+	}
+
+	inner, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	l := ipfilter.NewListener(inner, rules)
+	defer func() { _ = l.Close() }()
+
+	rejected := make(chan struct{})
+	l.OnReject = func(net.Conn) { close(rejected) }
+	go func() { _, _ = l.Accept() }()
+
+	c, err := net.Dial("tcp4", inner.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	<-rejected
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read() on a rejected connection expected error but got none")
+	}
+	if l.Rejected() != 1 {
+		t.Errorf("Rejected() = %d, want 1", l.Rejected())
+	}
+}
@@ -0,0 +1,137 @@
+package ipfilter
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+type Config struct {
+	Allow []string
+	Deny  []string
+	// Matcher, when set, is used instead of the Allow and Deny patterns,
+	// e.g. to plug in a Reloadable rule set.
+	Matcher Matcher
+
+	// TrustedHops is the number of reverse proxies in front of the service
+	// whose forwarding headers can be trusted. When zero, the client address
+	// is always taken from the request RemoteAddr.
+	TrustedHops int
+	// Header is the forwarding header consulted when TrustedHops is positive.
+	// It defaults to X-Forwarded-For; Forwarded (RFC 7239) is also supported.
+	Header string
+
+	// DeniedStatus is the status code returned to rejected clients, 403 if unset.
+	DeniedStatus int
+	// DeniedHandler, when set, serves rejected requests instead of DeniedStatus.
+	DeniedHandler http.Handler
+}
+
+// Middleware enforces a Matcher on incoming HTTP requests.
+type Middleware struct {
+	matcher Matcher
+	hops    int
+	header  string
+	denied  http.Handler
+}
+
+func New(cfg Config) (*Middleware, error) {
+	matcher := cfg.Matcher
+	if matcher == nil {
+		rules, err := NewRules(cfg.Allow, cfg.Deny)
+		if err != nil {
+			return nil, err
+		}
+		matcher = rules
+	}
+
+	m := &Middleware{
+		matcher: matcher,
+		hops:    max(cfg.TrustedHops, 0),
+		header:  http.CanonicalHeaderKey(cfg.Header),
+		denied:  cfg.DeniedHandler,
+	}
+	if m.header == "" {
+		m.header = HeaderXForwardedFor
+	}
+	if m.denied == nil {
+		status := cfg.DeniedStatus
+		if status == 0 {
+			status = http.StatusForbidden
+		}
+		m.denied = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, http.StatusText(status), status)
+		})
+	}
+	return m, nil
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := m.ClientIP(r)
+		if ip == nil || !m.matcher.Allowed(ip) {
+			m.denied.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the address the rules are evaluated against, or nil when
+// it cannot be determined.
+//
+// The hop chain is built from the forwarding header entries followed by the
+// request RemoteAddr; skipping the trusted hops from the right yields the
+// client. Chains shorter than the number of trusted hops resolve to their
+// leftmost entry.
+func (m *Middleware) ClientIP(r *http.Request) net.IP {
+	remote := parseHost(r.RemoteAddr)
+	if m.hops == 0 {
+		return remote
+	}
+
+	var chain []string
+	for _, v := range r.Header.Values(m.header) {
+		if m.header == HeaderForwarded {
+			chain = append(chain, forwardedFor(v)...)
+		} else {
+			chain = append(chain, strings.Split(v, ",")...)
+		}
+	}
+	if len(chain) == 0 {
+		return remote
+	}
+
+	i := max(len(chain)-m.hops, 0)
+	return parseHost(strings.TrimSpace(chain[i]))
+}
+
+// forwardedFor extracts the for= parameters of an RFC 7239 Forwarded header.
+func forwardedFor(v string) []string {
+	var out []string
+	for elem := range strings.SplitSeq(v, ",") {
+		for pair := range strings.SplitSeq(elem, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !strings.EqualFold(key, "for") {
+				continue
+			}
+			out = append(out, strings.Trim(value, `"`))
+		}
+	}
+	return out
+}
+
+// parseHost parses an address with an optional port, as found in RemoteAddr
+// and forwarding headers.
+func parseHost(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return net.ParseIP(s)
+}
@@ -0,0 +1,172 @@
+package ipfilter_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestMiddleware_Handler(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        ipfilter.Config
+		remoteAddr string
+		headers    map[string][]string
+		wantStatus int
+	}{
+		{
+			name:       "allowed remote address",
+			cfg:        ipfilter.Config{Allow: []string{"192.168.1.*"}},
+			remoteAddr: "192.168.1.10:4321",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "rejected remote address",
+			cfg:        ipfilter.Config{Allow: []string{"192.168.1.*"}},
+			remoteAddr: "192.168.2.10:4321",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "headers are ignored without trusted hops",
+			cfg:        ipfilter.Config{Allow: []string{"192.168.1.*"}},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "client taken from x-forwarded-for",
+			cfg:        ipfilter.Config{Allow: []string{"192.168.1.*"}, TrustedHops: 1},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "spoofed x-forwarded-for entry is skipped",
+			cfg:        ipfilter.Config{Allow: []string{"192.168.1.*"}, TrustedHops: 1},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10, 172.16.0.5"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "two trusted hops across header lines",
+			cfg:        ipfilter.Config{Allow: []string{"192.168.1.*"}, TrustedHops: 2},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10", "10.0.0.2"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "short chain resolves to leftmost entry",
+			cfg:        ipfilter.Config{Deny: []string{"192.168.1.*"}, TrustedHops: 3},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "client taken from forwarded",
+			cfg: ipfilter.Config{
+				Allow:       []string{"192.168.1.*"},
+				TrustedHops: 1,
+				Header:      ipfilter.HeaderForwarded,
+			},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"Forwarded": {`for="192.168.1.10:8080";proto=https, for=10.0.0.2`}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "forwarded with two trusted hops",
+			cfg: ipfilter.Config{
+				Allow:       []string{"192.168.1.*"},
+				TrustedHops: 2,
+				Header:      ipfilter.HeaderForwarded,
+			},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"Forwarded": {`for="192.168.1.10:8080";proto=https, for=10.0.0.2`}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "obfuscated forwarded identifier is rejected",
+			cfg: ipfilter.Config{
+				TrustedHops: 1,
+				Header:      ipfilter.HeaderForwarded,
+			},
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"Forwarded": {"for=_hidden"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "ipv6 client is rejected",
+			cfg:        ipfilter.Config{},
+			remoteAddr: "[2001:db8::1]:4321",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "custom matcher overrides patterns",
+			cfg: ipfilter.Config{
+				Allow:   []string{"*.*.*.*"},
+				Matcher: mustRules([]string{"192.168.1.*"}, nil),
+			},
+			remoteAddr: "192.168.2.10:4321",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "custom denied status",
+			cfg:        ipfilter.Config{Deny: []string{"*.*.*.*"}, DeniedStatus: http.StatusNotFound},
+			remoteAddr: "192.168.1.10:4321",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "custom denied handler",
+			cfg: ipfilter.Config{
+				Deny: []string{"*.*.*.*"},
+				DeniedHandler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(http.StatusTeapot)
+				}),
+			},
+			remoteAddr: "192.168.1.10:4321",
+			wantStatus: http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := ipfilter.New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, vs := range tt.headers {
+				for _, v := range vs {
+					req.Header.Add(k, v)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			mw.Handler(okHandler).ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func mustRules(allow, deny []string) *ipfilter.Rules {
+	r, err := ipfilter.NewRules(allow, deny)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := ipfilter.New(ipfilter.Config{Allow: []string{"10.0.0"}}); err == nil {
+		t.Errorf("New() expected error but got none")
+	}
+}
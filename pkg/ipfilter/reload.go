@@ -0,0 +1,139 @@
+package ipfilter
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+type ReloadOptions struct {
+	// PollInterval enables reloading whenever the file modification time or
+	// size changes, checked at the given interval. Zero disables polling.
+	PollInterval time.Duration
+	// Signals trigger a reload when received; SIGHUP if empty.
+	Signals []os.Signal
+	// OnReload is called after every reload attempt with its outcome.
+	OnReload func(error)
+	// ParseOptions parses the patterns of the file, e.g. to resolve their
+	// attribute atoms or to bound them.
+	ParseOptions ipexpr.ParseOptions
+}
+
+// Reloadable is a Matcher backed by a rule file that can be reloaded at
+// runtime. New rules are fully validated before replacing the current ones,
+// so a broken file keeps the last good rule set in place. Lookups never
+// block on reloads.
+type Reloadable struct {
+	path  string
+	opts  ReloadOptions
+	rules atomic.Pointer[Rules]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewReloadable loads the rule file at path, failing if it is not valid.
+func NewReloadable(path string, opts ReloadOptions) (*Reloadable, error) {
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	r := &Reloadable{path: path, opts: opts}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloadable) Allowed(ip net.IP) bool {
+	return r.rules.Load().Allowed(ip)
+}
+
+// Rules returns the rule set currently in use.
+func (r *Reloadable) Rules() *Rules {
+	return r.rules.Load()
+}
+
+// Reload reads the rule file again and swaps it in if valid.
+func (r *Reloadable) Reload() error {
+	err := r.load()
+	if r.opts.OnReload != nil {
+		r.opts.OnReload(err)
+	}
+	return err
+}
+
+// Watch reloads the rules on the configured signals and, if enabled, on file
+// changes detected by polling. It blocks until ctx is done.
+func (r *Reloadable) Watch(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, r.opts.Signals...)
+	defer signal.Stop(sig)
+
+	var tick <-chan time.Time
+	if r.opts.PollInterval > 0 {
+		t := time.NewTicker(r.opts.PollInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			_ = r.Reload()
+		case <-tick:
+			if r.changed() {
+				_ = r.Reload()
+			}
+		}
+	}
+}
+
+// changed reports whether the file differs from the one seen by the last
+// reload attempt, so that a broken file is only reported once.
+func (r *Reloadable) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		missing := r.size < 0
+		r.modTime, r.size = time.Time{}, -1
+		return !missing
+	}
+	return !fi.ModTime().Equal(r.modTime) || fi.Size() != r.size
+}
+
+func (r *Reloadable) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r.modTime, r.size = fi.ModTime(), fi.Size()
+
+	rules, err := ParseRulesWithOptions(f, r.opts.ParseOptions)
+	if err != nil {
+		return err
+	}
+	r.rules.Store(rules)
+	return nil
+}
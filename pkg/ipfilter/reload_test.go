@@ -0,0 +1,152 @@
+package ipfilter_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+// writeRules atomically replaces the file at path, so that a polling watcher
+// never observes a partial write.
+func writeRules(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatalf("cannot write rules: %v", err)
+	}
+	if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+		t.Fatalf("cannot set rules mtime: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("cannot replace rules: %v", err)
+	}
+}
+
+func TestReloadable_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	now := time.Now()
+	writeRules(t, path, "allow 10.0.*.*\n", now)
+
+	var results []error
+	r, err := ipfilter.NewReloadable(path, ipfilter.ReloadOptions{
+		OnReload: func(err error) { results = append(results, err) },
+	})
+	if err != nil {
+		t.Fatalf("NewReloadable() failed: %v", err)
+	}
+	if !r.Allowed(net.IPv4(10, 0, 1, 1)) {
+		t.Fatalf("initial rules do not allow 10.0.1.1")
+	}
+
+	// broken rules are rejected and the previous set stays in place
+	writeRules(t, path, "allow 10.0.*\n", now.Add(time.Second))
+	if err := r.Reload(); err == nil {
+		t.Fatalf("Reload() expected error but got none")
+	}
+	if !r.Allowed(net.IPv4(10, 0, 1, 1)) {
+		t.Errorf("rules were replaced by an invalid file")
+	}
+
+	writeRules(t, path, "allow 192.168.*.*\n", now.Add(2*time.Second))
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if r.Allowed(net.IPv4(10, 0, 1, 1)) || !r.Allowed(net.IPv4(192, 168, 1, 1)) {
+		t.Errorf("rules were not replaced by the new file")
+	}
+
+	if len(results) != 2 || results[0] == nil || results[1] != nil {
+		t.Errorf("OnReload results = %v, want [error <nil>]", results)
+	}
+}
+
+func TestNewReloadable_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	writeRules(t, path, "deny 1.2.3\n", time.Now())
+
+	if _, err := ipfilter.NewReloadable(path, ipfilter.ReloadOptions{}); err == nil {
+		t.Errorf("NewReloadable() expected error but got none")
+	}
+	if _, err := ipfilter.NewReloadable(filepath.Join(t.TempDir(), "missing"), ipfilter.ReloadOptions{}); err == nil {
+		t.Errorf("NewReloadable() on a missing file expected error but got none")
+	}
+}
+
+func TestReloadable_ParseOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	now := time.Now()
+	writeRules(t, path, "allow 10.0.*.*\n", now)
+
+	r, err := ipfilter.NewReloadable(path, ipfilter.ReloadOptions{
+		ParseOptions: ipexpr.ParseOptions{Forbid: ipexpr.FeatureNegation},
+	})
+	if err != nil {
+		t.Fatalf("NewReloadable() failed: %v", err)
+	}
+
+	// reloads parse the patterns with the options too
+	writeRules(t, path, "allow !10.0.*.*\n", now.Add(time.Second))
+	var fe *ipexpr.FeatureError
+	if err := r.Reload(); !errors.As(err, &fe) {
+		t.Fatalf("Reload() = %v, want a *ipexpr.FeatureError", err)
+	}
+	if !r.Allowed(net.IPv4(10, 0, 1, 1)) {
+		t.Errorf("rules were replaced by a forbidden pattern")
+	}
+}
+
+func TestReloadable_WatchPolling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	now := time.Now()
+	writeRules(t, path, "allow 10.0.*.*\n", now)
+
+	reloaded := make(chan error, 8)
+	r, err := ipfilter.NewReloadable(path, ipfilter.ReloadOptions{
+		PollInterval: 5 * time.Millisecond,
+		OnReload:     func(err error) { reloaded <- err },
+	})
+	if err != nil {
+		t.Fatalf("NewReloadable() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Watch(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	writeRules(t, path, "allow 10.0.*\n", now.Add(time.Second))
+	select {
+	case err := <-reloaded:
+		if err == nil {
+			t.Fatalf("reload of a broken file succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("broken file change was not detected")
+	}
+
+	writeRules(t, path, "allow 192.168.*.*\n", now.Add(2*time.Second))
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("reload failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("file change was not detected")
+	}
+	if !r.Allowed(net.IPv4(192, 168, 1, 1)) {
+		t.Errorf("polled rules were not swapped in")
+	}
+}
@@ -0,0 +1,108 @@
+package ipfilter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/azraelsec/ippy/pkg/ipexpr"
+)
+
+type Action int
+
+const (
+	Allow Action = iota
+	Deny
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// Rule is a single entry of a rule file.
+type Rule struct {
+	Action  Action
+	Pattern string
+	Expr    *ipexpr.IPExpr
+	// Line is the 1-based line of the rule in its source, 0 if unknown.
+	Line int
+}
+
+// ReadRules parses a rule file. Each non-empty line holds an action followed
+// by a pattern, separated by spaces or tabs, e.g. "deny 10.0.66.*"; lines
+// without an action keyword are allow rules and everything after a '#' is a
+// comment. The whole input is validated and the first invalid line is
+// reported as an error.
+func ReadRules(r io.Reader) ([]Rule, error) {
+	return ReadRulesWithOptions(r, ipexpr.ParseOptions{})
+}
+
+// ReadRulesWithOptions is ReadRules parsing the patterns with opts, e.g. to
+// resolve their attribute atoms.
+func ReadRulesWithOptions(r io.Reader, opts ipexpr.ParseOptions) ([]Rule, error) {
+	var rules []Rule
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		rule := Rule{Action: Allow, Pattern: line, Line: n}
+		if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+			kw, rest := line[:i], line[i:]
+			switch strings.ToLower(kw) {
+			case "allow":
+				rule.Pattern = strings.TrimSpace(rest)
+			case "deny":
+				rule.Action = Deny
+				rule.Pattern = strings.TrimSpace(rest)
+			}
+		}
+
+		e, err := ipexpr.ParseWithOptions(rule.Pattern, opts)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %q: %w", n, rule.Pattern, err)
+		}
+		rule.Expr = e
+		rules = append(rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ParseRules reads a rule file into an allow/deny rule set.
+func ParseRules(r io.Reader) (*Rules, error) {
+	return ParseRulesWithOptions(r, ipexpr.ParseOptions{})
+}
+
+// ParseRulesWithOptions is ParseRules parsing the patterns with opts.
+func ParseRulesWithOptions(r io.Reader, opts ipexpr.ParseOptions) (*Rules, error) {
+	entries, err := ReadRulesWithOptions(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &Rules{}
+	for _, e := range entries {
+		if e.Action == Deny {
+			rules.deny = append(rules.deny, e.Expr)
+		} else {
+			rules.allow = append(rules.allow, e.Expr)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,72 @@
+package ipfilter_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/azraelsec/ippy/pkg/ipfilter"
+)
+
+func TestReadRules(t *testing.T) {
+	input := `# office networks
+allow 10.0.*.*
+deny  10.0.66.*   # quarantined
+192.168.1.1, 2, 3
+
+DENY 172.16-31.*.*
+deny	192.168.5.*
+allow 	 10.1.*.*	# tabs
+`
+	rules, err := ipfilter.ReadRules(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadRules() failed: %v", err)
+	}
+
+	want := []struct {
+		action  ipfilter.Action
+		pattern string
+		line    int
+	}{
+		{ipfilter.Allow, "10.0.*.*", 2},
+		{ipfilter.Deny, "10.0.66.*", 3},
+		{ipfilter.Allow, "192.168.1.1, 2, 3", 4},
+		{ipfilter.Deny, "172.16-31.*.*", 6},
+		{ipfilter.Deny, "192.168.5.*", 7},
+		{ipfilter.Allow, "10.1.*.*", 8},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("ReadRules() returned %d rules, want %d", len(rules), len(want))
+	}
+	for i, w := range want {
+		r := rules[i]
+		if r.Action != w.action || r.Pattern != w.pattern || r.Line != w.line || r.Expr == nil {
+			t.Errorf("rule %d = {%s %q line %d}, want {%s %q line %d}",
+				i, r.Action, r.Pattern, r.Line, w.action, w.pattern, w.line)
+		}
+	}
+}
+
+func TestReadRules_Invalid(t *testing.T) {
+	_, err := ipfilter.ReadRules(strings.NewReader("allow 10.0.*.*\ndeny 10.0.300.*\n"))
+	if err == nil {
+		t.Fatalf("ReadRules() expected error but got none")
+	}
+	if !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("ReadRules() error = %q, want it to reference line 2", err)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ipfilter.ParseRules(strings.NewReader("allow 10.0.*.*\ndeny 10.0.66.*\n"))
+	if err != nil {
+		t.Fatalf("ParseRules() failed: %v", err)
+	}
+
+	if !rules.Allowed(net.IPv4(10, 0, 1, 1)) {
+		t.Errorf("Allowed(10.0.1.1) = false, want true")
+	}
+	if rules.Allowed(net.IPv4(10, 0, 66, 1)) {
+		t.Errorf("Allowed(10.0.66.1) = true, want false")
+	}
+}